@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// MaxBodyBytes is the largest request body Decode accepts.
+const MaxBodyBytes = 1 << 20
+
+// Decode reads the JSON request body into a T and validates it (see Validate).
+// The body must be a single application/json object of at most MaxBodyBytes with no
+// unknown fields. Errors are *DomainError values ready for WriteError: 415 for the wrong
+// content type, 413 for oversized bodies, 400 for malformed JSON and 422 listing the
+// rejected fields otherwise.
+func Decode[T any](w http.ResponseWriter, r *http.Request) (T, error) {
+	var v T
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return v, &DomainError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    CodeUnsupportedMediaType,
+			Message: "Content-Type must be application/json",
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		// The limit may be crossed after the first value, e.g. by trailing whitespace.
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return v, decodeError(err)
+		}
+		return v, BadRequest("request body must contain a single JSON value")
+	}
+
+	if err := Validate(&v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return BadRequest("request body is empty").Wrap(err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return BadRequest("request body is malformed JSON").Wrap(err)
+	case errors.As(err, &syntaxErr):
+		return BadRequest(fmt.Sprintf("request body is malformed JSON at position %d", syntaxErr.Offset)).Wrap(err)
+	case errors.As(err, &maxBytesErr):
+		return &DomainError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    CodePayloadTooLarge,
+			Message: fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit),
+			Err:     err,
+		}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return BadRequest(fmt.Sprintf("request body must be a JSON %s", jsonType(typeErr.Type.Kind().String()))).Wrap(err)
+		}
+		return Validation("request validation failed", FieldError{
+			Field:   indexPattern.ReplaceAllString(typeErr.Field, "[$1]"),
+			Message: "must be a " + jsonType(typeErr.Type.Kind().String()),
+		}).Wrap(err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for DisallowUnknownFields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return Validation("request validation failed", FieldError{Field: field, Message: "is not allowed"}).Wrap(err)
+	}
+
+	// Errors returned by UnmarshalJSON methods, e.g. an unknown uuid or decimal format.
+	return Validation("request validation failed", FieldError{Message: err.Error()}).Wrap(err)
+}
+
+// indexPattern matches the ".0" array indexes of encoding/json field paths.
+var indexPattern = regexp.MustCompile(`\.(\d+)`)
+
+// jsonType names a Go kind the way API clients know it.
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "struct", kind == "map":
+		return "object"
+	}
+	return kind
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type decoded struct {
+	Name  string        `json:"name" validate:"required,max=10"`
+	Qty   int           `json:"qty" validate:"min=1"`
+	Items []decodedItem `json:"items,omitempty"`
+}
+
+type decodedItem struct {
+	SKU string `json:"sku" validate:"required"`
+	Qty int    `json:"qty"`
+}
+
+func decode(contentType, body string) (decoded, error) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return Decode[decoded](httptest.NewRecorder(), r)
+}
+
+func TestDecode(t *testing.T) {
+	valid := `{"name": "oil", "qty": 2}`
+	// Whitespace is part of the body, so this one is exactly MaxBodyBytes long.
+	atLimit := valid + strings.Repeat(" ", MaxBodyBytes-len(valid))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int    // 0 when the body is accepted
+		field       string // the rejected field of a 422
+	}{
+		{"valid", "application/json", valid, 0, ""},
+		{"with a charset", "application/json; charset=utf-8", valid, 0, ""},
+		{"at the size limit", "application/json", atLimit, 0, ""},
+		{"no content type", "", valid, http.StatusUnsupportedMediaType, ""},
+		{"form", "application/x-www-form-urlencoded", "name=oil", http.StatusUnsupportedMediaType, ""},
+		{"text", "text/plain", valid, http.StatusUnsupportedMediaType, ""},
+		{"JSON lookalike", "application/json-patch+json", valid, http.StatusUnsupportedMediaType, ""},
+		{"over the size limit", "application/json", `{"name": "` + strings.Repeat("a", MaxBodyBytes) + `"}`,
+			http.StatusRequestEntityTooLarge, ""},
+		{"over the size limit after the value", "application/json", atLimit + " ", http.StatusRequestEntityTooLarge, ""},
+		{"empty", "application/json", "", http.StatusBadRequest, ""},
+		{"malformed", "application/json", `{"name": "oil",}`, http.StatusBadRequest, ""},
+		{"truncated", "application/json", `{"name": "oil"`, http.StatusBadRequest, ""},
+		{"not an object", "application/json", `[1, 2]`, http.StatusBadRequest, ""},
+		{"trailing value", "application/json", valid + ` {}`, http.StatusBadRequest, ""},
+		{"trailing garbage", "application/json", valid + ` x`, http.StatusBadRequest, ""},
+		{"unknown field", "application/json", `{"name": "oil", "qty": 2, "price": 10}`, http.StatusUnprocessableEntity, "price"},
+		{"unknown nested field", "application/json", `{"name": "oil", "qty": 2, "items": [{"sku": "a", "color": "red"}]}`,
+			http.StatusUnprocessableEntity, "color"},
+		{"wrong type", "application/json", `{"name": "oil", "qty": "2"}`, http.StatusUnprocessableEntity, "qty"},
+		{"wrong nested type", "application/json", `{"name": "oil", "qty": 2, "items": [{"sku": "a"}, {"sku": "b", "qty": "x"}]}`,
+			http.StatusUnprocessableEntity, "items[1].qty"},
+		{"tags are validated", "application/json", `{"qty": 2}`, http.StatusUnprocessableEntity, "name"},
+		{"nested tags are validated", "application/json", `{"name": "oil", "qty": 2, "items": [{"qty": 1}]}`,
+			http.StatusUnprocessableEntity, "items[0].sku"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decode(tt.contentType, tt.body)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if v.Name != "oil" || v.Qty != 2 {
+					t.Fatalf("decoded %+v", v)
+				}
+				return
+			}
+
+			var de *DomainError
+			if !errors.As(err, &de) || de.Status != tt.status {
+				t.Fatalf("Decode error = %v, want a %d", err, tt.status)
+			}
+			if tt.field != "" {
+				fields, _ := de.Details.([]FieldError)
+				if len(fields) != 1 || fields[0].Field != tt.field {
+					t.Fatalf("rejected %+v, want %s", fields, tt.field)
+				}
+			}
+		})
+	}
+}
@@ -1,19 +1,131 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 
 	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun/driver/pgdriver"
 )
 
+// EnvLocal is the Config.Env value of a developer machine.
+const EnvLocal = "local"
+
+// exposeStack enables ErrorResponse.Stack; it is only set for local environments.
+var exposeStack atomic.Bool
+
+// SetEnv configures error responses for the environment, see Config.Env.
+// Stack traces are only sent to clients when env is local.
+func SetEnv(env string) {
+	exposeStack.Store(env == EnvLocal)
+}
+
 // Error writes an error message as a JSON response.
 func Error(w http.ResponseWriter, code int, error ErrorResponse) {
 	errorJSON(w, code, error)
 }
 
+// WriteError writes err as a JSON response. A *DomainError is written as is,
+// sql.ErrNoRows becomes a 404 and Postgres constraint and serialization failures are
+// mapped to 409/422; anything else is logged and reported as a 500 without its message.
+func WriteError(w http.ResponseWriter, err error) {
+	e := toDomainError(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		log.Error().Err(err).Msg("internal server error")
+	}
+
+	payload := ErrorResponse{
+		Code:    e.Code,
+		Message: e.Message,
+		Details: e.Details,
+	}
+	if exposeStack.Load() {
+		payload.Stack = Stack{
+			Error: err.Error(),
+			Trace: strings.Split(strings.TrimSpace(string(debug.Stack())), "\n"),
+		}
+	}
+
+	errorJSON(w, e.Status, payload)
+}
+
+func toDomainError(err error) *DomainError {
+	var domainErr *DomainError
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("resource not found").Wrap(err)
+	}
+
+	var pgErr pgFields
+	if errors.As(err, &pgErr) {
+		if e := pgError(pgErr); e != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	return &DomainError{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Message: "internal server error",
+		Err:     err,
+	}
+}
+
+// pgFields is the part of pgdriver.Error that pgError reads: the fields of the error
+// message, by their protocol code ('C' is the SQLSTATE).
+type pgFields interface {
+	Field(k byte) string
+}
+
+var _ pgFields = pgdriver.Error{}
+
+// pgError maps the SQLSTATE of a Postgres error, or returns nil if it is not a client error.
+func pgError(pgErr pgFields) *DomainError {
+	details := ConstraintDetails{
+		Constraint: pgErr.Field('n'),
+		Table:      pgErr.Field('t'),
+		Column:     pgErr.Field('c'),
+	}
+
+	switch pgErr.Field('C') {
+	case "23505": // unique_violation
+		return Conflict("resource already exists").WithDetails(details)
+	case "23503": // foreign_key_violation
+		e := Conflict("referenced resource does not exist or is still in use").WithDetails(details)
+		e.Code = CodeInvalidReference
+		return e
+	case "23P01": // exclusion_violation
+		return Conflict("conflicts with an existing resource").WithDetails(details)
+	case "23514": // check_violation
+		return Validation("value violates a constraint").WithDetails(details)
+	case "23502": // not_null_violation
+		return Validation("required value is missing").WithDetails(details)
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		e := Conflict("concurrent update, please retry")
+		e.Code = CodeRetry
+		return e
+	}
+	return nil
+}
+
 // errorJSON writes the payload as JSON with the given HTTP status.
 func errorJSON(w http.ResponseWriter, code int, payload ErrorResponse) {
+	if payload.Code == "" {
+		payload.Code = codeForStatus(code)
+	}
+	if !exposeStack.Load() {
+		payload.Stack = nil
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// pgErr stands in for a pgdriver.Error with the given fields.
+type pgErr map[byte]string
+
+func (e pgErr) Field(k byte) string { return e[k] }
+func (e pgErr) Error() string       { return "ERROR: " + e['M'] + " (SQLSTATE=" + e['C'] + ")" }
+
+// written is the decoded body of an error response.
+type written struct {
+	Code   int    `json:"code"`
+	Status string `json:"status"`
+	Error  struct {
+		Stack   *Stack          `json:"stack"`
+		Code    ErrorCode       `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	} `json:"error"`
+}
+
+func writeError(t *testing.T, err error) (*httptest.ResponseRecorder, written) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	WriteError(w, err)
+
+	var body written
+	if e := json.Unmarshal(w.Body.Bytes(), &body); e != nil {
+		t.Fatalf("body %s: %v", w.Body, e)
+	}
+	return w, body
+}
+
+func TestWriteError(t *testing.T) {
+	constraint := pgErr{'n': "customers_email_key", 't': "customers", 'c': "email"}
+	withState := func(state string) pgErr {
+		e := pgErr{'C': state, 'M': "violation"}
+		for k, v := range constraint {
+			e[k] = v
+		}
+		return e
+	}
+	constraintDetails := `{"constraint":"customers_email_key","table":"customers","column":"email"}`
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    ErrorCode
+		message string
+		details string // JSON, "" for none
+	}{
+		{"bad request", BadRequest("invalid id"), 400, CodeBadRequest, "invalid id", ""},
+		{"unauthorized", Unauthorized("missing token"), 401, CodeUnauthorized, "missing token", ""},
+		{"forbidden with details", Forbidden("insufficient permissions").WithDetails(map[string]any{"role": "viewer"}),
+			403, CodeForbidden, "insufficient permissions", `{"role":"viewer"}`},
+		{"not found", NotFound("vehicle not found"), 404, CodeNotFound, "vehicle not found", ""},
+		{"conflict", Conflict("already sent"), 409, CodeConflict, "already sent", ""},
+		{"precondition failed", PreconditionFailed("stale version"), 412, CodePreconditionFailed, "stale version", ""},
+		{"validation", Validation("request validation failed", FieldError{Field: "email", Message: "is required"}),
+			422, CodeValidation, "request validation failed", `[{"field":"email","message":"is required"}]`},
+		{"wrapped domain error keeps its message", fmt.Errorf("loading: %w", NotFound("customer not found").Wrap(errors.New("cause"))),
+			404, CodeNotFound, "customer not found", ""},
+		{"no rows", fmt.Errorf("select: %w", sql.ErrNoRows), 404, CodeNotFound, "resource not found", ""},
+		{"unique violation", withState("23505"), 409, CodeConflict, "resource already exists", constraintDetails},
+		{"foreign key violation", withState("23503"), 409, CodeInvalidReference,
+			"referenced resource does not exist or is still in use", constraintDetails},
+		{"exclusion violation", withState("23P01"), 409, CodeConflict, "conflicts with an existing resource", constraintDetails},
+		{"check violation", withState("23514"), 422, CodeValidation, "value violates a constraint", constraintDetails},
+		{"serialization failure", fmt.Errorf("commit: %w", pgErr{'C': "40001"}), 409, CodeRetry, "concurrent update, please retry", ""},
+		{"other Postgres error", pgErr{'C': "42P01", 'M': `relation "secrets" does not exist`}, 500, CodeInternal,
+			"internal server error", ""},
+		{"anything else", errors.New("dial tcp: connection refused"), 500, CodeInternal, "internal server error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := writeError(t, tt.err)
+
+			if w.Code != tt.status || body.Code != tt.status || body.Status != http.StatusText(tt.status) {
+				t.Fatalf("status = %d, body %d %q, want %d", w.Code, body.Code, body.Status, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("Content-Type = %s", ct)
+			}
+			if body.Error.Code != tt.code || body.Error.Message != tt.message {
+				t.Fatalf("error = %s %q, want %s %q", body.Error.Code, body.Error.Message, tt.code, tt.message)
+			}
+			if !sameJSON(body.Error.Details, tt.details) {
+				t.Fatalf("details = %s, want %s", body.Error.Details, tt.details)
+			}
+		})
+	}
+}
+
+func TestWriteErrorStackOnlyLocally(t *testing.T) {
+	defer SetEnv("") // the default: no stack
+	err := fmt.Errorf("query: %w", errors.New("password authentication failed"))
+
+	for _, env := range []string{"production", "staging", ""} {
+		SetEnv(env)
+		_, body := writeError(t, err)
+		if body.Error.Stack != nil {
+			t.Fatalf("ENV=%q exposes the stack: %+v", env, body.Error.Stack)
+		}
+	}
+
+	SetEnv(EnvLocal)
+	_, body := writeError(t, err)
+	if body.Error.Stack == nil || body.Error.Stack.Error != err.Error() || len(body.Error.Stack.Trace) == 0 {
+		t.Fatalf("ENV=local stack = %+v", body.Error.Stack)
+	}
+	if body.Error.Message != "internal server error" {
+		t.Fatalf("message = %q leaks the cause", body.Error.Message)
+	}
+}
+
+func sameJSON(got json.RawMessage, want string) bool {
+	if want == "" {
+		return len(got) == 0 || string(got) == "null"
+	}
+	var a, b any
+	if json.Unmarshal(got, &a) != nil || json.Unmarshal([]byte(want), &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode is the machine-readable code sent in ErrorResponse.Code.
+type ErrorCode string
+
+const (
+	CodeBadRequest           ErrorCode = "bad_request"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodeInvalidReference     ErrorCode = "invalid_reference"
+	CodePreconditionFailed   ErrorCode = "precondition_failed"
+	CodeValidation           ErrorCode = "validation_failed"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeRetry                ErrorCode = "retry"
+	CodeInternal             ErrorCode = "internal_error"
+)
+
+// FieldError describes why one input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// DomainError is an error that knows how it is reported to clients. Services return
+// them (see NotFound, Conflict, ...) and WriteError turns them into responses.
+type DomainError struct {
+	Status  int
+	Code    ErrorCode
+	Message string
+	Details any
+
+	// Err is the underlying cause. It is logged and shown in local stack traces only.
+	Err error
+}
+
+func (e *DomainError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *DomainError) Wrap(err error) *DomainError {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *DomainError) WithDetails(details any) *DomainError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+func BadRequest(msg string) *DomainError {
+	return &DomainError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: msg}
+}
+
+func Unauthorized(msg string) *DomainError {
+	return &DomainError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: msg}
+}
+
+func Forbidden(msg string) *DomainError {
+	return &DomainError{Status: http.StatusForbidden, Code: CodeForbidden, Message: msg}
+}
+
+func NotFound(msg string) *DomainError {
+	return &DomainError{Status: http.StatusNotFound, Code: CodeNotFound, Message: msg}
+}
+
+func Conflict(msg string) *DomainError {
+	return &DomainError{Status: http.StatusConflict, Code: CodeConflict, Message: msg}
+}
+
+func PreconditionFailed(msg string) *DomainError {
+	return &DomainError{Status: http.StatusPreconditionFailed, Code: CodePreconditionFailed, Message: msg}
+}
+
+// Validation reports invalid input, one FieldError per rejected field.
+func Validation(msg string, fields ...FieldError) *DomainError {
+	e := &DomainError{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: msg}
+	if len(fields) > 0 {
+		e.Details = fields
+	}
+	return e
+}
+
+// codeForStatus is the default code of responses written without one.
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return ""
+}
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// FilterOp is how a filter parameter is compared with its column.
+type FilterOp int
+
+const (
+	// OpEq matches any of the comma separated values.
+	OpEq FilterOp = iota
+	// OpGte and OpLte bound the column, e.g. ?opened_after=2025-01-01. A date given to
+	// OpLte takes in the whole day: ?opened_before=2025-01-31 includes January 31st.
+	OpGte
+	OpLte
+)
+
+// Filter whitelists a query parameter that narrows a list.
+type Filter struct {
+	Param  string
+	Column string
+	Op     FilterOp
+	// Parse converts a raw value to the column's type; values are used as strings when nil.
+	Parse func(string) (any, error)
+}
+
+// ListSpec describes the query parameters a list endpoint accepts. Columns are bare
+// column names of the listed model and are qualified with Alias.
+type ListSpec struct {
+	Alias   string
+	Filters []Filter
+	// Sorts are the columns clients may sort by; they must be NOT NULL. Default is
+	// used when no sort is given, e.g. "-created_at".
+	Sorts   []string
+	Default string
+	// Search are the columns matched case-insensitively by ?search=.
+	Search []string
+	// SearchOr, when set, adds conditions OR'ed with the Search columns, for matches
+	// a column pattern can't express (e.g. related rows). It gets the trimmed search.
+	SearchOr func(q *bun.SelectQuery, search string) *bun.SelectQuery
+}
+
+// ListParams is a parsed list request, see ParseList.
+type ListParams struct {
+	Limit  int
+	Search string
+
+	spec    ListSpec
+	sort    string
+	desc    bool
+	filters []filterValue
+	cursor  *cursor
+}
+
+type filterValue struct {
+	Filter
+	values []any
+}
+
+// cursor is the position after the last row of a page: its sort key and id.
+// Sort is kept so a cursor is not reused with a different order.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Page is the pagination metadata of a list response.
+type Page struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ParseList reads limit, cursor, sort, search and the spec's filters from the query
+// string. Unknown filter parameters are ignored; invalid values are a 422.
+func ParseList(r *http.Request, spec ListSpec) (ListParams, error) {
+	q := r.URL.Query()
+	p := ListParams{Limit: DefaultLimit, spec: spec}
+	var fe FieldErrors
+
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			fe.Add("limit", "must be a number between 1 and %d", MaxLimit)
+		}
+		p.Limit = limit
+	}
+
+	sort := q.Get("sort")
+	if sort == "" {
+		sort = spec.Default
+	}
+	p.desc = strings.HasPrefix(sort, "-")
+	p.sort = strings.TrimPrefix(sort, "-")
+	if !contains(spec.Sorts, p.sort) {
+		fe.Add("sort", "must be one of: %s (prefix with - for descending)", strings.Join(spec.Sorts, ", "))
+	}
+
+	if raw := q.Get("cursor"); raw != "" {
+		c, err := decodeCursor(raw)
+		if err != nil || c.Sort != sort {
+			fe.Add("cursor", "is invalid or does not match the sort order")
+		}
+		p.cursor = c
+	}
+
+	if len(spec.Search) > 0 {
+		p.Search = strings.TrimSpace(q.Get("search"))
+	}
+
+	for _, f := range spec.Filters {
+		raw := q.Get(f.Param)
+		if raw == "" {
+			continue
+		}
+
+		parts := []string{raw}
+		if f.Op == OpEq {
+			parts = strings.Split(raw, ",")
+		}
+
+		fv := filterValue{Filter: f}
+		for _, part := range parts {
+			var v any = strings.TrimSpace(part)
+			if f.Parse != nil {
+				var err error
+				if v, err = f.Parse(strings.TrimSpace(part)); err != nil {
+					fe.Add(f.Param, "%s", err.Error())
+					break
+				}
+			}
+			fv.values = append(fv.values, v)
+		}
+		p.filters = append(p.filters, fv)
+	}
+
+	if len(fe) > 0 {
+		return p, Validation("invalid query parameters", fe...)
+	}
+	return p, nil
+}
+
+// Apply adds the filters, search, keyset condition, order and limit to q. One extra
+// row is fetched so PageOf can tell whether there is a next page.
+func (p ListParams) Apply(q *bun.SelectQuery) *bun.SelectQuery {
+	for _, f := range p.filters {
+		col := p.column(f.Column)
+		values := make([]any, len(f.values))
+		for i, v := range f.values {
+			values[i] = instant(v)
+		}
+
+		switch f.Op {
+		case OpGte:
+			q = q.Where("? >= ?", col, values[0])
+		case OpLte:
+			if d, ok := f.values[0].(date); ok {
+				// Up to the next midnight, like appointments.Bound does for to=.
+				q = q.Where("? < ?", col, d.AddDate(0, 0, 1))
+			} else {
+				q = q.Where("? <= ?", col, values[0])
+			}
+		default:
+			if len(values) == 1 {
+				q = q.Where("? = ?", col, values[0])
+			} else {
+				q = q.Where("? IN (?)", col, bun.In(values))
+			}
+		}
+	}
+
+	if p.Search != "" {
+		pattern := "%" + escapeLike(p.Search) + "%"
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			for _, c := range p.spec.Search {
+				q = q.WhereOr("? ILIKE ?", p.column(c), pattern)
+			}
+			if p.spec.SearchOr != nil {
+				q = p.spec.SearchOr(q, p.Search)
+			}
+			return q
+		})
+	}
+
+	sortCol, idCol := p.column(p.sort), p.column("id")
+	dir := "ASC"
+	if p.desc {
+		dir = "DESC"
+	}
+
+	if p.cursor != nil {
+		cmp := ">"
+		if p.desc {
+			cmp = "<"
+		}
+		// Literals are left untyped so Postgres reads them as the columns' types.
+		q = q.Where("(?, ?) "+cmp+" (?, ?)", sortCol, idCol, p.cursor.Value, p.cursor.ID)
+	}
+
+	return q.
+		OrderExpr("? "+dir+", ? "+dir, sortCol, idCol).
+		Limit(p.Limit + 1)
+}
+
+// PageOf trims the extra row fetched by Apply and builds the page metadata,
+// with a cursor pointing after the last returned row.
+func PageOf[T any](p ListParams, rows []T) ([]T, Page) {
+	page := Page{Limit: p.Limit}
+	if len(rows) <= p.Limit {
+		return rows, page
+	}
+
+	rows = rows[:p.Limit]
+	last := reflect.ValueOf(rows[len(rows)-1])
+	sort := p.sort
+	if p.desc {
+		sort = "-" + sort
+	}
+
+	page.HasMore = true
+	page.NextCursor = encodeCursor(cursor{
+		Sort:  sort,
+		Value: cursorValue(columnValue(last, p.sort)),
+		ID:    cursorValue(columnValue(last, "id")),
+	})
+	return rows, page
+}
+
+func (p ListParams) column(name string) bun.Ident {
+	if p.spec.Alias == "" {
+		return bun.Ident(name)
+	}
+	return bun.Ident(p.spec.Alias + "." + name)
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(raw string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// columnValue finds the field of a bun model struct mapped to column.
+func columnValue(v reflect.Value, column string) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("bun"), ",")
+		if name == column {
+			return v.Field(i)
+		}
+	}
+	panic(fmt.Sprintf("api: %s has no column %q", t, column))
+}
+
+func cursorValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUUID is a Filter.Parse for uuid columns.
+func ParseUUID(raw string) (any, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be a UUID")
+	}
+	return id, nil
+}
+
+// ParseBool is a Filter.Parse for boolean columns.
+func ParseBool(raw string) (any, error) {
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be true or false")
+	}
+	return b, nil
+}
+
+// date is a YYYY-MM-DD filter value: its midnight in UTC, or the whole day as an
+// OpLte bound.
+type date struct {
+	time.Time
+}
+
+// instant unwraps a date to its midnight.
+func instant(v any) any {
+	if d, ok := v.(date); ok {
+		return d.Time
+	}
+	return v
+}
+
+// ParseTime is a Filter.Parse for timestamp columns; it accepts RFC 3339 timestamps and
+// dates, taken in UTC.
+func ParseTime(raw string) (any, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	return date{t}, nil
+}
+
+// ParseEnum returns a Filter.Parse accepting only valid values of E.
+func ParseEnum[E interface {
+	~string
+	Enum
+}]() func(string) (any, error) {
+	return func(raw string) (any, error) {
+		e := E(raw)
+		if !e.Valid() {
+			return nil, fmt.Errorf("%q is not a valid value", raw)
+		}
+		return string(e), nil
+	}
+}
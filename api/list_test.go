@@ -0,0 +1,183 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// listed is a model listed with testSpec.
+type listed struct {
+	ID        uuid.UUID `bun:"id,pk"`
+	Name      string    `bun:"name"`
+	CreatedAt time.Time `bun:"created_at"`
+}
+
+var testSpec = ListSpec{
+	Alias: "x",
+	Filters: []Filter{
+		{Param: "id", Column: "id", Parse: ParseUUID},
+		{Param: "created_after", Column: "created_at", Op: OpGte, Parse: ParseTime},
+		{Param: "created_before", Column: "created_at", Op: OpLte, Parse: ParseTime},
+	},
+	Sorts:   []string{"created_at", "name"},
+	Default: "-created_at",
+	Search:  []string{"name"},
+}
+
+// testDB formats queries; it never connects.
+var testDB = bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+
+func parseList(t *testing.T, query string) (ListParams, error) {
+	t.Helper()
+	return ParseList(httptest.NewRequest("GET", "/things?"+query, nil), testSpec)
+}
+
+// applied renders the query ParseList and Apply build for query.
+func applied(t *testing.T, query string) string {
+	t.Helper()
+	p, err := parseList(t, query)
+	if err != nil {
+		t.Fatalf("ParseList(%q): %v", query, err)
+	}
+	return p.Apply(testDB.NewSelect().TableExpr("things AS x").Column("x.*")).String()
+}
+
+func TestParseListRejects(t *testing.T) {
+	descCursor := encodeCursor(cursor{Sort: "-created_at", Value: "2025-10-20T00:00:00Z", ID: uuid.NewString()})
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"limit zero", "limit=0", "limit"},
+		{"limit above the max", "limit=201", "limit"},
+		{"limit not a number", "limit=ten", "limit"},
+		{"unknown sort", "sort=email", "sort"},
+		{"unknown descending sort", "sort=-email", "sort"},
+		{"cursor not base64", "cursor=%25%25%25", "cursor"},
+		{"cursor not JSON", "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("not json")), "cursor"},
+		{"cursor with a tampered id", "cursor=" + encodeCursor(cursor{Sort: "-created_at", Value: "x", ID: "1 OR 1=1"}), "cursor"},
+		{"cursor of another sort", "sort=name&cursor=" + descCursor, "cursor"},
+		{"cursor of the other direction", "sort=created_at&cursor=" + descCursor, "cursor"},
+		{"bad uuid filter", "id=" + uuid.NewString() + ",nope", "id"},
+		{"bad date filter", "created_before=2025-13-01", "created_before"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseList(t, tt.query)
+			de, ok := err.(*DomainError)
+			if !ok || de.Status != http.StatusUnprocessableEntity {
+				t.Fatalf("ParseList(%q) error = %v, want a 422", tt.query, err)
+			}
+			fields, _ := de.Details.([]FieldError)
+			if len(fields) != 1 || fields[0].Field != tt.field {
+				t.Fatalf("ParseList(%q) rejected %v, want %s", tt.query, fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	id := uuid.MustParse("0190a8a8-0000-7000-8000-000000000001")
+	cur := encodeCursor(cursor{Sort: "-created_at", Value: "2025-10-20T08:00:00Z", ID: id.String()})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"default sort is descending", "", []string{
+			`ORDER BY "x"."created_at" DESC, "x"."id" DESC`, "LIMIT 51",
+		}},
+		{"ascending", "sort=name&limit=10", []string{
+			`ORDER BY "x"."name" ASC, "x"."id" ASC`, "LIMIT 11",
+		}},
+		{"descending cursor continues below", "cursor=" + cur, []string{
+			`("x"."created_at", "x"."id") < ('2025-10-20T08:00:00Z', '` + id.String() + `')`,
+			`ORDER BY "x"."created_at" DESC, "x"."id" DESC`,
+		}},
+		{"ascending cursor continues above", "sort=created_at&cursor=" + encodeCursor(cursor{Sort: "created_at", Value: "v", ID: id.String()}), []string{
+			`("x"."created_at", "x"."id") > ('v', '` + id.String() + `')`,
+		}},
+		{"date before includes the whole day", "created_before=2025-10-20", []string{
+			`"x"."created_at" < '2025-10-21 00:00:00+00:00'`,
+		}},
+		{"date after starts at midnight", "created_after=2025-10-20", []string{
+			`"x"."created_at" >= '2025-10-20 00:00:00+00:00'`,
+		}},
+		{"timestamp before is inclusive", "created_before=2025-10-20T15:04:05Z", []string{
+			`"x"."created_at" <= '2025-10-20 15:04:05+00:00'`,
+		}},
+		{"several values", "id=" + id.String() + "," + id.String(), []string{
+			`"x"."id" IN ('` + id.String() + `', '` + id.String() + `')`,
+		}},
+		{"search escapes LIKE", "search=50%25_off", []string{
+			`"x"."name" ILIKE '%50\%\_off%'`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := applied(t, tt.query)
+			for _, w := range tt.want {
+				if !strings.Contains(sql, w) {
+					t.Errorf("query %s\nmissing %s", sql, w)
+				}
+			}
+		})
+	}
+}
+
+func TestPageOf(t *testing.T) {
+	rows := make([]*listed, 4)
+	for i := range rows {
+		rows[i] = &listed{
+			ID:        uuid.New(),
+			Name:      string(rune('a' + i)),
+			CreatedAt: time.Date(2025, 10, 20-i, 8, 0, 0, 0, time.UTC),
+		}
+	}
+
+	p, err := parseList(t, "limit=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, page := PageOf(p, rows[:3])
+	if len(got) != 3 || page.HasMore || page.NextCursor != "" {
+		t.Fatalf("exactly a page: %d rows, %+v", len(got), page)
+	}
+
+	// Apply fetches one row more than the limit: its presence means there is more.
+	got, page = PageOf(p, rows)
+	if len(got) != 3 || !page.HasMore || page.Limit != 3 {
+		t.Fatalf("page with more: %d rows, %+v", len(got), page)
+	}
+	c, err := decodeCursor(page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cursor{Sort: "-created_at", Value: "2025-10-18T08:00:00Z", ID: rows[2].ID.String()}
+	if *c != want {
+		t.Fatalf("cursor = %+v, want %+v", *c, want)
+	}
+
+	// The cursor is accepted for the next page of the same order.
+	next, err := parseList(t, "limit=3&cursor="+page.NextCursor)
+	if err != nil {
+		t.Fatalf("next page: %v", err)
+	}
+	if next.cursor == nil || *next.cursor != want {
+		t.Fatalf("next page cursor = %+v", next.cursor)
+	}
+}
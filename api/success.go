@@ -9,11 +9,16 @@ import (
 
 // Success writes an success message as a JSON response.
 func Success[T any](w http.ResponseWriter, code int, data T) {
-	successJSON[T](w, code, data)
+	successJSON[T](w, code, data, nil)
+}
+
+// SuccessPage writes one page of a list as a JSON response, see ListParams.
+func SuccessPage[T any](w http.ResponseWriter, code int, data []T, page Page) {
+	successJSON[[]T](w, code, data, &page)
 }
 
 // successJSON writes the payload as JSON with the given HTTP status.
-func successJSON[T any](w http.ResponseWriter, code int, payload T) {
+func successJSON[T any](w http.ResponseWriter, code int, payload T, page *Page) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 
@@ -21,6 +26,7 @@ func successJSON[T any](w http.ResponseWriter, code int, payload T) {
 		Code:   code,
 		Status: http.StatusText(code),
 		Result: payload,
+		Page:   page,
 		Error:  nil,
 	}
 
@@ -12,10 +12,26 @@ type Response[T any] struct {
 	Code   int            `json:"code"`
 	Status string         `json:"status"`
 	Result T              `json:"result,omitempty"`
+	Page   *Page          `json:"page,omitempty"`
 	Error  *ErrorResponse `json:"error,omitempty"`
 }
 
 type ErrorResponse struct {
 	Stack   interface{} `json:"stack,omitempty"`
+	Code    ErrorCode   `json:"code,omitempty"`
 	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Stack is the debugging information attached to errors in local environments.
+type Stack struct {
+	Error string   `json:"error"`
+	Trace []string `json:"trace"`
+}
+
+// ConstraintDetails names the database constraint a request violated.
+type ConstraintDetails struct {
+	Constraint string `json:"constraint,omitempty"`
+	Table      string `json:"table,omitempty"`
+	Column     string `json:"column,omitempty"`
 }
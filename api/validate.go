@@ -0,0 +1,310 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator is implemented by request types with checks that do not fit in struct tags.
+// Validate is called after the tags passed; return FieldErrors.Err() to report fields.
+type Validator interface {
+	Validate() error
+}
+
+// Enum is implemented by string enums (work order status, notification channel, ...).
+// Non-zero Enum fields are always checked, no tag needed.
+type Enum interface {
+	Valid() bool
+}
+
+// FieldErrors collects field-level validation errors.
+type FieldErrors []FieldError
+
+// Add records that field was rejected.
+func (fe *FieldErrors) Add(field, format string, args ...any) {
+	*fe = append(*fe, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns fe as an error, or nil when it is empty.
+func (fe FieldErrors) Err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+func (fe FieldErrors) Error() string {
+	msgs := make([]string, len(fe))
+	for i, f := range fe {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks v against its `validate` struct tags, its Enum fields and its
+// Validate methods, and returns a 422 *DomainError listing every rejected field.
+//
+// Supported rules, comma separated:
+//
+//	required     the field must be non-zero (non-nil for pointers)
+//	email        a bare email address, or "" to clear an optional one
+//	url          an absolute http(s) URL, or "" to clear an optional one
+//	oneof=a b c  one of the space separated values
+//	min=n max=n  length for strings and slices, value for numbers
+//
+// Nil pointers and zero values other than numbers skip every rule but required. Fields are reported by
+// their JSON name, nested as "items[0].name".
+func Validate(v any) error {
+	var fe FieldErrors
+	if err := validateValue(reflect.ValueOf(v), "", &fe); err != nil {
+		return err
+	}
+	if len(fe) > 0 {
+		return Validation("request validation failed", fe...)
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, fe *FieldErrors) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return validateStruct(v, path, fe)
+	case reflect.Slice, reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.Struct, reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Array:
+		default:
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fe); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, path string, fe *FieldErrors) error {
+	t := v.Type()
+	before := len(*fe)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		fieldPath := name
+		switch {
+		case f.Anonymous && f.Tag.Get("json") == "":
+			// Embedded structs are flattened by encoding/json.
+			fieldPath = path
+		case path != "":
+			fieldPath = path + "." + name
+		}
+
+		fv := v.Field(i)
+		validateField(fv, f.Tag.Get("validate"), fieldPath, fe)
+
+		if err := validateValue(fv, fieldPath, fe); err != nil {
+			return err
+		}
+	}
+
+	// Cross-field checks only run once the fields themselves are valid.
+	if len(*fe) > before {
+		return nil
+	}
+	return runValidator(v, path, fe)
+}
+
+func runValidator(v reflect.Value, path string, fe *FieldErrors) error {
+	var validator Validator
+	switch {
+	case v.CanAddr() && v.Addr().Type().Implements(reflect.TypeFor[Validator]()):
+		validator = v.Addr().Interface().(Validator)
+	case v.Type().Implements(reflect.TypeFor[Validator]()):
+		validator = v.Interface().(Validator)
+	default:
+		return nil
+	}
+
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		for _, f := range fieldErrs {
+			if path != "" {
+				f.Field = path + "." + f.Field
+			}
+			*fe = append(*fe, f)
+		}
+		return nil
+	}
+
+	var domainErr *DomainError
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+
+	*fe = append(*fe, FieldError{Field: path, Message: err.Error()})
+	return nil
+}
+
+func validateField(v reflect.Value, tag, path string, fe *FieldErrors) {
+	rules := strings.Split(tag, ",")
+	if tag == "" {
+		rules = nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if hasRule(rules, "required") {
+				fe.Add(path, "is required")
+			}
+			return
+		}
+		v = v.Elem()
+	} else if v.IsZero() {
+		if hasRule(rules, "required") {
+			fe.Add(path, "is required")
+			return
+		}
+		if !isNumber(v.Kind()) {
+			return
+		}
+	}
+
+	if e, ok := v.Interface().(Enum); ok && !e.Valid() {
+		fe.Add(path, "is not a valid value")
+		return
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if msg := checkRule(v, name, arg); msg != "" {
+			fe.Add(path, "%s", msg)
+			return
+		}
+	}
+}
+
+// checkRule returns why v breaks the rule, or "" when it holds.
+func checkRule(v reflect.Value, rule, arg string) string {
+	switch rule {
+	case "", "required":
+		return ""
+	case "email":
+		s := v.String()
+		if s == "" {
+			// Only reached through a pointer: an empty email clears the stored one.
+			return ""
+		}
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+	case "url":
+		if v.String() == "" {
+			// Like email: an empty URL clears the stored one.
+			return ""
+		}
+		u, err := url.ParseRequestURI(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a valid http(s) URL"
+		}
+	case "oneof":
+		values := strings.Fields(arg)
+		s := fmt.Sprint(v.Interface())
+		for _, value := range values {
+			if s == value {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(values, ", ")
+	case "min", "max":
+		return checkBound(v, rule, arg)
+	default:
+		panic(fmt.Sprintf("api: unknown validation rule %q", rule))
+	}
+	return ""
+}
+
+func checkBound(v reflect.Value, rule, arg string) string {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("api: invalid %s=%q", rule, arg))
+	}
+
+	var n float64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic(fmt.Sprintf("api: %s does not apply to %s", rule, v.Kind()))
+	}
+
+	if rule == "min" && n < limit {
+		return fmt.Sprintf("must be at least %s%s", arg, unit)
+	}
+	if rule == "max" && n > limit {
+		return fmt.Sprintf("must be at most %s%s", arg, unit)
+	}
+	return ""
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasRule(rules []string, rule string) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type color string
+
+func (c color) Valid() bool { return c == "red" || c == "blue" }
+
+type tagged struct {
+	Name    string   `json:"name" validate:"required,max=5"`
+	Nick    *string  `json:"nick,omitempty" validate:"required,min=2"`
+	Email   *string  `json:"email,omitempty" validate:"email,max=254"`
+	Site    *string  `json:"site,omitempty" validate:"url"`
+	Kind    string   `json:"kind,omitempty" validate:"oneof=car truck"`
+	Qty     int      `json:"qty" validate:"min=1,max=10"`
+	Rate    *float64 `json:"rate,omitempty" validate:"max=100"`
+	Tags    []string `json:"tags,omitempty" validate:"max=2"`
+	Color   color    `json:"color,omitempty"`
+	Skipped string   `json:"-" validate:"required"`
+}
+
+// validTagged passes every rule; tests break one at a time.
+func validTagged() tagged {
+	return tagged{Name: "Ana", Nick: ptrTo("an"), Qty: 1}
+}
+
+func ptrTo[T any](v T) *T { return &v }
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(*tagged)
+		field string // "" when valid
+		msg   string
+	}{
+		{"valid", func(v *tagged) {}, "", ""},
+		{"required string", func(v *tagged) { v.Name = "" }, "name", "is required"},
+		{"required pointer", func(v *tagged) { v.Nick = nil }, "nick", "is required"},
+		{"required pointer may be empty, other rules still apply", func(v *tagged) { v.Nick = ptrTo("") }, "nick", "must be at least 2 characters"},
+		{"max counts characters, not bytes", func(v *tagged) { v.Name = "Ñandú" }, "", ""},
+		{"max", func(v *tagged) { v.Name = "Ángela" }, "name", "must be at most 5 characters"},
+		{"email", func(v *tagged) { v.Email = ptrTo("ana@example.com") }, "", ""},
+		{"email with a display name", func(v *tagged) { v.Email = ptrTo("Ana <ana@example.com>") }, "email", "must be a valid email address"},
+		{"not an email", func(v *tagged) { v.Email = ptrTo("ana") }, "email", "must be a valid email address"},
+		{"empty email clears it", func(v *tagged) { v.Email = ptrTo("") }, "", ""},
+		{"url", func(v *tagged) { v.Site = ptrTo("https://example.com/logo.png") }, "", ""},
+		{"relative url", func(v *tagged) { v.Site = ptrTo("/logo.png") }, "site", "must be a valid http(s) URL"},
+		{"other scheme", func(v *tagged) { v.Site = ptrTo("javascript:alert(1)") }, "site", "must be a valid http(s) URL"},
+		{"empty url clears it", func(v *tagged) { v.Site = ptrTo("") }, "", ""},
+		{"oneof", func(v *tagged) { v.Kind = "truck" }, "", ""},
+		{"not oneof", func(v *tagged) { v.Kind = "bike" }, "kind", "must be one of: car, truck"},
+		{"zero number is checked", func(v *tagged) { v.Qty = 0 }, "qty", "must be at least 1"},
+		{"number above max", func(v *tagged) { v.Qty = 11 }, "qty", "must be at most 10"},
+		{"pointer number", func(v *tagged) { v.Rate = ptrTo(100.5) }, "rate", "must be at most 100"},
+		{"too many items", func(v *tagged) { v.Tags = []string{"a", "b", "c"} }, "tags", "must be at most 2 items"},
+		{"enum", func(v *tagged) { v.Color = "blue" }, "", ""},
+		{"invalid enum, no tag needed", func(v *tagged) { v.Color = "green" }, "color", "is not a valid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validTagged()
+			tt.edit(&v)
+			fields := validationFields(t, Validate(&v))
+			switch {
+			case tt.field == "" && len(fields) > 0:
+				t.Fatalf("rejected %+v", fields)
+			case tt.field != "" && (len(fields) != 1 || fields[0].Field != tt.field || fields[0].Message != tt.msg):
+				t.Fatalf("rejected %+v, want %s %q", fields, tt.field, tt.msg)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	v := tagged{Qty: 0, Kind: "bike"}
+	fields := validationFields(t, Validate(&v))
+	var got []string
+	for _, f := range fields {
+		got = append(got, f.Field)
+	}
+	if strings.Join(got, ",") != "name,nick,kind,qty" {
+		t.Fatalf("rejected %v, want name, nick, kind and qty in field order", got)
+	}
+}
+
+func TestValidateUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("an unknown rule did not panic")
+		}
+	}()
+	_ = Validate(&struct {
+		Name string `json:"name" validate:"uppercase"`
+	}{Name: "x"})
+}
+
+// booking checks its dates with a Validator and counts the calls.
+type booking struct {
+	Start int            `json:"start" validate:"min=0"`
+	End   int            `json:"end"`
+	Lines []*bookingLine `json:"lines,omitempty"`
+	Embedded
+	calls *int
+}
+
+type Embedded struct {
+	Note string `json:"note,omitempty" validate:"max=3"`
+}
+
+func (b booking) Validate() error {
+	*b.calls++
+	var fe FieldErrors
+	if b.End < b.Start {
+		fe.Add("end", "must be after start")
+	}
+	return fe.Err()
+}
+
+type bookingLine struct {
+	Qty  int    `json:"qty" validate:"min=1"`
+	Fail string `json:"fail,omitempty"`
+}
+
+func (l *bookingLine) Validate() error {
+	switch l.Fail {
+	case "domain":
+		return Conflict("line is locked")
+	case "plain":
+		return errors.New("is inconsistent")
+	}
+	return nil
+}
+
+func TestValidatorOrdering(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      booking
+		calls  int
+		fields []FieldError
+		status int // of a DomainError returned as is
+	}{
+		{"runs after the tags passed", booking{Start: 1, End: 2}, 1, nil, 0},
+		{"reports its fields", booking{Start: 2, End: 1}, 1, []FieldError{{"end", "must be after start"}}, 0},
+		{"skipped when a tag failed", booking{Start: -1, End: -2}, 0, []FieldError{{"start", "must be at least 0"}}, 0},
+		{"skipped when a nested tag failed", booking{End: 1, Lines: []*bookingLine{{Qty: 0}}}, 0,
+			[]FieldError{{"lines[0].qty", "must be at least 1"}}, 0},
+		{"skipped when an embedded tag failed", booking{End: 1, Embedded: Embedded{Note: "long"}}, 0,
+			[]FieldError{{"note", "must be at most 3 characters"}}, 0},
+		{"nested errors are prefixed", booking{End: 1, Lines: []*bookingLine{{Qty: 1}, {Qty: 1, Fail: "plain"}}}, 0,
+			[]FieldError{{"lines[1]", "is inconsistent"}}, 0},
+		{"nested domain errors are returned as is", booking{End: 1, Lines: []*bookingLine{{Qty: 1, Fail: "domain"}}}, 0,
+			nil, 409},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			tt.b.calls = &calls
+			err := Validate(&tt.b)
+
+			if calls != tt.calls {
+				t.Fatalf("Validate called %d times, want %d", calls, tt.calls)
+			}
+			if tt.status != 0 {
+				var de *DomainError
+				if !errors.As(err, &de) || de.Status != tt.status {
+					t.Fatalf("error = %v, want a %d", err, tt.status)
+				}
+				return
+			}
+			fields := validationFields(t, err)
+			if len(fields) != len(tt.fields) {
+				t.Fatalf("rejected %+v, want %+v", fields, tt.fields)
+			}
+			for i := range fields {
+				if fields[i] != tt.fields[i] {
+					t.Fatalf("rejected %+v, want %+v", fields, tt.fields)
+				}
+			}
+		})
+	}
+}
+
+// validationFields returns the fields of a 422 from Validate, nil for no error.
+func validationFields(t *testing.T, err error) []FieldError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var de *DomainError
+	if !errors.As(err, &de) || de.Code != CodeValidation {
+		t.Fatalf("Validate error = %v, want a validation error", err)
+	}
+	fields, _ := de.Details.([]FieldError)
+	return fields
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// migrationLockID is the key of the Postgres advisory lock guarding migrations.
+const migrationLockID int64 = 0x656e67696e65 // "engine"
+
+// withLock runs fn while holding a session-level advisory lock, so two
+// migrators starting at once (e.g. two pods) run one after the other instead
+// of racing. Unlike bun's table-based lock, the advisory lock is released by
+// Postgres if the process dies, so a crashed pod never leaves it stuck.
+func withLock(ctx context.Context, db *bun.DB, timeout time.Duration, fn func() error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	lockCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = conn.ExecContext(lockCtx, "SELECT pg_advisory_lock(?)", migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	defer func() {
+		// The request context may already be done; always try to release.
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(?)", migrationLockID)
+	}()
+
+	return fn()
+}
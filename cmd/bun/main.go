@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/brxyxn/engine-care-api/cmd/bun/migrations"
+	"github.com/brxyxn/engine-care-api/config"
+)
+
+const usage = `Usage: bun [flags] <command> [args]
+
+Commands:
+  init             create the migration tables
+  migrate          apply every pending migration
+  rollback         roll back the last migration group
+  status           print applied and pending migrations
+  create <name>    create up/down SQL migration files (-tx=false for non-transactional ones)
+
+Flags:
+`
+
+func main() {
+	lockTimeout := flag.Duration("lock-timeout", 2*time.Minute, "how long to wait for the migration lock")
+	tx := flag.Bool("tx", true, "create transactional migration files (create only)")
+	flag.Usage = func() {
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	opts := []logger.OptsFunc{
+		func(o *logger.Opts) {
+			o.Level = cfg.LoggerLevel
+		},
+	}
+
+	log := logger.NewLogger(opts...)
+
+	ctx := context.Background()
+
+	db := configDB(log, cfg)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	migrator := migrate.NewMigrator(db, migrations.Migrations)
+
+	cmd := commands{
+		log:         log,
+		db:          db,
+		migrator:    migrator,
+		lockTimeout: *lockTimeout,
+		tx:          *tx,
+	}
+
+	err = cmd.run(ctx, flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		log.Fatal().
+			Str("command", flag.Arg(0)).
+			Err(err).
+			Msg("migration command failed")
+	}
+}
+
+func configDB(log *logger.Logger, conf config.Config) *bun.DB {
+	pgdb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(conf.Dsn)))
+
+	db := bun.NewDB(pgdb, pgdialect.New())
+
+	err := db.Ping()
+	if err != nil {
+		log.Fatal().
+			Str("stage", "db").
+			Err(err).
+			Msg("failed to ping database")
+	}
+
+	return db
+}
+
+type commands struct {
+	log         *logger.Logger
+	db          *bun.DB
+	migrator    *migrate.Migrator
+	lockTimeout time.Duration
+	tx          bool
+}
+
+func (c commands) run(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "init":
+		return c.initTables(ctx)
+	case "migrate":
+		return c.migrate(ctx)
+	case "rollback":
+		return c.rollback(ctx)
+	case "status":
+		return c.status(ctx)
+	case "create":
+		return c.create(ctx, args)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// initTables creates the bun_migrations and bun_migration_locks tables.
+func (c commands) initTables(ctx context.Context) error {
+	return withLock(ctx, c.db, c.lockTimeout, func() error {
+		return c.migrator.Init(ctx)
+	})
+}
+
+// migrate applies every pending migration as a single group.
+func (c commands) migrate(ctx context.Context) error {
+	return withLock(ctx, c.db, c.lockTimeout, func() error {
+		err := c.migrator.Init(ctx)
+		if err != nil {
+			return err
+		}
+
+		group, err := c.migrator.Migrate(ctx)
+		if err != nil {
+			return err
+		}
+
+		if group.IsZero() {
+			c.log.Info().Msg("there are no new migrations to run, database is up to date")
+			return nil
+		}
+
+		c.log.Info().Str("group", group.String()).Msg("migrated")
+		return nil
+	})
+}
+
+// rollback rolls back the most recently applied migration group.
+func (c commands) rollback(ctx context.Context) error {
+	return withLock(ctx, c.db, c.lockTimeout, func() error {
+		group, err := c.migrator.Rollback(ctx)
+		if err != nil {
+			return err
+		}
+
+		if group.IsZero() {
+			c.log.Info().Msg("there are no groups to roll back")
+			return nil
+		}
+
+		c.log.Info().Str("group", group.String()).Msg("rolled back")
+		return nil
+	})
+}
+
+// status prints every known migration along with the group it was applied in.
+func (c commands) status(ctx context.Context) error {
+	ms, err := c.migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		state := "pending"
+		if m.IsApplied() {
+			state = fmt.Sprintf("applied (group #%d, %s)", m.GroupID, m.MigratedAt.Format(time.RFC3339))
+		}
+		fmt.Printf("%s_%s\t%s\n", m.Name, m.Comment, state)
+	}
+
+	c.log.Info().
+		Str("applied", ms.Applied().String()).
+		Str("pending", ms.Unapplied().String()).
+		Str("last_group", ms.LastGroup().String()).
+		Msg("migration status")
+
+	return nil
+}
+
+// create writes a new pair of up/down SQL files into the migrations directory.
+func (c commands) create(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("create: migration name is required")
+	}
+	name := strings.Join(args, "_")
+
+	var (
+		files []*migrate.MigrationFile
+		err   error
+	)
+	if c.tx {
+		files, err = c.migrator.CreateTxSQLMigrations(ctx, name)
+	} else {
+		files, err = c.migrator.CreateSQLMigrations(ctx, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		c.log.Info().Str("name", f.Name).Str("path", f.Path).Msg("created migration")
+	}
+
+	return nil
+}
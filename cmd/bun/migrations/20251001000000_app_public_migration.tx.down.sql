@@ -14,6 +14,16 @@ DROP TABLE IF EXISTS app.user_phone_numbers;
 DROP TABLE IF EXISTS app.users;
 DROP TABLE IF EXISTS public.phone_numbers;
 
+DROP FUNCTION IF EXISTS app.enforce_same_org_appointment_link();
+DROP FUNCTION IF EXISTS app.work_orders_status_event_trg();
+DROP FUNCTION IF EXISTS app.work_order_items_recalc_trg();
+DROP FUNCTION IF EXISTS app.recalc_work_order_totals(uuid);
+DROP FUNCTION IF EXISTS app.sync_child_org_from_work_order();
+DROP FUNCTION IF EXISTS app.has_org_role(uuid, text[]);
+DROP FUNCTION IF EXISTS app.is_org_member(uuid);
+DROP FUNCTION IF EXISTS app.current_org_id();
+DROP FUNCTION IF EXISTS app.current_user_id();
+
 DROP TYPE IF EXISTS app.org_role;
 DROP TYPE IF EXISTS app.work_order_status;
 DROP TYPE IF EXISTS app.work_order_priority;
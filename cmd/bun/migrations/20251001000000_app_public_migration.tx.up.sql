@@ -297,8 +297,12 @@ SET search_path = public, app;
 --   SET search_path = public, app;
 
 -- C) Per-database (affects all roles unless overridden):
-ALTER DATABASE engine_care
-    SET search_path = public, app;
+DO
+$$
+    BEGIN
+        EXECUTE format('ALTER DATABASE %I SET search_path = public, app', current_database());
+    END
+$$;
 
 
 -- =========
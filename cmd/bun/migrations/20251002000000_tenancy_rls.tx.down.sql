@@ -0,0 +1,41 @@
+DROP POLICY IF EXISTS veh_delete ON public.vehicles;
+DROP POLICY IF EXISTS veh_update ON public.vehicles;
+DROP POLICY IF EXISTS veh_insert ON public.vehicles;
+DROP POLICY IF EXISTS veh_select ON public.vehicles;
+
+DROP POLICY IF EXISTS cust_delete ON public.customers;
+DROP POLICY IF EXISTS cust_update ON public.customers;
+DROP POLICY IF EXISTS cust_insert ON public.customers;
+DROP POLICY IF EXISTS cust_select ON public.customers;
+
+DROP POLICY IF EXISTS proj_delete ON app.projects;
+DROP POLICY IF EXISTS proj_update ON app.projects;
+DROP POLICY IF EXISTS proj_insert ON app.projects;
+DROP POLICY IF EXISTS proj_select ON app.projects;
+
+DROP POLICY IF EXISTS wo_select ON app.work_orders;
+
+CREATE OR REPLACE FUNCTION app.is_org_member(org uuid)
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY INVOKER AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id());
+$$;
+
+CREATE OR REPLACE FUNCTION app.has_org_role(org uuid, roles text[])
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY INVOKER AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id()
+                 AND m.role::text = ANY (roles));
+$$;
@@ -0,0 +1,137 @@
+-- =========================
+-- Tenancy: row-level security for every organization_id column
+-- =========================
+-- Requests scoped by middleware.Tenancy run inside a transaction with
+--   set_config('app.user_id', ..., true) and set_config('app.organization_id', ..., true)
+-- so app.current_user_id()/app.current_org_id() resolve to the caller and the X-Org-Id org.
+--
+-- Note: table owners bypass RLS; the API must connect with a role that does not own these tables
+-- for the policies below to apply.
+
+-- The membership helpers are used inside the organization_members policies themselves;
+-- run them as the definer so evaluating a policy does not recurse into the same policy.
+CREATE OR REPLACE FUNCTION app.is_org_member(org uuid)
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM app.organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id());
+$$;
+
+CREATE OR REPLACE FUNCTION app.has_org_role(org uuid, roles text[])
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM app.organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id()
+                 AND m.role::text = ANY (roles));
+$$;
+
+-- Work orders had write policies only.
+DROP POLICY IF EXISTS wo_select ON app.work_orders;
+CREATE POLICY wo_select ON app.work_orders
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+
+-- Projects
+DROP POLICY IF EXISTS proj_select ON app.projects;
+CREATE POLICY proj_select ON app.projects
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+DROP POLICY IF EXISTS proj_insert ON app.projects;
+CREATE POLICY proj_insert ON app.projects
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+DROP POLICY IF EXISTS proj_update ON app.projects;
+CREATE POLICY proj_update ON app.projects
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+DROP POLICY IF EXISTS proj_delete ON app.projects;
+CREATE POLICY proj_delete ON app.projects
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+
+-- Customers
+DROP POLICY IF EXISTS cust_select ON public.customers;
+CREATE POLICY cust_select ON public.customers
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+DROP POLICY IF EXISTS cust_insert ON public.customers;
+CREATE POLICY cust_insert ON public.customers
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+DROP POLICY IF EXISTS cust_update ON public.customers;
+CREATE POLICY cust_update ON public.customers
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+DROP POLICY IF EXISTS cust_delete ON public.customers;
+CREATE POLICY cust_delete ON public.customers
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+
+-- Vehicles
+DROP POLICY IF EXISTS veh_select ON public.vehicles;
+CREATE POLICY veh_select ON public.vehicles
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+DROP POLICY IF EXISTS veh_insert ON public.vehicles;
+CREATE POLICY veh_insert ON public.vehicles
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+DROP POLICY IF EXISTS veh_update ON public.vehicles;
+CREATE POLICY veh_update ON public.vehicles
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+DROP POLICY IF EXISTS veh_delete ON public.vehicles;
+CREATE POLICY veh_delete ON public.vehicles
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
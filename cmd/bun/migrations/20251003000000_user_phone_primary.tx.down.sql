@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS app.idx_user_phone_numbers_primary;
+
+ALTER TABLE app.user_phone_numbers
+    ADD CONSTRAINT user_phone_numbers_user_id_is_primary_key UNIQUE (user_id, is_primary);
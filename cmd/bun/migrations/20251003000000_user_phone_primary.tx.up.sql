@@ -0,0 +1,8 @@
+-- UNIQUE (user_id, is_primary) only allowed one primary and one non-primary number per user.
+-- Keep "at most one primary" with a partial unique index instead; the service keeps exactly one.
+ALTER TABLE app.user_phone_numbers
+    DROP CONSTRAINT IF EXISTS user_phone_numbers_user_id_is_primary_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_phone_numbers_primary
+    ON app.user_phone_numbers (user_id)
+    WHERE is_primary;
@@ -0,0 +1,2 @@
+ALTER TABLE public.phone_numbers
+    DROP COLUMN IF EXISTS line_type;
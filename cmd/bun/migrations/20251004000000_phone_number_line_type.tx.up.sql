@@ -0,0 +1,4 @@
+-- Numbers are parsed and classified by internal/phonenumbers before they are stored.
+ALTER TABLE public.phone_numbers
+    ADD COLUMN IF NOT EXISTS line_type TEXT NOT NULL DEFAULT 'unknown'
+        CHECK (line_type IN ('mobile', 'fixed_line', 'fixed_line_or_mobile', 'unknown'));
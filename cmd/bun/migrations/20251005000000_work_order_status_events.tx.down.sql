@@ -0,0 +1,22 @@
+CREATE OR REPLACE FUNCTION app.work_orders_status_event_trg()
+    RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO app.work_order_events (id, organization_id, work_order_id, event_type, from_status, to_status,
+                                           message, created_by)
+        VALUES (gen_random_uuid(), OLD.organization_id, NEW.id, 'status_changed', OLD.status, NEW.status,
+                format('Status changed %s → %s', OLD.status, NEW.status),
+                NEW.updated_by);
+    END IF;
+    RETURN NEW;
+END
+$$;
+
+DROP TRIGGER IF EXISTS trg_wo_status_event ON app.work_orders;
+CREATE TRIGGER trg_wo_status_event
+    AFTER UPDATE
+    ON app.work_orders
+    FOR EACH ROW
+EXECUTE FUNCTION app.work_orders_status_event_trg();
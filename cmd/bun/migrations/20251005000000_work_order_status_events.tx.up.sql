@@ -0,0 +1,5 @@
+-- Status changes go through the work order state machine (internal/workorders), which
+-- writes the status_changed event with the caller's message in the same transaction.
+-- The trigger would log every change a second time.
+DROP TRIGGER IF EXISTS trg_wo_status_event ON app.work_orders;
+DROP FUNCTION IF EXISTS app.work_orders_status_event_trg();
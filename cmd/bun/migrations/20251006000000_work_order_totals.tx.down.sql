@@ -0,0 +1,62 @@
+DROP INDEX IF EXISTS app.idx_items_work_order_position;
+
+ALTER TABLE app.work_order_items
+    DROP CONSTRAINT IF EXISTS work_order_items_qty_positive,
+    DROP CONSTRAINT IF EXISTS work_order_items_price_non_negative,
+    DROP CONSTRAINT IF EXISTS work_order_items_tax_rate_range;
+
+CREATE OR REPLACE FUNCTION app.recalc_work_order_totals(p_work_order_id uuid)
+    RETURNS void
+    LANGUAGE plpgsql AS
+$$
+DECLARE
+    v_subtotal BIGINT := 0;
+    v_tax      BIGINT := 0;
+    v_total    BIGINT := 0;
+BEGIN
+    SELECT COALESCE(SUM((unit_price_cents * qty)::bigint), 0),
+           COALESCE(SUM(((unit_price_cents * qty) * (tax_rate_pct / 100.0))::bigint), 0)
+    INTO v_subtotal, v_tax
+    FROM app.work_order_items
+    WHERE work_order_id = p_work_order_id;
+
+    v_total := v_subtotal + v_tax;
+
+    UPDATE app.work_orders
+    SET subtotal_cents = v_subtotal,
+        tax_cents      = v_tax,
+        total_cents    = v_total,
+        updated_at     = now()
+    WHERE id = p_work_order_id;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION app.work_order_items_recalc_trg()
+    RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    PERFORM app.recalc_work_order_totals(
+            NEW.work_order_id
+            );
+    RETURN COALESCE(NEW, OLD);
+END
+$$;
+
+CREATE TRIGGER trg_items_recalc_ins
+    AFTER INSERT
+    ON app.work_order_items
+    FOR EACH ROW
+EXECUTE FUNCTION app.work_order_items_recalc_trg();
+
+CREATE TRIGGER trg_items_recalc_upd
+    AFTER UPDATE
+    ON app.work_order_items
+    FOR EACH ROW
+EXECUTE FUNCTION app.work_order_items_recalc_trg();
+
+CREATE TRIGGER trg_items_recalc_del
+    AFTER DELETE
+    ON app.work_order_items
+    FOR EACH ROW
+EXECUTE FUNCTION app.work_order_items_recalc_trg();
@@ -0,0 +1,15 @@
+-- Work order totals are computed by the totals engine in internal/workorders, in the
+-- same transaction as the item change, with per-line half-up rounding. The triggers
+-- below rounded differently and would overwrite its results.
+DROP TRIGGER IF EXISTS trg_items_recalc_ins ON app.work_order_items;
+DROP TRIGGER IF EXISTS trg_items_recalc_upd ON app.work_order_items;
+DROP TRIGGER IF EXISTS trg_items_recalc_del ON app.work_order_items;
+DROP FUNCTION IF EXISTS app.work_order_items_recalc_trg();
+DROP FUNCTION IF EXISTS app.recalc_work_order_totals(uuid);
+
+ALTER TABLE app.work_order_items
+    ADD CONSTRAINT work_order_items_qty_positive CHECK (qty > 0),
+    ADD CONSTRAINT work_order_items_price_non_negative CHECK (unit_price_cents >= 0),
+    ADD CONSTRAINT work_order_items_tax_rate_range CHECK (tax_rate_pct BETWEEN 0 AND 100);
+
+CREATE INDEX IF NOT EXISTS idx_items_work_order_position ON app.work_order_items (work_order_id, position);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS app.invoices;
+DROP FUNCTION IF EXISTS app.invoices_immutable_trg();
+DROP TABLE IF EXISTS app.invoice_counters;
+
+ALTER TABLE app.organizations
+    DROP COLUMN IF EXISTS branding;
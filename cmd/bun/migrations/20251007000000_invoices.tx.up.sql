@@ -0,0 +1,83 @@
+-- =========================
+-- Invoices
+-- =========================
+-- An invoice is issued when a work order reaches 'completed'. It keeps a snapshot of
+-- the document (organization, customer, vehicle, lines and totals) so it reads the
+-- same forever, whatever happens to the rows it was built from.
+
+ALTER TABLE app.organizations
+    ADD COLUMN branding JSONB NOT NULL DEFAULT '{}';
+
+-- Last invoice number used by each organization. Numbers are taken with an upsert on
+-- this row, which serializes concurrent issuers and leaves no gaps on rollback.
+CREATE TABLE app.invoice_counters
+(
+    organization_id UUID PRIMARY KEY REFERENCES app.organizations (id) ON DELETE CASCADE,
+    last_number     BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE app.invoices
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    work_order_id   UUID        NOT NULL UNIQUE REFERENCES app.work_orders (id) ON DELETE RESTRICT,
+    number          BIGINT      NOT NULL,
+    issued_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    subtotal_cents  BIGINT      NOT NULL,
+    tax_cents       BIGINT      NOT NULL,
+    total_cents     BIGINT      NOT NULL,
+    document        JSONB       NOT NULL,
+    created_by      UUID        REFERENCES app.users (id) ON DELETE SET NULL,
+    UNIQUE (organization_id, number)
+);
+
+-- Issued invoices are immutable.
+CREATE OR REPLACE FUNCTION app.invoices_immutable_trg()
+    RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    RAISE EXCEPTION 'invoice % is issued and cannot be changed', OLD.number
+        USING ERRCODE = 'check_violation';
+END
+$$;
+
+CREATE TRIGGER trg_invoices_immutable
+    BEFORE UPDATE
+    ON app.invoices
+    FOR EACH ROW
+EXECUTE FUNCTION app.invoices_immutable_trg();
+
+ALTER TABLE app.invoice_counters
+    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.invoices
+    ENABLE ROW LEVEL SECURITY;
+
+-- Whoever may complete a work order (mechanics and up) issues its invoice.
+CREATE POLICY inv_counter_select ON app.invoice_counters
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY inv_counter_insert ON app.invoice_counters
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+CREATE POLICY inv_counter_update ON app.invoice_counters
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (organization_id = app.current_org_id());
+
+-- No update or delete policies: invoices are never changed once issued.
+CREATE POLICY inv_select ON app.invoices
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY inv_insert ON app.invoices
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
@@ -0,0 +1,49 @@
+-- =========================
+-- Estimates
+-- =========================
+-- Versioned snapshots of a work order's items sent to the customer for approval. The
+-- customer answers through a signed link; the decision (per line, with the approver's
+-- name, IP and time) is stored here and recorded as a work order event.
+
+CREATE TABLE app.estimates
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    work_order_id   UUID        NOT NULL REFERENCES app.work_orders (id) ON DELETE CASCADE,
+    version         INT         NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'partially_approved', 'declined', 'superseded')),
+    lines           JSONB       NOT NULL,
+    subtotal_cents  BIGINT      NOT NULL,
+    tax_cents       BIGINT      NOT NULL,
+    total_cents     BIGINT      NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_by      UUID        NOT NULL REFERENCES app.users (id) ON DELETE RESTRICT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    decided_at      TIMESTAMPTZ,
+    approver_name   TEXT,
+    approver_ip     TEXT,
+    UNIQUE (work_order_id, version)
+);
+CREATE INDEX idx_estimates_org ON app.estimates (organization_id);
+
+ALTER TABLE app.estimates
+    ENABLE ROW LEVEL SECURITY;
+
+-- Public decisions run as the member who sent the estimate.
+CREATE POLICY est_select ON app.estimates
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY est_insert ON app.estimates
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+CREATE POLICY est_update ON app.estimates
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (organization_id = app.current_org_id());
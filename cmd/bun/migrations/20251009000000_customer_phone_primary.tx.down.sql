@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS public.idx_customer_phone_numbers_primary;
+
+ALTER TABLE public.customer_phone_numbers
+    ADD CONSTRAINT customer_phone_numbers_customer_id_is_primary_key UNIQUE (customer_id, is_primary);
@@ -0,0 +1,8 @@
+-- UNIQUE (customer_id, is_primary) only allowed one primary and one non-primary number per customer.
+-- Keep "at most one primary" with a partial unique index instead; the service keeps exactly one.
+ALTER TABLE public.customer_phone_numbers
+    DROP CONSTRAINT IF EXISTS customer_phone_numbers_customer_id_is_primary_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customer_phone_numbers_primary
+    ON public.customer_phone_numbers (customer_id)
+    WHERE is_primary;
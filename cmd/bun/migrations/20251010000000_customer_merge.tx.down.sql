@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS app.customer_merges;
+
+DROP INDEX IF EXISTS public.idx_customers_name_trgm;
+DROP INDEX IF EXISTS public.idx_customers_email_normalized;
+
+DROP FUNCTION IF EXISTS app.normalize_email(TEXT);
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,49 @@
+-- =========================
+-- Customer duplicates & merges
+-- =========================
+-- Likely duplicates are customers of one organization sharing a normalized email or a
+-- phone number, or with similar names (pg_trgm). Merging one into another re-points
+-- everything to the surviving customer and leaves an audit row with a snapshot of the
+-- customer that was merged away.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Lowercased, trimmed and without "+tag" sub-addressing; NULL when empty.
+CREATE OR REPLACE FUNCTION app.normalize_email(email TEXT) RETURNS TEXT
+    LANGUAGE sql
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT nullif(regexp_replace(lower(btrim(email)), '\+[^@]*@', '@'), '')
+$$;
+
+CREATE INDEX idx_customers_email_normalized ON public.customers (organization_id, app.normalize_email(email));
+CREATE INDEX idx_customers_name_trgm ON public.customers USING GIN (lower(full_name) gin_trgm_ops);
+
+CREATE TABLE app.customer_merges
+(
+    id                 UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id    UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    target_customer_id UUID        REFERENCES public.customers (id) ON DELETE SET NULL,
+    source_customer_id UUID        NOT NULL, -- deleted by the merge
+    source             JSONB       NOT NULL,
+    moved              JSONB       NOT NULL DEFAULT '{}',
+    merged_by          UUID        REFERENCES app.users (id) ON DELETE SET NULL,
+    merged_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_customer_merges_org ON app.customer_merges (organization_id);
+CREATE INDEX idx_customer_merges_target ON app.customer_merges (target_customer_id);
+
+ALTER TABLE app.customer_merges
+    ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY cm_select ON app.customer_merges
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY cm_insert ON app.customer_merges
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
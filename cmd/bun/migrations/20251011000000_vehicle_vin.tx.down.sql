@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS public.idx_vehicles_plate_normalized;
+
+DROP FUNCTION IF EXISTS app.normalize_plate(TEXT);
+
+ALTER TABLE public.vehicles
+    DROP CONSTRAINT IF EXISTS vehicles_organization_id_vin_key;
+
+ALTER TABLE public.vehicles
+    ADD CONSTRAINT vehicles_organization_id_vin_key UNIQUE (organization_id, vin) DEFERRABLE INITIALLY DEFERRED;
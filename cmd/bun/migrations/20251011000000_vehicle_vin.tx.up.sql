@@ -0,0 +1,28 @@
+-- =========================
+-- Vehicle VINs & plate lookup
+-- =========================
+-- VINs are stored normalized (uppercase, no spaces or dashes) and checked for duplicates
+-- by the API, so the per-organization unique constraint no longer needs to be deferred:
+-- a deferred violation would only surface at commit time.
+
+ALTER TABLE public.vehicles
+    DROP CONSTRAINT IF EXISTS vehicles_organization_id_vin_key;
+
+UPDATE public.vehicles
+SET vin = nullif(upper(regexp_replace(vin, '[\s-]', '', 'g')), '')
+WHERE vin IS NOT NULL;
+
+ALTER TABLE public.vehicles
+    ADD CONSTRAINT vehicles_organization_id_vin_key UNIQUE (organization_id, vin);
+
+-- Uppercased, letters and digits only: "abc-123", "ABC 123" and "ABC123" are one plate.
+CREATE OR REPLACE FUNCTION app.normalize_plate(plate TEXT) RETURNS TEXT
+    LANGUAGE sql
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT nullif(upper(regexp_replace(plate, '[^[:alnum:]]', '', 'g')), '')
+$$;
+
+CREATE INDEX idx_vehicles_plate_normalized ON public.vehicles (organization_id, app.normalize_plate(plate_number));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.odometer_readings;
+
+DROP TYPE IF EXISTS app.odometer_reading_source;
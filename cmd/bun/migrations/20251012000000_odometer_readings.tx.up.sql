@@ -0,0 +1,46 @@
+-- =========================
+-- Odometer readings
+-- =========================
+-- vehicles.mileage_km is the latest trusted reading; every reading is also logged here,
+-- at work order check-in/check-out or by hand. A reading lower than the vehicle's
+-- mileage at the time is kept but flagged as decreased and does not replace it.
+
+CREATE TYPE app.odometer_reading_source AS ENUM ('check_in','check_out','manual');
+
+CREATE TABLE public.odometer_readings
+(
+    id              UUID PRIMARY KEY                     DEFAULT gen_random_uuid(),
+    organization_id UUID                        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    vehicle_id      UUID                        NOT NULL REFERENCES public.vehicles (id) ON DELETE CASCADE,
+    work_order_id   UUID                        REFERENCES app.work_orders (id) ON DELETE SET NULL,
+    source          app.odometer_reading_source NOT NULL,
+    mileage_km      INT                         NOT NULL CHECK (mileage_km >= 0),
+    previous_km     INT,
+    decreased       BOOLEAN                     NOT NULL DEFAULT false,
+    recorded_by     UUID                        REFERENCES app.users (id) ON DELETE SET NULL,
+    recorded_at     TIMESTAMPTZ                 NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_odometer_readings_vehicle ON public.odometer_readings (vehicle_id, recorded_at);
+CREATE INDEX idx_odometer_readings_work_order ON public.odometer_readings (work_order_id);
+CREATE INDEX idx_odometer_readings_decreased ON public.odometer_readings (organization_id) WHERE decreased;
+
+-- The mileage vehicles already have becomes their first reading.
+INSERT INTO public.odometer_readings (organization_id, vehicle_id, source, mileage_km, recorded_at)
+SELECT organization_id, id, 'manual', mileage_km, updated_at
+FROM public.vehicles
+WHERE mileage_km IS NOT NULL
+  AND mileage_km >= 0;
+
+ALTER TABLE public.odometer_readings
+    ENABLE ROW LEVEL SECURITY;
+
+-- Readings are a log: they are added, never changed.
+CREATE POLICY odo_select ON public.odometer_readings
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY odo_insert ON public.odometer_readings
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS app.idx_notifications_queued;
+
+UPDATE app.notification_logs
+SET sent_at = queued_at
+WHERE sent_at IS NULL;
+ALTER TABLE app.notification_logs
+    ALTER COLUMN sent_at SET DEFAULT now(),
+    ALTER COLUMN sent_at SET NOT NULL,
+    DROP COLUMN IF EXISTS queued_at,
+    DROP COLUMN IF EXISTS status;
+
+DROP TYPE IF EXISTS app.notify_status;
+
+DROP INDEX IF EXISTS app.idx_work_orders_vehicle_completed;
+
+DROP TABLE IF EXISTS app.vehicle_maintenance_plans;
+DROP TABLE IF EXISTS app.maintenance_plans;
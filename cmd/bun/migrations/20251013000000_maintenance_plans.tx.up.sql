@@ -0,0 +1,113 @@
+-- =========================
+-- Maintenance plans & reminders
+-- =========================
+-- A plan is a service repeated every interval_km and/or interval_months. Vehicles are
+-- put on plans; the next due date is computed from the latest completed work order
+-- with a matching item and the odometer readings. Reminders are queued in
+-- notification_logs for a sender to deliver.
+
+CREATE TABLE app.maintenance_plans
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    name            TEXT        NOT NULL,
+    description     TEXT,
+    interval_km     INT CHECK (interval_km > 0),
+    interval_months INT CHECK (interval_months > 0),
+    match_terms     TEXT[]      NOT NULL CHECK (cardinality(match_terms) > 0),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (interval_km IS NOT NULL OR interval_months IS NOT NULL)
+);
+CREATE INDEX idx_maintenance_plans_org ON app.maintenance_plans (organization_id);
+
+CREATE TABLE app.vehicle_maintenance_plans
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    vehicle_id      UUID        NOT NULL REFERENCES public.vehicles (id) ON DELETE CASCADE,
+    plan_id         UUID        NOT NULL REFERENCES app.maintenance_plans (id) ON DELETE CASCADE,
+    last_service_at TIMESTAMPTZ NOT NULL, -- baseline until a matching work order completes
+    last_service_km INT CHECK (last_service_km >= 0),
+    reminded_at     TIMESTAMPTZ,
+    created_by      UUID        REFERENCES app.users (id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (vehicle_id, plan_id)
+);
+CREATE INDEX idx_vehicle_maintenance_plans_org ON app.vehicle_maintenance_plans (organization_id);
+CREATE INDEX idx_vehicle_maintenance_plans_plan ON app.vehicle_maintenance_plans (plan_id);
+
+CREATE INDEX idx_work_orders_vehicle_completed ON app.work_orders (vehicle_id, completed_at DESC)
+    WHERE status = 'completed';
+
+ALTER TABLE app.maintenance_plans
+    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.vehicle_maintenance_plans
+    ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY mp_select ON app.maintenance_plans
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY mp_insert ON app.maintenance_plans
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+CREATE POLICY mp_update ON app.maintenance_plans
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+CREATE POLICY mp_delete ON app.maintenance_plans
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
+
+CREATE POLICY vmp_select ON app.vehicle_maintenance_plans
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY vmp_insert ON app.vehicle_maintenance_plans
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+CREATE POLICY vmp_update ON app.vehicle_maintenance_plans
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+CREATE POLICY vmp_delete ON app.vehicle_maintenance_plans
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+
+-- Notifications can now wait in a queue: sent_at is set once delivered.
+CREATE TYPE app.notify_status AS ENUM ('queued','sent','failed');
+
+ALTER TABLE app.notification_logs
+    ADD COLUMN status    app.notify_status NOT NULL DEFAULT 'sent',
+    ADD COLUMN queued_at TIMESTAMPTZ;
+UPDATE app.notification_logs
+SET queued_at = sent_at;
+ALTER TABLE app.notification_logs
+    ALTER COLUMN queued_at SET NOT NULL,
+    ALTER COLUMN queued_at SET DEFAULT now(),
+    ALTER COLUMN sent_at DROP NOT NULL,
+    ALTER COLUMN sent_at DROP DEFAULT;
+CREATE INDEX idx_notifications_queued ON app.notification_logs (queued_at) WHERE status = 'queued';
@@ -0,0 +1,52 @@
+-- =========================
+-- Vehicle ownership history
+-- =========================
+-- vehicles.customer_id is the current owner; every period a customer owned the vehicle
+-- is kept here. Work orders and appointments keep their own customer_id, the owner at
+-- the time, when a vehicle is transferred.
+
+CREATE TABLE public.vehicle_ownerships
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    vehicle_id      UUID        NOT NULL REFERENCES public.vehicles (id) ON DELETE CASCADE,
+    customer_id     UUID        NOT NULL REFERENCES public.customers (id) ON DELETE CASCADE,
+    started_at      TIMESTAMPTZ NOT NULL,
+    ended_at        TIMESTAMPTZ,
+    notes           TEXT,
+    created_by      UUID        REFERENCES app.users (id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ended_at IS NULL OR ended_at > started_at)
+);
+CREATE INDEX idx_vehicle_ownerships_vehicle ON public.vehicle_ownerships (vehicle_id, started_at);
+CREATE INDEX idx_vehicle_ownerships_customer ON public.vehicle_ownerships (customer_id);
+-- One current owner per vehicle.
+CREATE UNIQUE INDEX idx_vehicle_ownerships_current ON public.vehicle_ownerships (vehicle_id) WHERE ended_at IS NULL;
+
+-- Existing vehicles have been owned by their customer since they were added.
+INSERT INTO public.vehicle_ownerships (organization_id, vehicle_id, customer_id, started_at)
+SELECT organization_id, id, customer_id, created_at
+FROM public.vehicles;
+
+ALTER TABLE public.vehicle_ownerships
+    ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY vo_select ON public.vehicle_ownerships
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY vo_insert ON public.vehicle_ownerships
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
+CREATE POLICY vo_update ON public.vehicle_ownerships
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager','mechanic'])
+    );
@@ -0,0 +1,9 @@
+ALTER TABLE app.appointments
+    DROP CONSTRAINT IF EXISTS appointments_mechanic_overlap,
+    DROP CONSTRAINT IF EXISTS appointments_bay_overlap,
+    DROP CONSTRAINT IF EXISTS appointments_vehicle_overlap,
+    DROP CONSTRAINT IF EXISTS appointments_time_check,
+    DROP COLUMN IF EXISTS mechanic_id,
+    DROP COLUMN IF EXISTS bay_id;
+
+DROP TABLE IF EXISTS app.bays;
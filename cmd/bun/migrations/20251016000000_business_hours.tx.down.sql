@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS app.idx_appointments_org_open;
+
+DROP TABLE IF EXISTS app.closures;
+DROP TABLE IF EXISTS app.business_hours;
+
+ALTER TABLE app.organizations
+    DROP COLUMN IF EXISTS time_zone;
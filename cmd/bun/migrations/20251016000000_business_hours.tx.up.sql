@@ -0,0 +1,73 @@
+-- =========================
+-- Business hours & closures
+-- =========================
+-- Appointment availability is computed from the organization's weekly business hours,
+-- in its time zone, less its closures (holidays, early closings).
+
+ALTER TABLE app.organizations
+    ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC'; -- IANA name, checked by the API
+
+CREATE TABLE app.business_hours
+(
+    id              UUID PRIMARY KEY  DEFAULT gen_random_uuid(),
+    organization_id UUID     NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    weekday         SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 is Sunday
+    opens_at        TIME     NOT NULL,
+    closes_at       TIME     NOT NULL,
+    CHECK (closes_at > opens_at)
+);
+CREATE INDEX idx_business_hours_org ON app.business_hours (organization_id, weekday);
+
+CREATE TABLE app.closures
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    organization_id UUID        NOT NULL REFERENCES app.organizations (id) ON DELETE CASCADE,
+    starts_at       TIMESTAMPTZ NOT NULL,
+    ends_at         TIMESTAMPTZ NOT NULL,
+    reason          TEXT,
+    created_by      UUID        REFERENCES app.users (id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (ends_at > starts_at)
+);
+CREATE INDEX idx_closures_org ON app.closures (organization_id, starts_at);
+
+-- Availability counts the open appointments overlapping a range.
+CREATE INDEX idx_appointments_org_open ON app.appointments (organization_id, start_time, end_time)
+    WHERE status IN ('pending', 'confirmed');
+
+ALTER TABLE app.business_hours
+    ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app.closures
+    ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY bh_select ON app.business_hours
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY bh_insert ON app.business_hours
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin'])
+    );
+CREATE POLICY bh_delete ON app.business_hours
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin'])
+    );
+
+CREATE POLICY cl_select ON app.closures
+    FOR SELECT
+    USING (organization_id = app.current_org_id() AND app.is_org_member(organization_id));
+CREATE POLICY cl_insert ON app.closures
+    FOR INSERT
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin'])
+    );
+CREATE POLICY cl_delete ON app.closures
+    FOR DELETE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin'])
+    );
@@ -0,0 +1,16 @@
+DROP POLICY IF EXISTS orgmem_select_mine ON app.organization_members;
+DROP POLICY IF EXISTS org_select_mine ON app.organizations;
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA app
+    REVOKE EXECUTE ON FUNCTIONS FROM enginecare_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA app, public, config
+    REVOKE USAGE, SELECT ON SEQUENCES FROM enginecare_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA app, public, config
+    REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM enginecare_app;
+
+REVOKE EXECUTE ON ALL FUNCTIONS IN SCHEMA app FROM enginecare_app;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA app, public, config FROM enginecare_app;
+REVOKE ALL ON ALL TABLES IN SCHEMA app, public, config FROM enginecare_app;
+REVOKE USAGE ON SCHEMA app, public, config FROM enginecare_app;
+
+-- The role itself is cluster wide and may be used by other databases; drop it by hand.
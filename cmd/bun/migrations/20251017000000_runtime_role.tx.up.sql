@@ -0,0 +1,44 @@
+-- =========================
+-- Runtime role: the API connects without owning the tables
+-- =========================
+-- Table owners bypass row-level security, so the policies only apply to a role that does
+-- not own the tables. The migrator keeps the owner credentials; the API logs in with a role
+-- that is a member of enginecare_app, which may read and write rows but not change the schema:
+--   CREATE ROLE enginecare_api LOGIN PASSWORD '...' IN ROLE enginecare_app;
+-- Roles are cluster wide: when the migrator may not create roles, create enginecare_app
+-- (NOLOGIN) beforehand and this only grants it privileges.
+DO
+$$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'enginecare_app') THEN
+            CREATE ROLE enginecare_app NOLOGIN NOSUPERUSER NOBYPASSRLS;
+        END IF;
+    END
+$$;
+
+GRANT USAGE ON SCHEMA app, public, config TO enginecare_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA app, public, config TO enginecare_app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA app, public, config TO enginecare_app;
+GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA app TO enginecare_app;
+
+-- Tables created by later migrations get the same privileges.
+ALTER DEFAULT PRIVILEGES IN SCHEMA app, public, config
+    GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO enginecare_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA app, public, config
+    GRANT USAGE, SELECT ON SEQUENCES TO enginecare_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA app
+    GRANT EXECUTE ON FUNCTIONS TO enginecare_app;
+
+-- The migration history is the migrator's alone.
+REVOKE ALL ON bun_migrations, bun_migration_locks FROM enginecare_app;
+
+-- Outside a tenant transaction only app.user_id is set (app.current_org_id() is NULL):
+-- users see their own memberships, the members of their organizations and those
+-- organizations, which GET /v1/me and the users endpoints rely on.
+CREATE POLICY org_select_mine ON app.organizations
+    FOR SELECT
+    USING (app.current_org_id() IS NULL AND app.is_org_member(id));
+
+CREATE POLICY orgmem_select_mine ON app.organization_members
+    FOR SELECT
+    USING (app.current_org_id() IS NULL AND app.is_org_member(organization_id));
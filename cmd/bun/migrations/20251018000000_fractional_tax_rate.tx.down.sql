@@ -0,0 +1,2 @@
+ALTER TABLE app.work_order_items
+    ALTER COLUMN tax_rate_pct TYPE INT USING round(tax_rate_pct)::int;
@@ -0,0 +1,4 @@
+-- Tax rates such as 8.25% need decimals; the work_order_items_tax_rate_range check
+-- (0 to 100) still applies.
+ALTER TABLE app.work_order_items
+    ALTER COLUMN tax_rate_pct TYPE NUMERIC(5, 2);
@@ -0,0 +1,28 @@
+CREATE OR REPLACE FUNCTION app.is_org_member(org uuid)
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM app.organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id());
+$$;
+
+CREATE OR REPLACE FUNCTION app.has_org_role(org uuid, roles text[])
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT EXISTS (SELECT 1
+               FROM app.organization_members m
+               WHERE m.organization_id = org
+                 AND m.user_id = app.current_user_id()
+                 AND m.role::text = ANY (roles));
+$$;
+
+DROP FUNCTION IF EXISTS app.system_user_id();
@@ -0,0 +1,46 @@
+-- =========================
+-- System identity: server jobs act within one organization at a time
+-- =========================
+-- Jobs such as the maintenance reminders run outside any request, as the runtime role
+-- (see 20251017000000_runtime_role), so row-level security applies to them too. They set
+-- app.user_id to this reserved id, which is not a version 4 UUID and so never a user's,
+-- and app.organization_id to the organization they work on: the helpers below treat the
+-- identity as a member with every role, and the policies still confine it to that
+-- organization. With app.organization_id unset it sees every organization
+-- (org_select_mine), which is how a job lists them.
+CREATE OR REPLACE FUNCTION app.system_user_id()
+    RETURNS uuid
+    LANGUAGE sql
+    IMMUTABLE AS
+$$
+SELECT '00000000-0000-0000-0000-000000000001'::uuid;
+$$;
+
+CREATE OR REPLACE FUNCTION app.is_org_member(org uuid)
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT app.current_user_id() = app.system_user_id()
+           OR EXISTS (SELECT 1
+                      FROM app.organization_members m
+                      WHERE m.organization_id = org
+                        AND m.user_id = app.current_user_id());
+$$;
+
+CREATE OR REPLACE FUNCTION app.has_org_role(org uuid, roles text[])
+    RETURNS boolean
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path = app, public AS
+$$
+SELECT app.current_user_id() = app.system_user_id()
+           OR EXISTS (SELECT 1
+                      FROM app.organization_members m
+                      WHERE m.organization_id = org
+                        AND m.user_id = app.current_user_id()
+                        AND m.role::text = ANY (roles));
+$$;
@@ -0,0 +1,2 @@
+ALTER TABLE app.organization_members
+    DROP COLUMN IF EXISTS is_active;
@@ -0,0 +1,8 @@
+-- =========================
+-- Member activity: owners and admins suspend a member in their organization only
+-- =========================
+-- users.is_active is the account as a whole and only its owner may close it; a
+-- deactivated membership is rejected by middleware.Tenancy in that organization and
+-- leaves the user's other organizations alone.
+ALTER TABLE app.organization_members
+    ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
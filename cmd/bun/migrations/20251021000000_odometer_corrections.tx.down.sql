@@ -0,0 +1,5 @@
+DROP POLICY IF EXISTS odo_update ON public.odometer_readings;
+
+ALTER TABLE public.odometer_readings
+    DROP COLUMN IF EXISTS voided_by,
+    DROP COLUMN IF EXISTS voided_at;
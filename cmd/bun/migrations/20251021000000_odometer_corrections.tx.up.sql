@@ -0,0 +1,21 @@
+-- =========================
+-- Odometer corrections: managers void a wrong reading
+-- =========================
+-- A mistyped high reading would otherwise become the vehicle's mileage and flag every
+-- correct reading after it as decreased. Voided readings stay in the log for the
+-- record but are ignored: vehicles.mileage_km and the decreased flags of the remaining
+-- readings are recomputed from them in order (vehicles.Svc.VoidMileage).
+ALTER TABLE public.odometer_readings
+    ADD COLUMN voided_at TIMESTAMPTZ,
+    ADD COLUMN voided_by UUID REFERENCES app.users (id) ON DELETE SET NULL;
+
+CREATE POLICY odo_update ON public.odometer_readings
+    FOR UPDATE
+    USING (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    )
+    WITH CHECK (
+    organization_id = app.current_org_id()
+        AND app.has_org_role(organization_id, ARRAY ['owner','admin','manager'])
+    );
@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // organization time zones; the runtime image has no zoneinfo
 
 	"github.com/brxyxn/go-logger"
 	"github.com/gorilla/mux"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/brxyxn/engine-care-api/config"
 	"github.com/brxyxn/engine-care-api/internal"
+	"github.com/brxyxn/engine-care-api/internal/maintenance"
 )
 
 func main() {
@@ -29,6 +31,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if err = cfg.CheckSecrets(); err != nil {
+		panic(err)
+	}
 
 	opts := []logger.OptsFunc{
 		func(o *logger.Opts) {
@@ -43,6 +48,9 @@ func main() {
 
 	db := configDB(log, cfg)
 
+	remLog := log.With().Str("component", "maintenance-reminders").Logger()
+	maintenance.NewReminders(remLog, db, cfg.MaintenanceReminderInterval, cfg.MaintenanceReminderLead).Start(ctx)
+
 	// we will refactor to plug in more routes later
 	routes := internal.NewRoutes(ctx, cfg, log, db)
 	r := routes.ConfigRoutes()
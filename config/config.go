@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"time"
 
 	"github.com/spf13/viper"
@@ -17,6 +18,32 @@ type Config struct {
 	JwtSecret      string        `mapstructure:"JWT_SECRET"`
 	JwtExpDiration time.Duration `mapstructure:"JWT_EXP_DURATION"`
 	JwtIssuer      string        `mapstructure:"JWT_ISSUER"`
+	JwtAudience    []string      `mapstructure:"JWT_AUDIENCE"`
+	JwtLeeway      time.Duration `mapstructure:"JWT_LEEWAY"`
+
+	// JWKS config, used to verify asymmetric (Stack Auth) tokens.
+	// When a source is set, HMAC tokens signed with JwtSecret are no longer accepted.
+	JwksURL             string        `mapstructure:"JWKS_URL"`
+	JwksFile            string        `mapstructure:"JWKS_FILE"`
+	JwksRefreshInterval time.Duration `mapstructure:"JWKS_REFRESH_INTERVAL"`
+
+	// UserSyncInterval is how often a user's profile is refreshed from token claims.
+	UserSyncInterval time.Duration `mapstructure:"USER_SYNC_INTERVAL"`
+
+	// Estimate approval links: signed with EstimateLinkSecret, valid for EstimateLinkTTL
+	// unless the sender picks another expiry, and built on PublicBaseURL.
+	EstimateLinkSecret string        `mapstructure:"ESTIMATE_LINK_SECRET"`
+	EstimateLinkTTL    time.Duration `mapstructure:"ESTIMATE_LINK_TTL"`
+	PublicBaseURL      string        `mapstructure:"PUBLIC_BASE_URL"`
+
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies whose
+	// X-Forwarded-For header is believed. Empty trusts none.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+
+	// Maintenance reminders: queued every MaintenanceReminderInterval (0 disables them)
+	// for services due within MaintenanceReminderLead.
+	MaintenanceReminderInterval time.Duration `mapstructure:"MAINTENANCE_REMINDER_INTERVAL"`
+	MaintenanceReminderLead     time.Duration `mapstructure:"MAINTENANCE_REMINDER_LEAD"`
 
 	// Server config
 	ServerPort             string `mapstructure:"SERVER_PORT"`
@@ -33,6 +60,30 @@ type Config struct {
 	CorsExposedHeaders   string   `mapstructure:"CORS_EXPOSED_HEADERS"`
 }
 
+// defaultEstimateLinkSecret is only good enough for local development.
+const defaultEstimateLinkSecret = "our_estimate_link_secret"
+
+// minEstimateLinkSecret is the shortest estimate link secret accepted outside local:
+// the links are HMAC-SHA256 signed and public, so the key should be as long as the hash.
+const minEstimateLinkSecret = 32
+
+// ErrWeakEstimateLinkSecret is returned by CheckSecrets when ESTIMATE_LINK_SECRET is left
+// at its default or shorter than minEstimateLinkSecret bytes outside the local environment.
+var ErrWeakEstimateLinkSecret = errors.New("config: ESTIMATE_LINK_SECRET must be set to at least 32 bytes outside local")
+
+// CheckSecrets reports secrets still at their development defaults where they would
+// let anyone forge requests. Only the server signs with them, so the migration CLI
+// does not call it.
+func (c Config) CheckSecrets() error {
+	if c.Env == "local" {
+		return nil
+	}
+	if c.EstimateLinkSecret == defaultEstimateLinkSecret || len(c.EstimateLinkSecret) < minEstimateLinkSecret {
+		return ErrWeakEstimateLinkSecret
+	}
+	return nil
+}
+
 func GetConfig() (conf Config, err error) {
 
 	viper.AddConfigPath(".")
@@ -50,6 +101,18 @@ func GetConfig() (conf Config, err error) {
 		viper.SetDefault("JWT_SECRET", "our_secret_key")
 		viper.SetDefault("JWT_EXP_DURATION", 24)
 		viper.SetDefault("JWT_ISSUER", "enginecare-api")
+		viper.SetDefault("JWT_AUDIENCE", "")
+		viper.SetDefault("JWT_LEEWAY", "30s")
+		viper.SetDefault("JWKS_URL", "")
+		viper.SetDefault("JWKS_FILE", "")
+		viper.SetDefault("JWKS_REFRESH_INTERVAL", "15m")
+		viper.SetDefault("USER_SYNC_INTERVAL", "10m")
+		viper.SetDefault("ESTIMATE_LINK_SECRET", defaultEstimateLinkSecret)
+		viper.SetDefault("ESTIMATE_LINK_TTL", "168h")
+		viper.SetDefault("PUBLIC_BASE_URL", "http://localhost:4000")
+		viper.SetDefault("TRUSTED_PROXIES", "")
+		viper.SetDefault("MAINTENANCE_REMINDER_INTERVAL", "1h")
+		viper.SetDefault("MAINTENANCE_REMINDER_LEAD", "168h")
 		viper.SetDefault("SERVER_PORT", "4000")
 		viper.SetDefault("SERVER_READ_TIMEOUT", 15)
 		viper.SetDefault("SERVER_WRITE_TIMEOUT", 15)
@@ -57,7 +120,7 @@ func GetConfig() (conf Config, err error) {
 
 		// CORS config defaults
 		viper.SetDefault("CORS_ALLOWED_ORIGINS", "*")
-		viper.SetDefault("CORS_ALLOWED_METHODS", "DELETE,GET,OPTIONS,POST,PUT")
+		viper.SetDefault("CORS_ALLOWED_METHODS", "DELETE,GET,OPTIONS,PATCH,POST,PUT")
 		viper.SetDefault("CORS_ALLOWED_HEADERS", "*")
 		viper.SetDefault("CORS_ALLOW_CREDENTIALS", "true")
 		viper.SetDefault("CORS_DEBUG", "false")
@@ -0,0 +1,313 @@
+package appointments
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// Availability search limits.
+const (
+	DefaultStep     = 15 * time.Minute
+	defaultSpan     = 7 * 24 * time.Hour
+	maxSearchSpan   = 31 * 24 * time.Hour
+	minSlotDuration = 5 * time.Minute
+	maxSlotDuration = 24 * time.Hour
+)
+
+// Availability is the result of a slot search. Times are in the organization's time
+// zone; Capacity is how many appointments the shop, or the requested bay or mechanic,
+// takes at once.
+type Availability struct {
+	TimeZone string  `json:"time_zone"`
+	Capacity int     `json:"capacity"`
+	Slots    []*Slot `json:"slots"`
+}
+
+// Slot is a free slot: Free more appointments fit in all of it.
+type Slot struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Free      int       `json:"free"`
+}
+
+// Bound is a from or to of a slot search: an instant, or a date taken in the
+// organization's time zone.
+type Bound struct {
+	At   time.Time
+	Date bool
+}
+
+// in resolves b in loc. A date starts at its midnight, or ends at the next one when
+// end is set, so to=2025-10-20 includes that day.
+func (b Bound) in(loc *time.Location, end bool) time.Time {
+	if !b.Date {
+		return b.At
+	}
+	day := time.Date(b.At.Year(), b.At.Month(), b.At.Day(), 0, 0, 0, 0, loc)
+	if end {
+		return day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// AvailabilityQuery is a slot search, see Svc.Availability.
+type AvailabilityQuery struct {
+	From       *Bound
+	To         *Bound
+	Duration   time.Duration
+	Step       time.Duration
+	BayID      *uuid.UUID
+	MechanicID *uuid.UUID
+}
+
+// Availability lists the slots of q.Duration, starting every q.Step, where another
+// appointment fits between q.From (default now) and q.To (default a week later). The
+// slots are within the business hours, outside the closures, and where fewer pending
+// or confirmed appointments overlap than the capacity: the number of active bays, or of
+// mechanics when the shop has no bays, at least one. With a bay or mechanic the search
+// is for that one: only their appointments count and the capacity is one.
+func (s *Svc) Availability(ctx context.Context, q AvailabilityQuery) (*Availability, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	tz, err := timeZone(ctx, db, t.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		s.log.Warn().Err(err).Str("time_zone", tz).Msg("unknown organization time zone, using UTC")
+		tz, loc = "UTC", time.UTC
+	}
+
+	now := time.Now()
+	from, to := now, time.Time{}
+	if q.From != nil {
+		from = q.From.in(loc, false)
+	}
+	if q.To != nil {
+		to = q.To.in(loc, true)
+	} else {
+		to = from.Add(defaultSpan)
+	}
+
+	var fe api.FieldErrors
+	switch {
+	case !to.After(from):
+		fe.Add("to", "must be after from")
+	case to.Sub(from) > maxSearchSpan:
+		fe.Add("to", "must be at most %d days after from", int(maxSearchSpan/(24*time.Hour)))
+	}
+	err = checkRefs(ctx, db, t.OrganizationID, uuid.Nil, nil, q.BayID, q.MechanicID, &fe)
+	if err != nil {
+		return nil, err
+	}
+	if len(fe) > 0 {
+		return nil, api.Validation("invalid query parameters", fe...)
+	}
+	if from.Before(now) {
+		from = now
+	}
+
+	result := &Availability{TimeZone: tz, Capacity: 1, Slots: []*Slot{}}
+	if q.BayID == nil && q.MechanicID == nil {
+		result.Capacity, err = capacity(ctx, db, t.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !to.After(from) {
+		return result, nil
+	}
+
+	hours, err := openingHours(ctx, db, t.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var closures []*Closure
+	err = db.NewSelect().
+		Model(&closures).
+		Where("cl.organization_id = ?", t.OrganizationID).
+		Where("cl.starts_at < ?", to).
+		Where("cl.ends_at > ?", from).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var booked []*Appointment
+	err = db.NewSelect().
+		Model(&booked).
+		Column("start_time", "end_time").
+		Where("a.organization_id = ?", t.OrganizationID).
+		Where("a.status IN (?)", bun.In([]Status{StatusPending, StatusConfirmed})).
+		Where("a.start_time < ?", to).
+		Where("a.end_time > ?", from).
+		WhereGroup(" AND ", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			if q.BayID != nil {
+				sq = sq.WhereOr("a.bay_id = ?", *q.BayID)
+			}
+			if q.MechanicID != nil {
+				sq = sq.WhereOr("a.mechanic_id = ?", *q.MechanicID)
+			}
+			return sq
+		}).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	open := openSpans(from, to, loc, hours)
+	for _, c := range closures {
+		open = cut(open, span{c.StartsAt, c.EndsAt})
+	}
+	busy := make([]span, 0, len(booked))
+	for _, a := range booked {
+		busy = append(busy, span{a.StartTime, a.EndTime})
+	}
+
+	result.Slots = freeSlots(open, busy, loc, q.Duration, q.Step, result.Capacity)
+	return result, nil
+}
+
+// capacity is how many appointments the organization takes at once: its active bays,
+// or its mechanics when it has no bays, at least one.
+func capacity(ctx context.Context, db bun.IDB, orgID uuid.UUID) (int, error) {
+	n, err := db.NewSelect().
+		Model((*Bay)(nil)).
+		Where("bay.organization_id = ?", orgID).
+		Where("bay.active").
+		Count(ctx)
+	if err != nil || n > 0 {
+		return n, err
+	}
+
+	n, err = db.NewSelect().
+		Table("organization_members").
+		Where("organization_id = ?", orgID).
+		Where("role = ?", organizations.OrgRoleMechanic).
+		Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return max(n, 1), nil
+}
+
+// span is the time from start until end.
+type span struct {
+	start, end time.Time
+}
+
+// openSpans lists the business hours between from and to, in loc, in order.
+func openSpans(from, to time.Time, loc *time.Location, hours []*OpeningHours) []span {
+	var spans []span
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, h := range hours {
+			if time.Weekday(h.Weekday) != day.Weekday() {
+				continue
+			}
+			s := span{
+				start: h.Opens.On(day.Year(), day.Month(), day.Day(), loc),
+				end:   h.Closes.On(day.Year(), day.Month(), day.Day(), loc),
+			}
+			if s.start.Before(from) {
+				s.start = from
+			}
+			if s.end.After(to) {
+				s.end = to
+			}
+			if s.end.After(s.start) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start.Before(spans[j].start)
+	})
+	return spans
+}
+
+// cut removes c from spans.
+func cut(spans []span, c span) []span {
+	kept := make([]span, 0, len(spans))
+	for _, s := range spans {
+		if !c.start.Before(s.end) || !c.end.After(s.start) {
+			kept = append(kept, s)
+			continue
+		}
+		if c.start.After(s.start) {
+			kept = append(kept, span{s.start, c.start})
+		}
+		if c.end.Before(s.end) {
+			kept = append(kept, span{c.end, s.end})
+		}
+	}
+	return kept
+}
+
+// freeSlots lists the slots of duration d within the open spans, starting on the step
+// grid from local midnight, where fewer than capacity busy spans overlap at any time.
+func freeSlots(open, busy []span, loc *time.Location, d, step time.Duration, capacity int) []*Slot {
+	slots := []*Slot{}
+	for _, o := range open {
+		for start := onGrid(o.start, loc, step); !start.Add(d).After(o.end); start = start.Add(step) {
+			end := start.Add(d)
+			if n := overlapping(busy, start, end); n < capacity {
+				slots = append(slots, &Slot{StartTime: start.In(loc), EndTime: end.In(loc), Free: capacity - n})
+			}
+		}
+	}
+	return slots
+}
+
+// onGrid rounds t up to a multiple of step after its local midnight. The time since
+// midnight is read off the wall clock, so the grid stays put on the days the clocks
+// change: 09:00 is on a 45 minute grid even when the day is 23 hours long.
+func onGrid(t time.Time, loc *time.Location, step time.Duration) time.Time {
+	local := t.In(loc)
+	since := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	if r := since % step; r != 0 {
+		return t.Add(step - r)
+	}
+	return t
+}
+
+// overlapping is the most busy spans overlapping each other within [start, end).
+func overlapping(busy []span, start, end time.Time) int {
+	type edge struct {
+		at    time.Time
+		delta int
+	}
+	var edges []edge
+	for _, b := range busy {
+		if b.start.Before(end) && b.end.After(start) {
+			edges = append(edges, edge{b.start, 1}, edge{b.end, -1})
+		}
+	}
+	// An appointment ending when another starts does not overlap it.
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	n, most := 0, 0
+	for _, e := range edges {
+		n += e.delta
+		most = max(most, n)
+	}
+	return most
+}
@@ -0,0 +1,272 @@
+package appointments
+
+import (
+	"testing"
+	"time"
+)
+
+var newYork = mustLoad("America/New_York")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// at is a wall clock time in New York.
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, newYork)
+}
+
+// hoursOf builds business hours from "weekday opens closes" triples.
+func hoursOf(days ...any) []*OpeningHours {
+	var hours []*OpeningHours
+	for i := 0; i+2 < len(days); i += 3 {
+		hours = append(hours, &OpeningHours{
+			Weekday: int(days[i].(time.Weekday)),
+			Opens:   clock(days[i+1].(string)),
+			Closes:  clock(days[i+2].(string)),
+		})
+	}
+	return hours
+}
+
+func clock(s string) Clock {
+	c, err := ParseClock(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func sameSpans(got, want []span) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].start.Equal(want[i].start) || !got[i].end.Equal(want[i].end) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOpenSpans(t *testing.T) {
+	// 2025-10-20 is a Monday. New York springs forward on 2025-03-09 and falls back on
+	// 2025-11-02, both Sundays.
+	week := hoursOf(
+		time.Tuesday, "09:00", "17:00",
+		time.Monday, "13:00", "17:00",
+		time.Monday, "08:00", "12:00",
+		time.Sunday, "00:00", "06:00",
+		time.Saturday, "20:00", "24:00",
+	)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []span
+	}{
+		{"two days, sorted", at(2025, 10, 20, 0, 0), at(2025, 10, 22, 0, 0), []span{
+			{at(2025, 10, 20, 8, 0), at(2025, 10, 20, 12, 0)},
+			{at(2025, 10, 20, 13, 0), at(2025, 10, 20, 17, 0)},
+			{at(2025, 10, 21, 9, 0), at(2025, 10, 21, 17, 0)},
+		}},
+		{"clipped to from and to", at(2025, 10, 20, 10, 30), at(2025, 10, 21, 12, 0), []span{
+			{at(2025, 10, 20, 10, 30), at(2025, 10, 20, 12, 0)},
+			{at(2025, 10, 20, 13, 0), at(2025, 10, 20, 17, 0)},
+			{at(2025, 10, 21, 9, 0), at(2025, 10, 21, 12, 0)},
+		}},
+		{"closed day", at(2025, 10, 22, 0, 0), at(2025, 10, 24, 0, 0), nil},
+		{"between two spans", at(2025, 10, 20, 12, 0), at(2025, 10, 20, 13, 0), nil},
+		{"open until midnight", at(2025, 10, 25, 0, 0), at(2025, 10, 26, 0, 0), []span{
+			{at(2025, 10, 25, 20, 0), at(2025, 10, 26, 0, 0)},
+		}},
+		{"spring forward", at(2025, 3, 9, 0, 0), at(2025, 3, 10, 0, 0), []span{
+			{at(2025, 3, 9, 0, 0), at(2025, 3, 9, 6, 0)},
+		}},
+		{"fall back", at(2025, 11, 2, 0, 0), at(2025, 11, 3, 0, 0), []span{
+			{at(2025, 11, 2, 0, 0), at(2025, 11, 2, 6, 0)},
+		}},
+		{"from given in another zone", at(2025, 10, 20, 0, 0).UTC(), at(2025, 10, 20, 12, 0).UTC(), []span{
+			{at(2025, 10, 20, 8, 0), at(2025, 10, 20, 12, 0)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := openSpans(tt.from, tt.to, newYork, week); !sameSpans(got, tt.want) {
+				t.Fatalf("openSpans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The clocks change inside the spans: they are an hour shorter or longer.
+	spring := openSpans(at(2025, 3, 9, 0, 0), at(2025, 3, 10, 0, 0), newYork, week)
+	fall := openSpans(at(2025, 11, 2, 0, 0), at(2025, 11, 3, 0, 0), newYork, week)
+	if d := spring[0].end.Sub(spring[0].start); d != 5*time.Hour {
+		t.Errorf("spring forward span lasts %s, want 5h", d)
+	}
+	if d := fall[0].end.Sub(fall[0].start); d != 7*time.Hour {
+		t.Errorf("fall back span lasts %s, want 7h", d)
+	}
+}
+
+func TestCut(t *testing.T) {
+	day := []span{
+		{at(2025, 10, 20, 8, 0), at(2025, 10, 20, 12, 0)},
+		{at(2025, 10, 20, 13, 0), at(2025, 10, 20, 17, 0)},
+	}
+
+	tests := []struct {
+		name string
+		c    span
+		want []span
+	}{
+		{"before", span{at(2025, 10, 20, 6, 0), at(2025, 10, 20, 7, 0)}, day},
+		{"touching both ends", span{at(2025, 10, 20, 12, 0), at(2025, 10, 20, 13, 0)}, day},
+		{"inside", span{at(2025, 10, 20, 9, 0), at(2025, 10, 20, 10, 0)}, []span{
+			{at(2025, 10, 20, 8, 0), at(2025, 10, 20, 9, 0)},
+			{at(2025, 10, 20, 10, 0), at(2025, 10, 20, 12, 0)},
+			day[1],
+		}},
+		{"overlapping the start", span{at(2025, 10, 20, 7, 0), at(2025, 10, 20, 9, 0)}, []span{
+			{at(2025, 10, 20, 9, 0), at(2025, 10, 20, 12, 0)},
+			day[1],
+		}},
+		{"overlapping the end", span{at(2025, 10, 20, 16, 0), at(2025, 10, 20, 18, 0)}, []span{
+			day[0],
+			{at(2025, 10, 20, 13, 0), at(2025, 10, 20, 16, 0)},
+		}},
+		{"across two spans", span{at(2025, 10, 20, 11, 0), at(2025, 10, 20, 14, 0)}, []span{
+			{at(2025, 10, 20, 8, 0), at(2025, 10, 20, 11, 0)},
+			{at(2025, 10, 20, 14, 0), at(2025, 10, 20, 17, 0)},
+		}},
+		{"whole day", span{at(2025, 10, 20, 0, 0), at(2025, 10, 21, 0, 0)}, []span{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cut(day, tt.c); !sameSpans(got, tt.want) {
+				t.Fatalf("cut = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnGrid(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		step time.Duration
+		want time.Time
+	}{
+		{"on the grid", at(2025, 10, 20, 9, 0), 15 * time.Minute, at(2025, 10, 20, 9, 0)},
+		{"rounded up", at(2025, 10, 20, 9, 1), 15 * time.Minute, at(2025, 10, 20, 9, 15)},
+		{"seconds rounded up", at(2025, 10, 20, 9, 0).Add(time.Second), 15 * time.Minute, at(2025, 10, 20, 9, 15)},
+		{"step not dividing an hour", at(2025, 10, 20, 9, 10), 45 * time.Minute, at(2025, 10, 20, 9, 45)},
+		{"grid from local, not UTC, midnight", at(2025, 10, 20, 9, 0).UTC(), 7 * time.Hour, at(2025, 10, 20, 14, 0)},
+		{"spring forward keeps the wall clock grid", at(2025, 3, 9, 9, 0), 45 * time.Minute, at(2025, 3, 9, 9, 0)},
+		{"fall back keeps the wall clock grid", at(2025, 11, 2, 9, 10), 45 * time.Minute, at(2025, 11, 2, 9, 45)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onGrid(tt.t, newYork, tt.step); !got.Equal(tt.want) {
+				t.Fatalf("onGrid(%s, %s) = %s, want %s", tt.t, tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlapping(t *testing.T) {
+	nine, ten, eleven, noon, one := at(2025, 10, 20, 9, 0), at(2025, 10, 20, 10, 0),
+		at(2025, 10, 20, 11, 0), at(2025, 10, 20, 12, 0), at(2025, 10, 20, 13, 0)
+
+	tests := []struct {
+		name       string
+		busy       []span
+		start, end time.Time
+		want       int
+	}{
+		{"none", nil, nine, noon, 0},
+		{"outside the window", []span{{nine, ten}, {noon, one}}, ten, noon, 0},
+		{"back to back", []span{{nine, ten}, {ten, eleven}, {eleven, noon}}, nine, noon, 1},
+		{"nested", []span{{nine, noon}, {ten, eleven}}, nine, noon, 2},
+		{"chained", []span{{nine, eleven}, {ten, noon}, {eleven, one}}, nine, one, 2},
+		{"same span twice", []span{{ten, eleven}, {ten, eleven}}, nine, noon, 2},
+		{"ends as the window starts", []span{{nine, ten}}, ten, eleven, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlapping(tt.busy, tt.start, tt.end); got != tt.want {
+				t.Fatalf("overlapping = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	morning := []span{{at(2025, 10, 20, 9, 0), at(2025, 10, 20, 12, 0)}}
+	backToBack := []span{
+		{at(2025, 10, 20, 9, 0), at(2025, 10, 20, 10, 0)},
+		{at(2025, 10, 20, 10, 0), at(2025, 10, 20, 11, 0)},
+	}
+
+	type slot struct {
+		start time.Time
+		free  int
+	}
+	tests := []struct {
+		name     string
+		open     []span
+		busy     []span
+		d, step  time.Duration
+		capacity int
+		want     []slot
+	}{
+		{"empty shop", morning, nil, time.Hour, time.Hour, 1, []slot{
+			{at(2025, 10, 20, 9, 0), 1}, {at(2025, 10, 20, 10, 0), 1}, {at(2025, 10, 20, 11, 0), 1},
+		}},
+		{"slot must fit before closing", morning, nil, 2 * time.Hour, 45 * time.Minute, 1, []slot{
+			{at(2025, 10, 20, 9, 0), 1}, {at(2025, 10, 20, 9, 45), 1},
+		}},
+		{"back to back, one bay", morning, backToBack, time.Hour, 30 * time.Minute, 1, []slot{
+			{at(2025, 10, 20, 11, 0), 1},
+		}},
+		{"back to back, two bays", morning, backToBack, time.Hour, time.Hour, 2, []slot{
+			{at(2025, 10, 20, 9, 0), 1}, {at(2025, 10, 20, 10, 0), 1}, {at(2025, 10, 20, 11, 0), 2},
+		}},
+		{"slot across two back to back appointments, two bays", morning, backToBack, 2 * time.Hour, time.Hour, 2, []slot{
+			{at(2025, 10, 20, 9, 0), 1}, {at(2025, 10, 20, 10, 0), 1},
+		}},
+		{"open span off the grid", []span{{at(2025, 10, 20, 9, 5), at(2025, 10, 20, 10, 30)}}, nil, 30 * time.Minute, 15 * time.Minute, 1, []slot{
+			{at(2025, 10, 20, 9, 15), 1}, {at(2025, 10, 20, 9, 30), 1}, {at(2025, 10, 20, 9, 45), 1}, {at(2025, 10, 20, 10, 0), 1},
+		}},
+		{"spring forward", []span{{at(2025, 3, 9, 0, 0), at(2025, 3, 9, 4, 0)}}, nil, time.Hour, time.Hour, 1, []slot{
+			{at(2025, 3, 9, 0, 0), 1}, {at(2025, 3, 9, 1, 0), 1}, {at(2025, 3, 9, 3, 0), 1},
+		}},
+		{"fall back", []span{{at(2025, 11, 2, 0, 0), at(2025, 11, 2, 3, 0)}}, nil, time.Hour, time.Hour, 1, []slot{
+			{at(2025, 11, 2, 0, 0), 1}, {at(2025, 11, 2, 1, 0), 1}, {at(2025, 11, 2, 1, 0).Add(time.Hour), 1}, {at(2025, 11, 2, 2, 0), 1},
+		}},
+		{"45 minute grid on a spring forward day", []span{{at(2025, 3, 9, 9, 0), at(2025, 3, 9, 11, 0)}}, nil, 45 * time.Minute, 45 * time.Minute, 1, []slot{
+			{at(2025, 3, 9, 9, 0), 1}, {at(2025, 3, 9, 9, 45), 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := freeSlots(tt.open, tt.busy, newYork, tt.d, tt.step, tt.capacity)
+			if len(got) != len(tt.want) {
+				t.Fatalf("freeSlots = %d slots %v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if !g.StartTime.Equal(w.start) || !g.EndTime.Equal(w.start.Add(tt.d)) || g.Free != w.free {
+					t.Errorf("slot %d = %s–%s free %d, want %s free %d", i, g.StartTime, g.EndTime, g.Free, w.start, w.free)
+				}
+				if g.StartTime.Location() != newYork {
+					t.Errorf("slot %d is in %s, want the organization's zone", i, g.StartTime.Location())
+				}
+			}
+		})
+	}
+}
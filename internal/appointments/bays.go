@@ -0,0 +1,114 @@
+package appointments
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// Bays lists the organization's bays by name.
+func (s *Svc) Bays(ctx context.Context) ([]*Bay, error) {
+	t := tenant.MustFromContext(ctx)
+
+	bays := []*Bay{}
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&bays).
+		Where("bay.organization_id = ?", t.OrganizationID).
+		OrderExpr("bay.name ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bays, nil
+}
+
+// CreateBay adds an active bay.
+func (s *Svc) CreateBay(ctx context.Context, data CreateBay) (*Bay, error) {
+	t := tenant.MustFromContext(ctx)
+
+	b := Bay{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		Name:           strings.TrimSpace(data.Name),
+		Active:         true,
+	}
+	_, err := tenant.DB(ctx, s.db).NewInsert().
+		Model(&b).
+		ExcludeColumn("created_at", "updated_at").
+		Returning("created_at, updated_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// UpdateBay renames a bay or (de)activates it.
+func (s *Svc) UpdateBay(ctx context.Context, id uuid.UUID, data UpdateBay) (*Bay, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	q := db.NewUpdate().
+		Model((*Bay)(nil)).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	if data.Name != nil {
+		q = q.Set("name = ?", strings.TrimSpace(*data.Name))
+	}
+	if data.Active != nil {
+		q = q.Set("active = ?", *data.Active)
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := affectedOne(res, ErrBayNotFound); err != nil {
+		return nil, err
+	}
+
+	var b Bay
+	err = db.NewSelect().
+		Model(&b).
+		Where("bay.id = ?", id).
+		Where("bay.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// DeleteBay deletes a bay no appointment was booked in; others can be deactivated.
+func (s *Svc) DeleteBay(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	res, err := tenant.DB(ctx, s.db).NewDelete().
+		Model((*Bay)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, ErrBayNotFound)
+}
+
+// affectedOne returns notFound unless res affected a row.
+func affectedOne(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
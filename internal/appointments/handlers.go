@@ -0,0 +1,561 @@
+package appointments
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+)
+
+type h interface {
+	Create() http.HandlerFunc
+	ByID() http.HandlerFunc
+	List() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	SetStatus() http.HandlerFunc
+	Bays() http.HandlerFunc
+	CreateBay() http.HandlerFunc
+	UpdateBay() http.HandlerFunc
+	DeleteBay() http.HandlerFunc
+	Availability() http.HandlerFunc
+	BusinessHours() http.HandlerFunc
+	SetBusinessHours() http.HandlerFunc
+	Closures() http.HandlerFunc
+	CreateClosure() http.HandlerFunc
+	DeleteClosure() http.HandlerFunc
+}
+
+type Hdlr struct {
+	db  *bun.DB
+	log zerolog.Logger
+	svc Svc
+}
+
+var _ h = (*Hdlr)(nil)
+
+func Handler(log zerolog.Logger, db *bun.DB) Hdlr {
+	svc := Service(log, db)
+	return Hdlr{db, log, svc}
+}
+
+// CreateAppointment is the body of POST /appointments. Status is pending by default;
+// an appointment may also be booked confirmed.
+type CreateAppointment struct {
+	CustomerID uuid.UUID  `json:"customer_id" validate:"required"`
+	VehicleID  *uuid.UUID `json:"vehicle_id,omitempty"`
+	BayID      *uuid.UUID `json:"bay_id,omitempty"`
+	MechanicID *uuid.UUID `json:"mechanic_id,omitempty"`
+	Title      string     `json:"title" validate:"required,max=200"`
+	Notes      *string    `json:"notes,omitempty" validate:"max=2000"`
+	Status     *Status    `json:"status,omitempty"`
+	StartTime  time.Time  `json:"start_time" validate:"required"`
+	EndTime    time.Time  `json:"end_time" validate:"required"`
+}
+
+func (a CreateAppointment) Validate() error {
+	var fe api.FieldErrors
+	if !a.EndTime.After(a.StartTime) {
+		fe.Add("end_time", "must be after start_time")
+	}
+	if a.Status != nil && *a.Status != StatusPending && *a.Status != StatusConfirmed {
+		fe.Add("status", "must be %s or %s", StatusPending, StatusConfirmed)
+	}
+	return fe.Err()
+}
+
+// UpdateAppointment holds the fields PATCH /appointments/{id} may change; nil fields
+// are left untouched, empty notes clear them and the nil UUID unassigns the vehicle,
+// bay or mechanic. The status changes through PATCH /appointments/{id}/status.
+type UpdateAppointment struct {
+	Title      *string    `json:"title,omitempty" validate:"min=1,max=200"`
+	Notes      *string    `json:"notes,omitempty" validate:"max=2000"`
+	VehicleID  *uuid.UUID `json:"vehicle_id,omitempty"`
+	BayID      *uuid.UUID `json:"bay_id,omitempty"`
+	MechanicID *uuid.UUID `json:"mechanic_id,omitempty"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+}
+
+// ChangeStatus is the body of PATCH /appointments/{id}/status. When FromStatus is set
+// the change only applies if the appointment is still in that status (412 otherwise).
+type ChangeStatus struct {
+	Status     Status  `json:"status" validate:"required"`
+	FromStatus *Status `json:"from_status,omitempty"`
+}
+
+// CreateBay is the body of POST /bays.
+type CreateBay struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// UpdateBay holds the fields PATCH /bays/{id} may change; nil fields are left
+// untouched.
+type UpdateBay struct {
+	Name   *string `json:"name,omitempty" validate:"min=1,max=100"`
+	Active *bool   `json:"active,omitempty"`
+}
+
+// SetBusinessHours is the body of PUT /business-hours: the organization's IANA time
+// zone and its whole weekly schedule, which replaces the current one.
+type SetBusinessHours struct {
+	TimeZone string    `json:"time_zone" validate:"required,max=64"`
+	Hours    []Opening `json:"hours" validate:"max=50"`
+}
+
+// Opening is a period the shop is open on a weekday, 0 (Sunday) to 6.
+type Opening struct {
+	Weekday int    `json:"weekday" validate:"min=0,max=6"`
+	Opens   *Clock `json:"opens" validate:"required"`
+	Closes  *Clock `json:"closes" validate:"required"`
+}
+
+func (b SetBusinessHours) Validate() error {
+	var fe api.FieldErrors
+	if !validTimeZone(b.TimeZone) {
+		fe.Add("time_zone", "must be an IANA time zone such as America/Bogota")
+	}
+	for i, o := range b.Hours {
+		if *o.Closes <= *o.Opens {
+			fe.Add(fmt.Sprintf("hours[%d].closes", i), "must be after opens")
+			continue
+		}
+		for _, other := range b.Hours[:i] {
+			if other.Weekday == o.Weekday && *o.Opens < *other.Closes && *other.Opens < *o.Closes {
+				fe.Add(fmt.Sprintf("hours[%d]", i), "overlaps other hours of the same weekday")
+				break
+			}
+		}
+	}
+	return fe.Err()
+}
+
+// CreateClosure is the body of POST /closures. A holiday runs from the midnight
+// starting it to the next one, with the organization's offset.
+type CreateClosure struct {
+	StartsAt time.Time `json:"starts_at" validate:"required"`
+	EndsAt   time.Time `json:"ends_at" validate:"required"`
+	Reason   *string   `json:"reason,omitempty" validate:"max=200"`
+}
+
+func (c CreateClosure) Validate() error {
+	var fe api.FieldErrors
+	if !c.EndsAt.After(c.StartsAt) {
+		fe.Add("ends_at", "must be after starts_at")
+	}
+	return fe.Err()
+}
+
+// Create books an appointment.
+func (h *Hdlr) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreateAppointment](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		a, err := h.svc.Create(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating appointment")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Appointment](w, http.StatusCreated, a)
+	}
+}
+
+// ByID gets an appointment.
+func (h *Hdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid appointment id")
+		if !ok {
+			return
+		}
+
+		a, err := h.svc.ByID(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting appointment")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Appointment](w, http.StatusOK, a)
+	}
+}
+
+// List lists appointments, see ListSpec; ?from=&to= fill a calendar.
+func (h *Hdlr) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, ListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		as, page, err := h.svc.List(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing appointments")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*Appointment](w, http.StatusOK, as, page)
+	}
+}
+
+// Update changes an appointment.
+func (h *Hdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid appointment id")
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateAppointment](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		a, err := h.svc.Update(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating appointment")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Appointment](w, http.StatusOK, a)
+	}
+}
+
+// Delete deletes an appointment.
+func (h *Hdlr) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid appointment id")
+		if !ok {
+			return
+		}
+
+		err := h.svc.Delete(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting appointment")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetStatus moves an appointment to another status.
+func (h *Hdlr) SetStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid appointment id")
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[ChangeStatus](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		a, err := h.svc.SetStatus(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error changing appointment status")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Appointment](w, http.StatusOK, a)
+	}
+}
+
+// Bays lists the organization's bays.
+func (h *Hdlr) Bays() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bays, err := h.svc.Bays(r.Context())
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing bays")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Bay](w, http.StatusOK, bays)
+	}
+}
+
+// CreateBay adds a bay.
+func (h *Hdlr) CreateBay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreateBay](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		b, err := h.svc.CreateBay(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating bay")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Bay](w, http.StatusCreated, b)
+	}
+}
+
+// UpdateBay changes a bay.
+func (h *Hdlr) UpdateBay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid bay id")
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateBay](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		b, err := h.svc.UpdateBay(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating bay")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Bay](w, http.StatusOK, b)
+	}
+}
+
+// DeleteBay deletes a bay.
+func (h *Hdlr) DeleteBay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid bay id")
+		if !ok {
+			return
+		}
+
+		err := h.svc.DeleteBay(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting bay")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Availability lists free appointment slots, see parseAvailability.
+func (h *Hdlr) Availability() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAvailability(r.URL.Query())
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		av, err := h.svc.Availability(r.Context(), q)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error searching availability")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Availability](w, http.StatusOK, av)
+	}
+}
+
+// BusinessHours gets the organization's weekly schedule.
+func (h *Hdlr) BusinessHours() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bh, err := h.svc.BusinessHours(r.Context())
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting business hours")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*BusinessHours](w, http.StatusOK, bh)
+	}
+}
+
+// SetBusinessHours replaces the organization's weekly schedule.
+func (h *Hdlr) SetBusinessHours() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[SetBusinessHours](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		bh, err := h.svc.SetBusinessHours(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error setting business hours")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*BusinessHours](w, http.StatusOK, bh)
+	}
+}
+
+// Closures lists closures, see ClosureListSpec.
+func (h *Hdlr) Closures() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, ClosureListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		cs, page, err := h.svc.Closures(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing closures")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*Closure](w, http.StatusOK, cs, page)
+	}
+}
+
+// CreateClosure adds a closure.
+func (h *Hdlr) CreateClosure() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreateClosure](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		c, err := h.svc.CreateClosure(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating closure")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Closure](w, http.StatusCreated, c)
+	}
+}
+
+// DeleteClosure deletes a closure.
+func (h *Hdlr) DeleteClosure() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "invalid closure id")
+		if !ok {
+			return
+		}
+
+		err := h.svc.DeleteClosure(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting closure")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parseAvailability reads the query of GET /appointments/availability: duration
+// (required) and step (default 15m) as Go durations or minutes, from and to as RFC 3339
+// timestamps or dates, and an optional bay_id or mechanic_id.
+func parseAvailability(v url.Values) (AvailabilityQuery, error) {
+	q := AvailabilityQuery{Step: DefaultStep}
+	var fe api.FieldErrors
+
+	if raw := v.Get("duration"); raw == "" {
+		fe.Add("duration", "is required")
+	} else if d, ok := parseMinutes(raw); ok {
+		q.Duration = d
+	} else {
+		fe.Add("duration", "must be a duration such as 90m or 1h30m, between 5m and 24h")
+	}
+	if raw := v.Get("step"); raw != "" {
+		if d, ok := parseMinutes(raw); ok {
+			q.Step = d
+		} else {
+			fe.Add("step", "must be a duration such as 30m, between 5m and 24h")
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **Bound
+	}{{"from", &q.From}, {"to", &q.To}} {
+		raw := v.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			*p.dst = &Bound{At: t}
+		} else if t, err := time.Parse(time.DateOnly, raw); err == nil {
+			*p.dst = &Bound{At: t, Date: true}
+		} else {
+			fe.Add(p.name, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **uuid.UUID
+	}{{"bay_id", &q.BayID}, {"mechanic_id", &q.MechanicID}} {
+		raw := v.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			fe.Add(p.name, "must be a UUID")
+			continue
+		}
+		*p.dst = &id
+	}
+
+	if len(fe) > 0 {
+		return q, api.Validation("invalid query parameters", fe...)
+	}
+	return q, nil
+}
+
+// parseMinutes parses a whole number of minutes or a time.Duration of whole minutes
+// within the slot duration limits.
+func parseMinutes(raw string) (time.Duration, bool) {
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(n) * time.Minute
+	}
+	if d%time.Minute != 0 || d < minSlotDuration || d > maxSlotDuration {
+		return 0, false
+	}
+	return d, true
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest(message))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,257 @@
+package appointments
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// Clock is a time of day in minutes after midnight, "15:04" in JSON and a TIME in
+// Postgres. 24:00 is the end of the day.
+type Clock int
+
+const endOfDay = Clock(24 * 60)
+
+var errClock = errors.New("must be a time of day such as 08:30")
+
+// ParseClock parses "15:04", or "15:04:05" with zero seconds as Postgres prints it.
+func ParseClock(s string) (Clock, error) {
+	if s == "24:00" || s == "24:00:00" {
+		return endOfDay, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		t, err := time.Parse(layout, s)
+		if err == nil && t.Second() == 0 {
+			return Clock(t.Hour()*60 + t.Minute()), nil
+		}
+	}
+	return 0, errClock
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+// On returns the time c on the given day in loc, the next day's midnight for 24:00.
+func (c Clock) On(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, int(c/60), int(c%60), 0, 0, loc)
+}
+
+func (c Clock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *Clock) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errClock
+	}
+	v, err := ParseClock(s)
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+func (c Clock) Value() (driver.Value, error) {
+	return c.String() + ":00", nil
+}
+
+func (c *Clock) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*c = Clock(v.Hour()*60 + v.Minute())
+		return nil
+	case []byte:
+		return c.Scan(string(v))
+	case string:
+		parsed, err := ParseClock(v)
+		if err != nil {
+			return fmt.Errorf("appointments: cannot scan %q into Clock", v)
+		}
+		*c = parsed
+		return nil
+	}
+	return fmt.Errorf("appointments: cannot scan %T into Clock", src)
+}
+
+// BusinessHours is the organization's weekly schedule and the time zone it is in.
+type BusinessHours struct {
+	TimeZone string          `json:"time_zone"`
+	Hours    []*OpeningHours `json:"hours"`
+}
+
+// ClosureListSpec is the filters accepted by GET /closures. from and to select the
+// closures overlapping a range.
+var ClosureListSpec = api.ListSpec{
+	Alias: "cl",
+	Filters: []api.Filter{
+		{Param: "from", Column: "ends_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "to", Column: "starts_at", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:   []string{"starts_at", "created_at"},
+	Default: "starts_at",
+}
+
+// BusinessHours gets the organization's weekly schedule, by weekday and opening time.
+func (s *Svc) BusinessHours(ctx context.Context) (*BusinessHours, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	tz, err := timeZone(ctx, db, t.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	hours, err := openingHours(ctx, db, t.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	return &BusinessHours{TimeZone: tz, Hours: hours}, nil
+}
+
+// SetBusinessHours replaces the organization's weekly schedule and sets its time zone.
+func (s *Svc) SetBusinessHours(ctx context.Context, data SetBusinessHours) (*BusinessHours, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	_, err := db.NewUpdate().
+		Table("organizations").
+		Set("time_zone = ?", data.TimeZone).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewDelete().
+		Model((*OpeningHours)(nil)).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.Hours) > 0 {
+		hours := make([]*OpeningHours, 0, len(data.Hours))
+		for _, o := range data.Hours {
+			hours = append(hours, &OpeningHours{
+				ID:             uuid.New(),
+				OrganizationID: t.OrganizationID,
+				Weekday:        o.Weekday,
+				Opens:          *o.Opens,
+				Closes:         *o.Closes,
+			})
+		}
+		_, err = db.NewInsert().
+			Model(&hours).
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.BusinessHours(ctx)
+}
+
+// Closures lists one page of closures, see ClosureListSpec.
+func (s *Svc) Closures(ctx context.Context, params api.ListParams) ([]*Closure, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	cs := []*Closure{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&cs).
+		Where("cl.organization_id = ?", t.OrganizationID)
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	cs, page := api.PageOf(params, cs)
+	return cs, page, nil
+}
+
+// CreateClosure closes the shop for a time.
+func (s *Svc) CreateClosure(ctx context.Context, data CreateClosure) (*Closure, error) {
+	t := tenant.MustFromContext(ctx)
+
+	c := Closure{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		StartsAt:       data.StartsAt,
+		EndsAt:         data.EndsAt,
+		Reason:         trimmed(data.Reason),
+		CreatedBy:      &t.UserID,
+	}
+	_, err := tenant.DB(ctx, s.db).NewInsert().
+		Model(&c).
+		ExcludeColumn("created_at").
+		Returning("created_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteClosure deletes a closure.
+func (s *Svc) DeleteClosure(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	res, err := tenant.DB(ctx, s.db).NewDelete().
+		Model((*Closure)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, ErrClosureNotFound)
+}
+
+// timeZone gets the organization's time zone name.
+func timeZone(ctx context.Context, db bun.IDB, orgID uuid.UUID) (string, error) {
+	var tz string
+	err := db.NewSelect().
+		Table("organizations").
+		Column("time_zone").
+		Where("id = ?", orgID).
+		Scan(ctx, &tz)
+	return tz, err
+}
+
+// openingHours gets the organization's weekly schedule, by weekday and opening time.
+func openingHours(ctx context.Context, db bun.IDB, orgID uuid.UUID) ([]*OpeningHours, error) {
+	hours := []*OpeningHours{}
+	err := db.NewSelect().
+		Model(&hours).
+		Where("bh.organization_id = ?", orgID).
+		OrderExpr("bh.weekday ASC, bh.opens_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return hours, nil
+}
+
+// validTimeZone reports whether tz is an IANA time zone name the server knows.
+func validTimeZone(tz string) bool {
+	if tz == "" || strings.EqualFold(tz, "local") {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
@@ -17,6 +17,18 @@ const (
 	StatusCompleted Status = "completed"
 )
 
+// Valid reports whether s is a known appointment status.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPending, StatusConfirmed, StatusCancelled, StatusNoShow, StatusCompleted:
+		return true
+	}
+	return false
+}
+
+// Appointment is a booking of the shop's time for a customer. A confirmed appointment
+// holds its vehicle, bay and mechanic for [StartTime, EndTime): no other confirmed
+// appointment may use any of them in that time.
 type Appointment struct {
 	bun.BaseModel `bun:"table:appointments,alias:a"`
 
@@ -24,6 +36,8 @@ type Appointment struct {
 	OrganizationID uuid.UUID  `bun:"organization_id,notnull" json:"organization_id"`
 	CustomerID     uuid.UUID  `bun:"customer_id,notnull" json:"customer_id"`
 	VehicleID      *uuid.UUID `bun:"vehicle_id" json:"vehicle_id,omitempty"`
+	BayID          *uuid.UUID `bun:"bay_id" json:"bay_id,omitempty"`
+	MechanicID     *uuid.UUID `bun:"mechanic_id" json:"mechanic_id,omitempty"`
 	Title          string     `bun:"title,notnull" json:"title"`
 	Notes          *string    `bun:"notes" json:"notes,omitempty"`
 	Status         Status     `bun:"status,type:appointment_status,notnull,default:pending" json:"status"`
@@ -34,6 +48,45 @@ type Appointment struct {
 	UpdatedAt      time.Time  `bun:"updated_at,notnull,default:now()" json:"updated_at"`
 }
 
+// Bay is a service bay of the organization's shop. Inactive bays are kept for the
+// appointments booked in them but can't be booked anymore.
+type Bay struct {
+	bun.BaseModel `bun:"table:bays,alias:bay"`
+
+	ID             uuid.UUID `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `bun:"organization_id,notnull" json:"organization_id"`
+	Name           string    `bun:"name,notnull" json:"name"`
+	Active         bool      `bun:"active,notnull,default:true" json:"active"`
+	CreatedAt      time.Time `bun:"created_at,notnull,default:now()" json:"created_at"`
+	UpdatedAt      time.Time `bun:"updated_at,notnull,default:now()" json:"updated_at"`
+}
+
+// OpeningHours is a period the shop is open every week on Weekday (0 is Sunday),
+// between Opens and Closes in the organization's time zone. A day may have several,
+// e.g. around a lunch break.
+type OpeningHours struct {
+	bun.BaseModel `bun:"table:business_hours,alias:bh"`
+
+	ID             uuid.UUID `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `bun:"organization_id,notnull" json:"organization_id"`
+	Weekday        int       `bun:"weekday,notnull" json:"weekday"`
+	Opens          Clock     `bun:"opens_at,type:time,notnull" json:"opens"`
+	Closes         Clock     `bun:"closes_at,type:time,notnull" json:"closes"`
+}
+
+// Closure is a time the shop is closed despite its business hours, such as a holiday.
+type Closure struct {
+	bun.BaseModel `bun:"table:closures,alias:cl"`
+
+	ID             uuid.UUID  `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `bun:"organization_id,notnull" json:"organization_id"`
+	StartsAt       time.Time  `bun:"starts_at,notnull" json:"starts_at"`
+	EndsAt         time.Time  `bun:"ends_at,notnull" json:"ends_at"`
+	Reason         *string    `bun:"reason" json:"reason,omitempty"`
+	CreatedBy      *uuid.UUID `bun:"created_by" json:"created_by,omitempty"`
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
+}
+
 type AppointmentWorkOrder struct {
 	bun.BaseModel `bun:"table:appointment_work_orders,alias:awo"`
 
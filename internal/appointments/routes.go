@@ -0,0 +1,51 @@
+package appointments
+
+import (
+	"context"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the appointment, availability, bay, business hours and closure
+// endpoints. They are organization scoped: requests need the X-Org-Id header and a role
+// granting the endpoint's permission; tenancy authenticates the caller and scopes the
+// request to the organization (see middleware.Tenancy).
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, tenancy mwchain.Chain) {
+	ap := v1.PathPrefix("/appointments").Subrouter()
+	bays := v1.PathPrefix("/bays").Subrouter()
+	closures := v1.PathPrefix("/closures").Subrouter()
+	apLog := log.With().Str("route", "appointments").Logger()
+	apHandler := Handler(apLog, db)
+
+	scoped := mwchain.NewChain(middleware.Logger(apLog)).Extend(tenancy)
+	read := scoped.Append(middleware.RequirePermission(organizations.PermAppointmentsRead))
+	write := scoped.Append(middleware.RequirePermission(organizations.PermAppointmentsWrite))
+	del := scoped.Append(middleware.RequirePermission(organizations.PermAppointmentsDelete))
+	manage := scoped.Append(middleware.RequirePermission(organizations.PermOrganizationManage))
+
+	ap.Handle("", read.Then(apHandler.List())).Methods(api.GET)
+	ap.Handle("", write.Then(apHandler.Create())).Methods(api.POST)
+	ap.Handle("/availability", read.Then(apHandler.Availability())).Methods(api.GET)
+	ap.Handle("/{id}", read.Then(apHandler.ByID())).Methods(api.GET)
+	ap.Handle("/{id}", write.Then(apHandler.Update())).Methods(api.PATCH)
+	ap.Handle("/{id}", del.Then(apHandler.Delete())).Methods(api.DEL)
+	ap.Handle("/{id}/status", write.Then(apHandler.SetStatus())).Methods(api.PATCH)
+
+	bays.Handle("", read.Then(apHandler.Bays())).Methods(api.GET)
+	bays.Handle("", manage.Then(apHandler.CreateBay())).Methods(api.POST)
+	bays.Handle("/{id}", manage.Then(apHandler.UpdateBay())).Methods(api.PATCH)
+	bays.Handle("/{id}", manage.Then(apHandler.DeleteBay())).Methods(api.DEL)
+
+	v1.Handle("/business-hours", read.Then(apHandler.BusinessHours())).Methods(api.GET)
+	v1.Handle("/business-hours", manage.Then(apHandler.SetBusinessHours())).Methods(api.PUT)
+	closures.Handle("", read.Then(apHandler.Closures())).Methods(api.GET)
+	closures.Handle("", manage.Then(apHandler.CreateClosure())).Methods(api.POST)
+	closures.Handle("/{id}", manage.Then(apHandler.DeleteClosure())).Methods(api.DEL)
+}
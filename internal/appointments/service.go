@@ -0,0 +1,484 @@
+package appointments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrNotFound   = api.NotFound("appointment not found")
+	ErrClosed     = api.Conflict("appointment is completed, cancelled or a no-show")
+	ErrCompleted  = api.Conflict("completed appointments cannot be deleted")
+	ErrNotStarted = api.Conflict("appointment has not started yet")
+	ErrOverlap    = api.Conflict("appointment overlaps a confirmed appointment")
+
+	ErrBayNotFound     = api.NotFound("bay not found")
+	ErrClosureNotFound = api.NotFound("closure not found")
+)
+
+type s interface {
+	Create(ctx context.Context, data CreateAppointment) (*Appointment, error)
+	ByID(ctx context.Context, id uuid.UUID) (*Appointment, error)
+	List(ctx context.Context, params api.ListParams) ([]*Appointment, api.Page, error)
+	Update(ctx context.Context, id uuid.UUID, data UpdateAppointment) (*Appointment, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	SetStatus(ctx context.Context, id uuid.UUID, data ChangeStatus) (*Appointment, error)
+	Bays(ctx context.Context) ([]*Bay, error)
+	CreateBay(ctx context.Context, data CreateBay) (*Bay, error)
+	UpdateBay(ctx context.Context, id uuid.UUID, data UpdateBay) (*Bay, error)
+	DeleteBay(ctx context.Context, id uuid.UUID) error
+	Availability(ctx context.Context, q AvailabilityQuery) (*Availability, error)
+	BusinessHours(ctx context.Context) (*BusinessHours, error)
+	SetBusinessHours(ctx context.Context, data SetBusinessHours) (*BusinessHours, error)
+	Closures(ctx context.Context, params api.ListParams) ([]*Closure, api.Page, error)
+	CreateClosure(ctx context.Context, data CreateClosure) (*Closure, error)
+	DeleteClosure(ctx context.Context, id uuid.UUID) error
+}
+
+// Svc manages the appointments, bays and business hours of the request's organization. Every method
+// must run behind middleware.Tenancy: queries go through the request transaction
+// (tenant.DB) and are filtered by the tenant's organization.
+type Svc struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+var _ s = (*Svc)(nil)
+
+func Service(log zerolog.Logger, db *bun.DB) Svc {
+	return Svc{
+		db:  db,
+		log: log,
+	}
+}
+
+// ListSpec is the filters and sort orders accepted by GET /appointments. from and to
+// select the appointments overlapping a calendar range.
+var ListSpec = api.ListSpec{
+	Alias: "a",
+	Filters: []api.Filter{
+		{Param: "status", Column: "status", Parse: api.ParseEnum[Status]()},
+		{Param: "customer_id", Column: "customer_id", Parse: api.ParseUUID},
+		{Param: "vehicle_id", Column: "vehicle_id", Parse: api.ParseUUID},
+		{Param: "bay_id", Column: "bay_id", Parse: api.ParseUUID},
+		{Param: "mechanic_id", Column: "mechanic_id", Parse: api.ParseUUID},
+		{Param: "from", Column: "end_time", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "to", Column: "start_time", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:   []string{"start_time", "end_time", "created_at", "updated_at", "status"},
+	Default: "start_time",
+	Search:  []string{"title"},
+}
+
+// Create books an appointment, pending unless data.Status says confirmed.
+func (s *Svc) Create(ctx context.Context, data CreateAppointment) (*Appointment, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	a := Appointment{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		CustomerID:     data.CustomerID,
+		VehicleID:      data.VehicleID,
+		BayID:          data.BayID,
+		MechanicID:     data.MechanicID,
+		Title:          strings.TrimSpace(data.Title),
+		Notes:          trimmed(data.Notes),
+		Status:         StatusPending,
+		StartTime:      data.StartTime,
+		EndTime:        data.EndTime,
+		CreatedBy:      t.UserID,
+	}
+	if data.Status != nil {
+		a.Status = *data.Status
+	}
+
+	var fe api.FieldErrors
+	exists, err := db.NewSelect().
+		Table("customers").
+		Where("id = ?", a.CustomerID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		fe.Add("customer_id", "customer not found")
+	}
+	err = checkRefs(ctx, db, t.OrganizationID, a.CustomerID, a.VehicleID, a.BayID, a.MechanicID, &fe)
+	if err != nil {
+		return nil, err
+	}
+	if err := fe.Err(); err != nil {
+		return nil, err
+	}
+
+	err = checkConflicts(ctx, db, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewInsert().
+		Model(&a).
+		ExcludeColumn("created_at", "updated_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, a.ID)
+}
+
+// ByID gets an appointment.
+func (s *Svc) ByID(ctx context.Context, id uuid.UUID) (*Appointment, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var a Appointment
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&a).
+		Where("a.id = ?", id).
+		Where("a.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// List lists one page of appointments, see ListSpec.
+func (s *Svc) List(ctx context.Context, params api.ListParams) ([]*Appointment, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	as := []*Appointment{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&as).
+		Where("a.organization_id = ?", t.OrganizationID)
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	as, page := api.PageOf(params, as)
+	return as, page, nil
+}
+
+// Update changes an open appointment: its title, notes, time, vehicle, bay or mechanic.
+// The appointment is checked for conflicts again with its new values.
+func (s *Svc) Update(ctx context.Context, id uuid.UUID, data UpdateAppointment) (*Appointment, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	a, err := lockAppointment(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !a.Status.Open() {
+		return nil, ErrClosed
+	}
+
+	if data.Title != nil {
+		a.Title = strings.TrimSpace(*data.Title)
+	}
+	if data.Notes != nil {
+		a.Notes = trimmed(data.Notes)
+	}
+	if data.StartTime != nil {
+		a.StartTime = *data.StartTime
+	}
+	if data.EndTime != nil {
+		a.EndTime = *data.EndTime
+	}
+
+	var fe api.FieldErrors
+	if !a.EndTime.After(a.StartTime) {
+		fe.Add("end_time", "must be after start_time")
+	}
+
+	// Only the references being assigned are checked, so an appointment booked in a
+	// bay since deactivated can still be edited.
+	var vehicleID, bayID, mechanicID *uuid.UUID
+	a.VehicleID, vehicleID = assign(a.VehicleID, data.VehicleID)
+	a.BayID, bayID = assign(a.BayID, data.BayID)
+	a.MechanicID, mechanicID = assign(a.MechanicID, data.MechanicID)
+	err = checkRefs(ctx, db, t.OrganizationID, a.CustomerID, vehicleID, bayID, mechanicID, &fe)
+	if err != nil {
+		return nil, err
+	}
+	if err := fe.Err(); err != nil {
+		return nil, err
+	}
+
+	err = checkConflicts(ctx, db, a)
+	if err != nil {
+		return nil, err
+	}
+
+	a.UpdatedAt = time.Now()
+	_, err = db.NewUpdate().
+		Model(a).
+		Column("title", "notes", "start_time", "end_time", "vehicle_id", "bay_id", "mechanic_id", "updated_at").
+		Where("a.id = ?", id).
+		Where("a.organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// Delete deletes an appointment that is not completed.
+func (s *Svc) Delete(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	a, err := lockAppointment(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return err
+	}
+	if a.Status == StatusCompleted {
+		return ErrCompleted
+	}
+
+	_, err = db.NewDelete().
+		Model((*Appointment)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	return err
+}
+
+// TransitionDetails is the error detail of a rejected status change.
+type TransitionDetails struct {
+	From    Status   `json:"from"`
+	To      Status   `json:"to"`
+	Allowed []Status `json:"allowed"`
+}
+
+// SetStatus moves an appointment through the state machine. Confirming checks it for
+// conflicts; it can only be completed or marked a no-show once it has started.
+func (s *Svc) SetStatus(ctx context.Context, id uuid.UUID, data ChangeStatus) (*Appointment, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	a, err := lockAppointment(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	details := TransitionDetails{From: a.Status, To: data.Status, Allowed: a.Status.Transitions()}
+	if data.FromStatus != nil && *data.FromStatus != a.Status {
+		return nil, api.PreconditionFailed("appointment status has changed").WithDetails(details)
+	}
+	if !a.Status.CanTransition(data.Status) {
+		return nil, api.Conflict(fmt.Sprintf("appointment cannot move from %s to %s", a.Status, data.Status)).
+			WithDetails(details)
+	}
+
+	now := time.Now()
+	switch data.Status {
+	case StatusConfirmed:
+		err = checkConflicts(ctx, db, a)
+		if err != nil {
+			return nil, err
+		}
+	case StatusCompleted, StatusNoShow:
+		if now.Before(a.StartTime) {
+			return nil, ErrNotStarted
+		}
+	}
+
+	_, err = db.NewUpdate().
+		Model((*Appointment)(nil)).
+		Set("status = ?", data.Status).
+		Set("updated_at = ?", now).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// Conflict is a confirmed appointment overlapping another one, with what they share:
+// "vehicle", "bay" and/or "mechanic".
+type Conflict struct {
+	AppointmentID uuid.UUID `json:"appointment_id"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	On            []string  `json:"on"`
+}
+
+// checkConflicts returns ErrOverlap, with the conflicts as details, when an open
+// appointment shares its vehicle, bay or mechanic with a confirmed appointment at the
+// same time. Pending appointments don't hold their time: they may overlap each other
+// until one is confirmed. Two confirmed appointments overlapping concurrently are also
+// rejected by the database's exclusion constraints.
+func checkConflicts(ctx context.Context, db bun.IDB, a *Appointment) error {
+	if !a.Status.Open() || (a.VehicleID == nil && a.BayID == nil && a.MechanicID == nil) {
+		return nil
+	}
+
+	var others []*Appointment
+	err := db.NewSelect().
+		Model(&others).
+		Where("a.organization_id = ?", a.OrganizationID).
+		Where("a.id <> ?", a.ID).
+		Where("a.status = ?", StatusConfirmed).
+		Where("a.start_time < ?", a.EndTime).
+		Where("a.end_time > ?", a.StartTime).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			if a.VehicleID != nil {
+				q = q.WhereOr("a.vehicle_id = ?", *a.VehicleID)
+			}
+			if a.BayID != nil {
+				q = q.WhereOr("a.bay_id = ?", *a.BayID)
+			}
+			if a.MechanicID != nil {
+				q = q.WhereOr("a.mechanic_id = ?", *a.MechanicID)
+			}
+			return q
+		}).
+		OrderExpr("a.start_time ASC").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	if len(others) == 0 {
+		return nil
+	}
+
+	conflicts := make([]*Conflict, 0, len(others))
+	for _, o := range others {
+		c := &Conflict{AppointmentID: o.ID, StartTime: o.StartTime, EndTime: o.EndTime, On: []string{}}
+		if same(a.VehicleID, o.VehicleID) {
+			c.On = append(c.On, "vehicle")
+		}
+		if same(a.BayID, o.BayID) {
+			c.On = append(c.On, "bay")
+		}
+		if same(a.MechanicID, o.MechanicID) {
+			c.On = append(c.On, "mechanic")
+		}
+		conflicts = append(conflicts, c)
+	}
+	return ErrOverlap.WithDetails(conflicts)
+}
+
+// checkRefs adds a field error for each reference that is set but can't be booked: a
+// vehicle not of the customer, a bay not found or inactive, or a mechanic who is not a
+// member of the organization.
+func checkRefs(ctx context.Context, db bun.IDB, orgID, customerID uuid.UUID, vehicleID, bayID, mechanicID *uuid.UUID, fe *api.FieldErrors) error {
+	if vehicleID != nil {
+		exists, err := db.NewSelect().
+			Table("vehicles").
+			Where("id = ?", *vehicleID).
+			Where("customer_id = ?", customerID).
+			Where("organization_id = ?", orgID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fe.Add("vehicle_id", "vehicle not found for this customer")
+		}
+	}
+
+	if bayID != nil {
+		var active bool
+		err := db.NewSelect().
+			Model((*Bay)(nil)).
+			Column("active").
+			Where("bay.id = ?", *bayID).
+			Where("bay.organization_id = ?", orgID).
+			Scan(ctx, &active)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			fe.Add("bay_id", "bay not found")
+		case err != nil:
+			return err
+		case !active:
+			fe.Add("bay_id", "bay is inactive")
+		}
+	}
+
+	if mechanicID != nil {
+		exists, err := db.NewSelect().
+			Table("organization_members").
+			Where("user_id = ?", *mechanicID).
+			Where("organization_id = ?", orgID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fe.Add("mechanic_id", "mechanic is not a member of the organization")
+		}
+	}
+	return nil
+}
+
+// assign applies an update of an optional reference: nil keeps current and the nil
+// UUID clears it. It returns the new value and, when one is being assigned, the id to
+// check.
+func assign(current, update *uuid.UUID) (*uuid.UUID, *uuid.UUID) {
+	switch {
+	case update == nil:
+		return current, nil
+	case *update == uuid.Nil:
+		return nil, nil
+	case same(current, update):
+		return current, nil
+	}
+	return update, update
+}
+
+func same(a, b *uuid.UUID) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+func lockAppointment(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) (*Appointment, error) {
+	var a Appointment
+	err := db.NewSelect().
+		Model(&a).
+		Where("a.id = ?", id).
+		Where("a.organization_id = ?", orgID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// trimmed trims an optional text, nil when empty.
+func trimmed(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	s := strings.TrimSpace(*v)
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,36 @@
+package appointments
+
+// transitions is the appointment state machine: the statuses each status may move to.
+// The usual path is pending → confirmed → completed.
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCompleted, StatusCancelled, StatusNoShow},
+	StatusCompleted: {},
+	StatusCancelled: {},
+	StatusNoShow:    {},
+}
+
+// Terminal reports whether no transition leaves s.
+func (s Status) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Transitions lists the statuses an appointment in s may move to.
+func (s Status) Transitions() []Status {
+	return append([]Status{}, transitions[s]...)
+}
+
+// CanTransition reports whether the state machine allows moving from s to to.
+func (s Status) CanTransition(to Status) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether an appointment in s is still to take place.
+func (s Status) Open() bool {
+	return s == StatusPending || s == StatusConfirmed
+}
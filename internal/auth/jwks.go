@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrKeyNotFound     = errors.New("signing key not found")
+	ErrKeyAlgMismatch  = errors.New("signing key algorithm mismatch")
+	ErrNoKeySetSource  = errors.New("jwks: neither url nor file is configured")
+	ErrUnsupportedKey  = errors.New("jwks: unsupported key")
+	errJWKSBadResponse = errors.New("jwks: unexpected response status")
+)
+
+const (
+	// minMissRefresh throttles refreshes triggered by unknown key ids, so a
+	// flood of tokens with bogus kids can't hammer the JWKS endpoint.
+	minMissRefresh = time.Minute
+	// maxJWKSSize caps the size of a JWKS document.
+	maxJWKSSize = 1 << 20
+)
+
+// KeySetOptions configures where a KeySet loads its keys from.
+// URL takes precedence over File when both are set.
+type KeySetOptions struct {
+	URL             string
+	File            string
+	RefreshInterval time.Duration
+	Client          *http.Client
+	// Log receives refresh failures and skipped keys.
+	Log zerolog.Logger
+}
+
+// KeySet is a cached JSON Web Key Set used to verify asymmetric JWTs
+// (RS256/ES256/EdDSA). Keys are refreshed in the background and on demand
+// when a token references an unknown key id (key rotation).
+type KeySet struct {
+	opts KeySetOptions
+
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	attemptedAt time.Time
+
+	refreshMu sync.Mutex
+}
+
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// NewKeySet returns an empty KeySet; call Refresh or Start to load it.
+func NewKeySet(opts KeySetOptions) *KeySet {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 15 * time.Minute
+	}
+
+	return &KeySet{
+		opts: opts,
+		keys: map[string]publicKey{},
+	}
+}
+
+// keySource identifies the shared key set of a configuration.
+type keySource struct {
+	url, file       string
+	refreshInterval time.Duration
+	client          *http.Client
+}
+
+var (
+	sharedMu   sync.Mutex
+	sharedSets = map[keySource]*KeySet{}
+)
+
+// SharedKeySet returns a process-wide KeySet for opts, loading it and starting
+// its background refresh the first time it is requested. Every middleware
+// built from the same configuration shares the same cache.
+func SharedKeySet(opts KeySetOptions) *KeySet {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	src := keySource{opts.URL, opts.File, opts.RefreshInterval, opts.Client}
+	if ks, ok := sharedSets[src]; ok {
+		return ks
+	}
+
+	ks := NewKeySet(opts)
+	if err := ks.Refresh(context.Background()); err != nil {
+		// Not fatal: the next token will trigger another attempt.
+		ks.opts.Log.Error().Err(err).Msg("failed to load jwks")
+	}
+	ks.Start(context.Background())
+
+	sharedSets[src] = ks
+	return ks
+}
+
+// Start refreshes the key set every RefreshInterval until ctx is done.
+func (ks *KeySet) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(ks.opts.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ks.Refresh(ctx); err != nil {
+					// Keep serving the cached keys until the source recovers.
+					ks.opts.Log.Error().Err(err).Msg("failed to refresh jwks")
+				}
+			}
+		}
+	}()
+}
+
+// Key returns the public key for kid. An unknown kid triggers a throttled
+// refresh before giving up, so freshly rotated keys are picked up without
+// waiting for the next scheduled refresh. When the token has no kid and the
+// set holds a single key, that key is used. alg is checked against the key's
+// declared algorithm when the JWK has one.
+func (ks *KeySet) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	pk, ok := ks.lookup(kid)
+	if !ok && ks.canRefreshOnMiss() {
+		if err := ks.Refresh(ctx); err != nil {
+			ks.opts.Log.Error().Err(err).Str("kid", kid).Msg("failed to refresh jwks on key miss")
+		}
+		pk, ok = ks.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+	}
+
+	if pk.alg != "" && alg != "" && pk.alg != alg {
+		return nil, fmt.Errorf("%w: key %q is %s, token is %s", ErrKeyAlgMismatch, kid, pk.alg, alg)
+	}
+
+	return pk.key, nil
+}
+
+func (ks *KeySet) lookup(kid string) (publicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, pk := range ks.keys {
+			return pk, true
+		}
+	}
+
+	pk, ok := ks.keys[kid]
+	return pk, ok
+}
+
+func (ks *KeySet) canRefreshOnMiss() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return time.Since(ks.attemptedAt) >= minMissRefresh
+}
+
+// Refresh reloads the key set from its source. On failure the previously
+// cached keys are kept.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	ks.refreshMu.Lock()
+	defer ks.refreshMu.Unlock()
+
+	ks.mu.Lock()
+	ks.attemptedAt = time.Now()
+	ks.mu.Unlock()
+
+	raw, err := ks.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(ks.opts.Log, raw)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	switch {
+	case ks.opts.URL != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.opts.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		res, err := ks.opts.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%w: %s", errJWKSBadResponse, res.Status)
+		}
+
+		return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+	case ks.opts.File != "":
+		return os.ReadFile(ks.opts.File)
+	default:
+		return nil, ErrNoKeySetSource
+	}
+}
+
+// parseJWKS decodes a JWKS document, skipping keys that are not meant for
+// signatures or whose type is not supported.
+func parseJWKS(log zerolog.Logger, raw []byte) (map[string]publicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Msg("skipping jwk")
+			continue
+		}
+
+		keys[k.Kid] = publicKey{alg: k.Alg, key: key}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no usable signing keys", ErrUnsupportedKey)
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: invalid rsa exponent", ErrUnsupportedKey)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, k.Crv)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := decodeFixed(k.X, size)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeFixed(k.Y, size)
+		if err != nil {
+			return nil, err
+		}
+
+		point := append([]byte{4}, append(x, y...)...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid ed25519 key size", ErrUnsupportedKey)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: kty %q", ErrUnsupportedKey, k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// decodeFixed decodes a base64url coordinate, left-padding it to size bytes.
+func decodeFixed(s string, size int) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > size {
+		return nil, fmt.Errorf("%w: coordinate too long", ErrUnsupportedKey)
+	}
+	out := make([]byte, size)
+	copy(out[size-len(b):], b)
+	return out, nil
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PublicKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rk, ec: ek, ed: edPub}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) jwk {
+	return jwk{Kty: "RSA", Kid: kid, Use: "sig", Alg: "RS256", N: b64(k.N.Bytes()), E: b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PrivateKey) jwk {
+	point, err := k.PublicKey.Bytes() // 0x04 || X || Y
+	if err != nil {
+		panic(err)
+	}
+	size := (len(point) - 1) / 2
+	return jwk{Kty: "EC", Kid: kid, Use: "sig", Alg: "ES256", Crv: "P-256", X: b64(point[1 : 1+size]), Y: b64(point[1+size:])}
+}
+
+func edJWK(kid string, k ed25519.PublicKey) jwk {
+	return jwk{Kty: "OKP", Kid: kid, Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: b64(k)}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...jwk) {
+	t.Helper()
+
+	raw, err := json.Marshal(jwks{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newFileKeySet returns a KeySet loaded from a JWKS file holding keys.
+func newFileKeySet(t *testing.T, keys ...jwk) (*KeySet, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys...)
+
+	ks := NewKeySet(KeySetOptions{File: path})
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return ks, path
+}
+
+// allowMissRefresh moves the last refresh attempt back past the throttle.
+func allowMissRefresh(ks *KeySet) {
+	ks.mu.Lock()
+	ks.attemptedAt = time.Now().Add(-2 * minMissRefresh)
+	ks.mu.Unlock()
+}
+
+func TestKeySetSelectsKeyByKid(t *testing.T) {
+	k := newTestKeys(t)
+	ks, _ := newFileKeySet(t, rsaJWK("rsa", &k.rsa.PublicKey), ecJWK("ec", k.ec), edJWK("ed", k.ed))
+	ctx := context.Background()
+
+	tests := []struct {
+		kid, alg string
+		want     interface{ Equal(crypto.PublicKey) bool }
+	}{
+		{"rsa", "RS256", &k.rsa.PublicKey},
+		{"ec", "ES256", &k.ec.PublicKey},
+		{"ed", "EdDSA", k.ed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kid, func(t *testing.T) {
+			got, err := ks.Key(ctx, tt.kid, tt.alg)
+			if err != nil {
+				t.Fatalf("Key(%q): %v", tt.kid, err)
+			}
+			if !tt.want.Equal(got) {
+				t.Fatalf("Key(%q) returned another key", tt.kid)
+			}
+		})
+	}
+
+	// Without a kid the only key of a single-key set is used.
+	single, _ := newFileKeySet(t, edJWK("only", k.ed))
+	got, err := single.Key(ctx, "", "EdDSA")
+	if err != nil || !k.ed.Equal(got) {
+		t.Fatalf("Key without kid = %v, %v", got, err)
+	}
+}
+
+func TestKeySetRejectsAlgMismatch(t *testing.T) {
+	k := newTestKeys(t)
+	ks, _ := newFileKeySet(t, rsaJWK("rsa", &k.rsa.PublicKey), ecJWK("ec", k.ec))
+
+	for _, tt := range []struct{ kid, alg string }{{"rsa", "ES256"}, {"ec", "RS256"}, {"rsa", "HS256"}} {
+		_, err := ks.Key(context.Background(), tt.kid, tt.alg)
+		if !errors.Is(err, ErrKeyAlgMismatch) {
+			t.Errorf("Key(%q, %q) error = %v, want ErrKeyAlgMismatch", tt.kid, tt.alg, err)
+		}
+	}
+}
+
+func TestKeySetUnknownKidRefreshIsThrottled(t *testing.T) {
+	k := newTestKeys(t)
+	ks, path := newFileKeySet(t, rsaJWK("old", &k.rsa.PublicKey))
+	ctx := context.Background()
+
+	writeJWKS(t, path, rsaJWK("old", &k.rsa.PublicKey), ecJWK("new", k.ec))
+
+	// The set was just loaded: the miss must not hit the source again.
+	if _, err := ks.Key(ctx, "new", "ES256"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("throttled miss error = %v, want ErrKeyNotFound", err)
+	}
+
+	allowMissRefresh(ks)
+	got, err := ks.Key(ctx, "new", "ES256")
+	if err != nil {
+		t.Fatalf("miss after throttle: %v", err)
+	}
+	if !k.ec.PublicKey.Equal(got) {
+		t.Fatal("miss after throttle returned another key")
+	}
+
+	// That refresh starts a new throttle window.
+	writeJWKS(t, path, ecJWK("newer", k.ec))
+	if _, err := ks.Key(ctx, "newer", "ES256"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("second miss error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	k := newTestKeys(t)
+	ks, path := newFileKeySet(t, rsaJWK("2024", &k.rsa.PublicKey))
+	ctx := context.Background()
+
+	writeJWKS(t, path, edJWK("2025", k.ed))
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ks.Key(ctx, "2024", "RS256"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("retired key error = %v, want ErrKeyNotFound", err)
+	}
+	got, err := ks.Key(ctx, "2025", "EdDSA")
+	if err != nil || !k.ed.Equal(got) {
+		t.Fatalf("rotated key = %v, %v", got, err)
+	}
+
+	// A failed refresh keeps serving the cached keys.
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Refresh(ctx); err == nil {
+		t.Fatal("Refresh of a broken file succeeded")
+	}
+	if _, err := ks.Key(ctx, "2025", "EdDSA"); err != nil {
+		t.Fatalf("cached key after failed refresh: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMissingSubject   = errors.New("token has no subject")
+	ErrMissingPrincipal = errors.New("no principal in context")
+)
+
+// Principal is the verified caller of a request, built from the JWT claims.
+// UserID is the internal users.User id, set once middleware.Provision has run.
+type Principal struct {
+	Subject     string        `json:"subject"`
+	Email       string        `json:"email,omitempty"`
+	StackUserID string        `json:"stack_user_id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+	Claims      jwt.MapClaims `json:"-"`
+}
+
+type principalKey struct{}
+
+// NewPrincipal builds a Principal out of already verified claims.
+// Stack Auth puts its user id in the "sub" claim.
+func NewPrincipal(claims jwt.MapClaims) (*Principal, error) {
+	sub, err := claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	if sub == "" {
+		return nil, ErrMissingSubject
+	}
+
+	p := &Principal{
+		Subject:     sub,
+		StackUserID: sub,
+		Claims:      claims,
+	}
+
+	if email, ok := claims["email"].(string); ok {
+		p.Email = email
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return nil, err
+	}
+	if exp != nil {
+		p.ExpiresAt = exp.Time
+	}
+
+	return p, nil
+}
+
+// Claim returns a string claim, or "" when it is missing or not a string.
+func (p *Principal) Claim(name string) string {
+	v, _ := p.Claims[name].(string)
+	return v
+}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by the auth middleware, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// MustFromContext returns the principal or panics; use it only behind middleware.Auth.
+func MustFromContext(ctx context.Context) *Principal {
+	p, ok := FromContext(ctx)
+	if !ok {
+		panic(ErrMissingPrincipal)
+	}
+	return p
+}
@@ -0,0 +1,422 @@
+package customers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
+)
+
+type h interface {
+	Create() http.HandlerFunc
+	ByID() http.HandlerFunc
+	List() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Duplicates() http.HandlerFunc
+	Merge() http.HandlerFunc
+}
+
+type pnh interface {
+	Add() http.HandlerFunc
+	List() http.HandlerFunc
+	ByID() http.HandlerFunc
+	Update() http.HandlerFunc
+	Remove() http.HandlerFunc
+	SetPrimary() http.HandlerFunc
+}
+
+type Hdlr struct {
+	db  *bun.DB
+	log zerolog.Logger
+	svc Svc
+}
+
+type PhoneNumberHdlr struct {
+	db  *bun.DB
+	log zerolog.Logger
+	svc PhoneNumberSvc
+}
+
+var _ h = (*Hdlr)(nil)
+var _ pnh = (*PhoneNumberHdlr)(nil)
+
+func Handler(log zerolog.Logger, db *bun.DB) Hdlr {
+	svc := Service(log, db)
+	return Hdlr{db, log, svc}
+}
+
+func PhoneNumberHandler(log zerolog.Logger, db *bun.DB) PhoneNumberHdlr {
+	svc := PhoneNumberService(log, db)
+	return PhoneNumberHdlr{db, log, svc}
+}
+
+// CreateCustomer is the body of POST /customers. Phone numbers are optional.
+type CreateCustomer struct {
+	FullName     string           `json:"full_name" validate:"required,max=200"`
+	Email        *string          `json:"email,omitempty" validate:"email,max=254"`
+	Notes        *string          `json:"notes,omitempty" validate:"max=5000"`
+	PhoneNumbers []AddPhoneNumber `json:"phone_numbers,omitempty" validate:"max=10"`
+}
+
+// UpdateCustomer holds the fields PATCH /customers/{id} may change; nil fields are left
+// untouched and an empty email or notes clears it.
+type UpdateCustomer struct {
+	FullName *string `json:"full_name,omitempty" validate:"min=1,max=200"`
+	Email    *string `json:"email,omitempty" validate:"email,max=254"`
+	Notes    *string `json:"notes,omitempty" validate:"max=5000"`
+}
+
+// MergeCustomer is the body of POST /customers/{id}/merge: the customer merged into
+// {id} and then deleted.
+type MergeCustomer struct {
+	SourceID uuid.UUID `json:"source_id" validate:"required"`
+}
+
+// AddPhoneNumber is the body of POST /customers/{id}/phone-numbers and PATCH
+// /customers/{id}/phone-numbers/{pnID}. Number is free-form; CountryCode is only needed
+// when Number has no international prefix.
+type AddPhoneNumber struct {
+	CountryCode string `json:"country_code" validate:"max=5"`
+	Number      string `json:"number" validate:"required,max=32"`
+	IsPrimary   bool   `json:"is_primary"`
+}
+
+// Create adds a customer, optionally with its phone numbers.
+func (h *Hdlr) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreateCustomer](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		c, err := h.svc.Create(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating customer")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Customer](w, http.StatusCreated, c)
+	}
+}
+
+// ByID gets a customer with its phone numbers.
+func (h *Hdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		c, err := h.svc.ByID(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting customer")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Customer](w, http.StatusOK, c)
+	}
+}
+
+// List lists or searches the organization's customers, see ListSpec.
+func (h *Hdlr) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, ListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		customers, page, err := h.svc.List(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing customers")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*Customer](w, http.StatusOK, customers, page)
+	}
+}
+
+// Update changes the name, email or notes of a customer.
+func (h *Hdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateCustomer](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		c, err := h.svc.Update(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating customer")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Customer](w, http.StatusOK, c)
+	}
+}
+
+// Delete deletes a customer.
+func (h *Hdlr) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		err := h.svc.Delete(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting customer")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Duplicate listing limits.
+const (
+	defaultDuplicates = 50
+	maxDuplicates     = 200
+)
+
+// Duplicates lists likely duplicate customers, optionally of one ?customer_id=, up to
+// ?limit= pairs.
+func (h *Hdlr) Duplicates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var fe api.FieldErrors
+		q := r.URL.Query()
+
+		var of *uuid.UUID
+		if raw := q.Get("customer_id"); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				fe.Add("customer_id", "must be a UUID")
+			}
+			of = &id
+		}
+
+		limit := defaultDuplicates
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxDuplicates {
+				fe.Add("limit", "must be a number between 1 and %d", maxDuplicates)
+			}
+			limit = n
+		}
+
+		if len(fe) > 0 {
+			api.WriteError(w, api.Validation("invalid query parameters", fe...))
+			return
+		}
+
+		duplicates, err := h.svc.Duplicates(r.Context(), of, limit)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error finding duplicate customers")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]Duplicate](w, http.StatusOK, duplicates)
+	}
+}
+
+// Merge merges another customer into this one.
+func (h *Hdlr) Merge() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[MergeCustomer](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		merged, err := h.svc.Merge(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error merging customers")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Merged](w, http.StatusOK, merged)
+	}
+}
+
+// Add links a phone number to a customer.
+func (p *PhoneNumberHdlr) Add() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[AddPhoneNumber](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		cpn, err := p.svc.Add(r.Context(), id, data)
+		if err != nil {
+			p.phoneNumberError(w, err, "error adding customer phone number")
+			return
+		}
+
+		api.Success[*CustomerPhoneNumber](w, http.StatusCreated, cpn)
+	}
+}
+
+// List lists a customer's phone numbers, primary first.
+func (p *PhoneNumberHdlr) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := customerID(w, r)
+		if !ok {
+			return
+		}
+
+		cpns, err := p.svc.List(r.Context(), id)
+		if err != nil {
+			p.phoneNumberError(w, err, "error listing customer phone numbers")
+			return
+		}
+
+		api.Success[[]*CustomerPhoneNumber](w, http.StatusOK, cpns)
+	}
+}
+
+// ByID gets one of a customer's phone numbers.
+func (p *PhoneNumberHdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, pnID, ok := phoneNumberIDs(w, r)
+		if !ok {
+			return
+		}
+
+		cpn, err := p.svc.ByID(r.Context(), id, pnID)
+		if err != nil {
+			p.phoneNumberError(w, err, "error getting customer phone number")
+			return
+		}
+
+		api.Success[*CustomerPhoneNumber](w, http.StatusOK, cpn)
+	}
+}
+
+// Update changes the number behind one of a customer's phone numbers.
+func (p *PhoneNumberHdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, pnID, ok := phoneNumberIDs(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[AddPhoneNumber](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		cpn, err := p.svc.Update(r.Context(), id, pnID, data)
+		if err != nil {
+			p.phoneNumberError(w, err, "error updating customer phone number")
+			return
+		}
+
+		api.Success[*CustomerPhoneNumber](w, http.StatusOK, cpn)
+	}
+}
+
+// Remove unlinks one of a customer's phone numbers.
+func (p *PhoneNumberHdlr) Remove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, pnID, ok := phoneNumberIDs(w, r)
+		if !ok {
+			return
+		}
+
+		err := p.svc.Remove(r.Context(), id, pnID)
+		if err != nil {
+			p.phoneNumberError(w, err, "error removing customer phone number")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetPrimary makes one of a customer's phone numbers the primary one.
+func (p *PhoneNumberHdlr) SetPrimary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, pnID, ok := phoneNumberIDs(w, r)
+		if !ok {
+			return
+		}
+
+		cpn, err := p.svc.SetPrimary(r.Context(), id, pnID)
+		if err != nil {
+			p.phoneNumberError(w, err, "error setting customer primary phone number")
+			return
+		}
+
+		api.Success[*CustomerPhoneNumber](w, http.StatusOK, cpn)
+	}
+}
+
+func (p *PhoneNumberHdlr) phoneNumberError(w http.ResponseWriter, err error, msg string) {
+	var parseErr *phonenumbers.ParseError
+	if errors.As(err, &parseErr) {
+		err = api.Validation("invalid phone number", api.FieldError{
+			Field:   parseErr.Field,
+			Message: parseErr.Err.Error(),
+		}).Wrap(err)
+	}
+
+	p.log.Debug().Err(err).Msg(msg)
+	api.WriteError(w, err)
+}
+
+func customerID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid customer id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// phoneNumberIDs reads the {id} and {pnID} path variables.
+func phoneNumberIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	id, ok := customerID(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	pnID, err := uuid.Parse(mux.Vars(r)["pnID"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid phone number id"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, pnID, true
+}
@@ -0,0 +1,323 @@
+package customers
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// DuplicateReason is why two customers look like the same person.
+type DuplicateReason string
+
+const (
+	DuplicateEmail DuplicateReason = "email" // same normalized email
+	DuplicatePhone DuplicateReason = "phone" // a shared E.164 phone number
+	DuplicateName  DuplicateReason = "name"  // similar names
+)
+
+// nameSimilarity is the pg_trgm similarity from which names count as a match.
+const nameSimilarity = 0.6
+
+// Duplicate is a pair of customers that are likely the same person.
+type Duplicate struct {
+	Customer       *Customer         `json:"customer"`
+	Duplicate      *Customer         `json:"duplicate"`
+	Reasons        []DuplicateReason `json:"reasons"`
+	NameSimilarity float64           `json:"name_similarity"`
+}
+
+// Merge is the audit entry of a customer merged into another one. Source is the merged
+// customer, with its phone numbers, as it was before being deleted.
+type Merge struct {
+	bun.BaseModel `bun:"table:customer_merges,alias:cm"`
+
+	ID               uuid.UUID   `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID   uuid.UUID   `bun:"organization_id,notnull" json:"organization_id"`
+	TargetCustomerID *uuid.UUID  `bun:"target_customer_id" json:"target_customer_id,omitempty"`
+	SourceCustomerID uuid.UUID   `bun:"source_customer_id,notnull" json:"source_customer_id"`
+	Source           Customer    `bun:"source,type:jsonb,notnull" json:"source"`
+	Moved            MergeCounts `bun:"moved,type:jsonb,notnull" json:"moved"`
+	MergedBy         *uuid.UUID  `bun:"merged_by" json:"merged_by,omitempty"`
+	MergedAt         time.Time   `bun:"merged_at,notnull,default:now()" json:"merged_at"`
+}
+
+// MergeCounts is how many rows a merge moved to the surviving customer.
+type MergeCounts struct {
+	Vehicles         int64 `json:"vehicles"`
+	Appointments     int64 `json:"appointments"`
+	WorkOrders       int64 `json:"work_orders"`
+	NotificationLogs int64 `json:"notification_logs"`
+	PhoneNumbers     int64 `json:"phone_numbers"`
+	Ownerships       int64 `json:"vehicle_ownerships"`
+}
+
+// Merged is the result of a merge: the surviving customer and the audit entry.
+type Merged struct {
+	Customer *Customer `json:"customer"`
+	Merge    *Merge    `json:"merge"`
+}
+
+// duplicatePair is a row of the duplicates query.
+type duplicatePair struct {
+	CustomerID     uuid.UUID `bun:"customer_id"`
+	DuplicateID    uuid.UUID `bun:"duplicate_id"`
+	SameEmail      bool      `bun:"same_email"`
+	SharedPhone    bool      `bun:"shared_phone"`
+	NameSimilarity float64   `bun:"name_similarity"`
+}
+
+// Duplicates finds pairs of the organization's customers that are likely the same
+// person, strongest first: same email, then a shared phone number, then name
+// similarity. With customerID only that customer's duplicates are listed.
+func (s *Svc) Duplicates(ctx context.Context, customerID *uuid.UUID, limit int) ([]Duplicate, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	const (
+		sameEmail   = "coalesce(app.normalize_email(a.email) = app.normalize_email(b.email), FALSE)"
+		sharedPhone = `EXISTS (
+			SELECT 1 FROM customer_phone_numbers AS pa
+			JOIN customer_phone_numbers AS pb ON pb.phone_number_id = pa.phone_number_id
+			WHERE pa.customer_id = a.id AND pb.customer_id = b.id)`
+		similarity = "similarity(lower(a.full_name), lower(b.full_name))"
+	)
+
+	q := db.NewSelect().
+		TableExpr("customers AS a").
+		Join("JOIN customers AS b ON b.organization_id = a.organization_id AND b.id <> a.id").
+		ColumnExpr("a.id AS customer_id").
+		ColumnExpr("b.id AS duplicate_id").
+		ColumnExpr(sameEmail+" AS same_email").
+		ColumnExpr(sharedPhone+" AS shared_phone").
+		ColumnExpr(similarity+" AS name_similarity").
+		Where("a.organization_id = ?", t.OrganizationID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			// % narrows the pairs with the trigram index before the stricter threshold.
+			return q.
+				Where(sameEmail).
+				WhereOr(sharedPhone).
+				WhereOr("lower(a.full_name) % lower(b.full_name) AND "+similarity+" >= ?", nameSimilarity)
+		}).
+		OrderExpr("same_email DESC, shared_phone DESC, name_similarity DESC, a.id, b.id").
+		Limit(limit)
+
+	if customerID != nil {
+		err := checkCustomer(ctx, db, t.OrganizationID, *customerID)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("a.id = ?", *customerID)
+	} else {
+		// Each pair once.
+		q = q.Where("a.id < b.id")
+	}
+
+	pairs := []duplicatePair{}
+	err := q.Scan(ctx, &pairs)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return []Duplicate{}, nil
+	}
+
+	ids := make([]uuid.UUID, 0, 2*len(pairs))
+	for _, p := range pairs {
+		ids = append(ids, p.CustomerID, p.DuplicateID)
+	}
+
+	customers := []*Customer{}
+	err = db.NewSelect().
+		Model(&customers).
+		Where("c.id IN (?)", bun.In(ids)).
+		Where("c.organization_id = ?", t.OrganizationID).
+		Relation("PhoneNumbers", orderPhoneNumbers).
+		Relation("PhoneNumbers.PhoneNumber").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*Customer, len(customers))
+	for _, c := range customers {
+		byID[c.ID] = c
+	}
+
+	duplicates := make([]Duplicate, len(pairs))
+	for i, p := range pairs {
+		d := Duplicate{
+			Customer:       byID[p.CustomerID],
+			Duplicate:      byID[p.DuplicateID],
+			Reasons:        []DuplicateReason{},
+			NameSimilarity: p.NameSimilarity,
+		}
+		if p.SameEmail {
+			d.Reasons = append(d.Reasons, DuplicateEmail)
+		}
+		if p.SharedPhone {
+			d.Reasons = append(d.Reasons, DuplicatePhone)
+		}
+		if p.NameSimilarity >= nameSimilarity {
+			d.Reasons = append(d.Reasons, DuplicateName)
+		}
+		duplicates[i] = d
+	}
+	return duplicates, nil
+}
+
+// Merge merges the source customer into the target: vehicles, appointments, work
+// orders, notification logs and phone numbers move to the target, which keeps its own
+// name and takes the source's email and notes only where it has none. The source is
+// then deleted and the merge recorded, all in the request transaction.
+func (s *Svc) Merge(ctx context.Context, targetID uuid.UUID, data MergeCustomer) (*Merged, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	if data.SourceID == targetID {
+		return nil, api.Validation("request validation failed", api.FieldError{
+			Field:   "source_id",
+			Message: "cannot merge a customer into itself",
+		})
+	}
+
+	// Lock both, in id order so concurrent merges of the same pair can't deadlock.
+	locked := []*Customer{}
+	err := db.NewSelect().
+		Model(&locked).
+		Where("c.id IN (?)", bun.In([]uuid.UUID{targetID, data.SourceID})).
+		Where("c.organization_id = ?", t.OrganizationID).
+		OrderExpr("c.id").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var target, source *Customer
+	for _, c := range locked {
+		if c.ID == targetID {
+			target = c
+		} else {
+			source = c
+		}
+	}
+	if target == nil {
+		return nil, ErrNotFound
+	}
+	if source == nil {
+		return nil, api.Validation("request validation failed", api.FieldError{
+			Field:   "source_id",
+			Message: "customer not found",
+		})
+	}
+
+	// Snapshot the source with its phone numbers for the audit entry.
+	snapshot, err := s.ByID(ctx, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var moved MergeCounts
+	for _, m := range []struct {
+		table string
+		count *int64
+	}{
+		{"vehicles", &moved.Vehicles},
+		{"appointments", &moved.Appointments},
+		{"work_orders", &moved.WorkOrders},
+		{"notification_logs", &moved.NotificationLogs},
+		{"vehicle_ownerships", &moved.Ownerships},
+	} {
+		res, err := db.NewUpdate().
+			Table(m.table).
+			Set("customer_id = ?", target.ID).
+			Where("customer_id = ?", source.ID).
+			Where("organization_id = ?", t.OrganizationID).
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		*m.count, err = res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Numbers the target already has are skipped; the source's links go with it.
+	if len(snapshot.PhoneNumbers) > 0 {
+		links := make([]*CustomerPhoneNumber, len(snapshot.PhoneNumbers))
+		for i, l := range snapshot.PhoneNumbers {
+			links[i] = &CustomerPhoneNumber{
+				ID:            uuid.New(),
+				CustomerID:    &target.ID,
+				PhoneNumberID: l.PhoneNumberID,
+				CreatedAt:     l.CreatedAt,
+			}
+		}
+		res, err := db.NewInsert().
+			Model(&links).
+			Column("id", "customer_id", "phone_number_id", "is_primary", "created_at").
+			On("CONFLICT (customer_id, phone_number_id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		moved.PhoneNumbers, err = res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ensurePrimary(ctx, db, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewUpdate().
+		Model((*Customer)(nil)).
+		Set("email = coalesce(email, ?)", source.Email).
+		Set("notes = coalesce(notes, ?)", source.Notes).
+		Set("updated_by = ?", t.UserID).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", target.ID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewDelete().
+		Model((*Customer)(nil)).
+		Where("id = ?", source.ID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	merge := Merge{
+		OrganizationID:   t.OrganizationID,
+		TargetCustomerID: &target.ID,
+		SourceCustomerID: source.ID,
+		Source:           *snapshot,
+		Moved:            moved,
+		MergedBy:         &t.UserID,
+	}
+	_, err = db.NewInsert().
+		Model(&merge).
+		ExcludeColumn("id", "merged_at").
+		Returning("id, merged_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.ByID(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Merged{Customer: c, Merge: &merge}, nil
+}
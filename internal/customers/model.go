@@ -5,6 +5,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
 )
 
 type Customer struct {
@@ -19,6 +21,8 @@ type Customer struct {
 	UpdatedBy      *uuid.UUID `bun:"updated_by" json:"updated_by,omitempty"`
 	CreatedAt      time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
 	UpdatedAt      time.Time  `bun:"updated_at,notnull,default:now()" json:"updated_at"`
+
+	PhoneNumbers []*CustomerPhoneNumber `bun:"rel:has-many,join:id=customer_id" json:"phone_numbers,omitempty"`
 }
 
 type CustomerPhoneNumber struct {
@@ -29,4 +33,6 @@ type CustomerPhoneNumber struct {
 	PhoneNumberID uuid.UUID  `bun:"phone_number_id,notnull" json:"phone_number_id"`
 	IsPrimary     bool       `bun:"is_primary,notnull,default:false" json:"is_primary"`
 	CreatedAt     time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
+
+	PhoneNumber *phonenumbers.PhoneNumber `bun:"rel:belongs-to,join:phone_number_id=id" json:"phone_number,omitempty"`
 }
@@ -0,0 +1,45 @@
+package customers
+
+import (
+	"context"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the customer endpoints. They are organization scoped: requests
+// need the X-Org-Id header and a role granting the endpoint's permission; tenancy
+// authenticates the caller and scopes the request to the organization (see
+// middleware.Tenancy).
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, tenancy mwchain.Chain) {
+	c := v1.PathPrefix("/customers").Subrouter()
+	custLog := log.With().Str("route", "customers").Logger()
+	custHandler := Handler(custLog, db)
+	pnHandler := PhoneNumberHandler(custLog, db)
+
+	scoped := mwchain.NewChain(middleware.Logger(custLog)).Extend(tenancy)
+	read := scoped.Append(middleware.RequirePermission(organizations.PermCustomersRead))
+	write := scoped.Append(middleware.RequirePermission(organizations.PermCustomersWrite))
+	del := scoped.Append(middleware.RequirePermission(organizations.PermCustomersDelete))
+
+	c.Handle("", read.Then(custHandler.List())).Methods(api.GET)
+	c.Handle("", write.Then(custHandler.Create())).Methods(api.POST)
+	c.Handle("/duplicates", read.Then(custHandler.Duplicates())).Methods(api.GET)
+	c.Handle("/{id}", read.Then(custHandler.ByID())).Methods(api.GET)
+	c.Handle("/{id}", write.Then(custHandler.Update())).Methods(api.PATCH)
+	c.Handle("/{id}", del.Then(custHandler.Delete())).Methods(api.DEL)
+	c.Handle("/{id}/merge", del.Then(custHandler.Merge())).Methods(api.POST)
+
+	c.Handle("/{id}/phone-numbers", read.Then(pnHandler.List())).Methods(api.GET)
+	c.Handle("/{id}/phone-numbers", write.Then(pnHandler.Add())).Methods(api.POST)
+	c.Handle("/{id}/phone-numbers/{pnID}", read.Then(pnHandler.ByID())).Methods(api.GET)
+	c.Handle("/{id}/phone-numbers/{pnID}", write.Then(pnHandler.Update())).Methods(api.PATCH)
+	c.Handle("/{id}/phone-numbers/{pnID}", write.Then(pnHandler.Remove())).Methods(api.DEL)
+	c.Handle("/{id}/phone-numbers/{pnID}/set-primary", write.Then(pnHandler.SetPrimary())).Methods(api.POST)
+}
@@ -0,0 +1,632 @@
+package customers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrNotFound            = api.NotFound("customer not found")
+	ErrPhoneNumberNotFound = api.NotFound("phone number not found")
+)
+
+type s interface {
+	Create(ctx context.Context, data CreateCustomer) (*Customer, error)
+	ByID(ctx context.Context, id uuid.UUID) (*Customer, error)
+	List(ctx context.Context, params api.ListParams) ([]*Customer, api.Page, error)
+	Update(ctx context.Context, id uuid.UUID, data UpdateCustomer) (*Customer, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Duplicates(ctx context.Context, customerID *uuid.UUID, limit int) ([]Duplicate, error)
+	Merge(ctx context.Context, targetID uuid.UUID, data MergeCustomer) (*Merged, error)
+}
+
+type pn interface {
+	Add(ctx context.Context, customerID uuid.UUID, data AddPhoneNumber) (*CustomerPhoneNumber, error)
+	List(ctx context.Context, customerID uuid.UUID) ([]*CustomerPhoneNumber, error)
+	ByID(ctx context.Context, customerID, id uuid.UUID) (*CustomerPhoneNumber, error)
+	Update(ctx context.Context, customerID, id uuid.UUID, data AddPhoneNumber) (*CustomerPhoneNumber, error)
+	Remove(ctx context.Context, customerID, id uuid.UUID) error
+	SetPrimary(ctx context.Context, customerID, id uuid.UUID) (*CustomerPhoneNumber, error)
+}
+
+// Svc manages the customers of the request's organization. Every method must run
+// behind middleware.Tenancy: queries go through the request transaction (tenant.DB)
+// and are filtered by the tenant's organization.
+type Svc struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+// PhoneNumberSvc manages the phone numbers of the organization's customers. The
+// numbers themselves live in the shared phone_numbers table, one row per E.164 number.
+type PhoneNumberSvc struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+var _ s = (*Svc)(nil)
+var _ pn = (*PhoneNumberSvc)(nil)
+
+func Service(log zerolog.Logger, db *bun.DB) Svc {
+	return Svc{
+		db:  db,
+		log: log,
+	}
+}
+
+func PhoneNumberService(log zerolog.Logger, db *bun.DB) PhoneNumberSvc {
+	return PhoneNumberSvc{
+		db:  db,
+		log: log,
+	}
+}
+
+// ListSpec is the filters and sort orders accepted by GET /customers. ?search= matches
+// the name and email, and phone numbers when it looks like one.
+var ListSpec = api.ListSpec{
+	Alias: "c",
+	Filters: []api.Filter{
+		{Param: "created_after", Column: "created_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "created_before", Column: "created_at", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:    []string{"created_at", "updated_at", "full_name"},
+	Default:  "full_name",
+	Search:   []string{"full_name", "email"},
+	SearchOr: searchPhoneNumbers,
+}
+
+// minSearchDigits is the fewest digits a search needs to be matched against phone numbers.
+const minSearchDigits = 4
+
+// searchPhoneNumbers matches customers with a phone number containing the digits of
+// search, or equal to it once parsed when it is an international number. National
+// trunk prefixes aren't stored, so leading zeros are ignored.
+func searchPhoneNumbers(q *bun.SelectQuery, search string) *bun.SelectQuery {
+	digits, ok := phoneDigits(search)
+	if !ok {
+		return q
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if len(digits) < minSearchDigits {
+		return q
+	}
+
+	e164 := ""
+	if pn, err := phonenumbers.Parse(search, ""); err == nil {
+		e164 = pn.E164
+	}
+
+	return q.WhereOr(`EXISTS (
+		SELECT 1 FROM customer_phone_numbers AS s_cpn
+		JOIN phone_numbers AS s_pn ON s_pn.id = s_cpn.phone_number_id
+		WHERE s_cpn.customer_id = c.id AND (s_pn.e164 = ? OR s_pn.e164 LIKE ?))`,
+		e164, "%"+digits+"%")
+}
+
+// phoneDigits returns the digits of s, or false when s has anything but digits and the
+// formatting characters accepted in phone numbers.
+func phoneDigits(s string) (string, bool) {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ', r == '-', r == '.', r == '/', r == '(', r == ')':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), b.Len() > 0
+}
+
+// Create adds a customer, with its initial phone numbers if any. The first number is
+// primary unless another one is marked so.
+func (s *Svc) Create(ctx context.Context, data CreateCustomer) (*Customer, error) {
+	t := tenant.MustFromContext(ctx)
+
+	numbers, err := parsePhoneNumbers(data.PhoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Customer{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		FullName:       data.FullName,
+		Email:          nonEmpty(data.Email),
+		Notes:          nonEmpty(data.Notes),
+		CreatedBy:      &t.UserID,
+		UpdatedBy:      &t.UserID,
+	}
+
+	err = tenant.DB(ctx, s.db).RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().
+			Model(&c).
+			ExcludeColumn("created_at", "updated_at").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := range numbers {
+			_, err = linkPhoneNumber(ctx, tx, c.ID, &numbers[i], data.PhoneNumbers[i].IsPrimary)
+			if err != nil {
+				return err
+			}
+		}
+
+		return ensurePrimary(ctx, tx, c.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, c.ID)
+}
+
+// parsePhoneNumbers parses the numbers of a new customer, reporting invalid ones by
+// their index.
+func parsePhoneNumbers(data []AddPhoneNumber) ([]phonenumbers.PhoneNumber, error) {
+	var fe api.FieldErrors
+	numbers := make([]phonenumbers.PhoneNumber, len(data))
+	for i, d := range data {
+		pn, err := newPhoneNumber(d.CountryCode, d.Number)
+		var parseErr *phonenumbers.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			fe.Add(fmt.Sprintf("phone_numbers[%d].%s", i, parseErr.Field), "%s", parseErr.Err)
+		case err != nil:
+			return nil, err
+		}
+		numbers[i] = pn
+	}
+	if len(fe) > 0 {
+		return nil, api.Validation("invalid phone number", fe...)
+	}
+	return numbers, nil
+}
+
+// ByID gets a customer with its phone numbers, primary first.
+func (s *Svc) ByID(ctx context.Context, id uuid.UUID) (*Customer, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var c Customer
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&c).
+		Where("c.id = ?", id).
+		Where("c.organization_id = ?", t.OrganizationID).
+		Relation("PhoneNumbers", orderPhoneNumbers).
+		Relation("PhoneNumbers.PhoneNumber").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// List lists one page of customers with their phone numbers.
+func (s *Svc) List(ctx context.Context, params api.ListParams) ([]*Customer, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	customers := []*Customer{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&customers).
+		Where("c.organization_id = ?", t.OrganizationID).
+		Relation("PhoneNumbers", orderPhoneNumbers).
+		Relation("PhoneNumbers.PhoneNumber")
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	customers, page := api.PageOf(params, customers)
+	return customers, page, nil
+}
+
+// Update changes the name, email or notes of a customer.
+func (s *Svc) Update(ctx context.Context, id uuid.UUID, data UpdateCustomer) (*Customer, error) {
+	t := tenant.MustFromContext(ctx)
+
+	q := tenant.DB(ctx, s.db).NewUpdate().
+		Model((*Customer)(nil)).
+		Set("updated_by = ?", t.UserID).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	if data.FullName != nil {
+		q = q.Set("full_name = ?", *data.FullName)
+	}
+	if data.Email != nil {
+		// An empty email or notes clears it.
+		q = q.Set("email = NULLIF(?, '')", *data.Email)
+	}
+	if data.Notes != nil {
+		q = q.Set("notes = NULLIF(?, '')", *data.Notes)
+	}
+
+	err := affectedOne(q.Exec(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// Delete deletes a customer with its vehicles and phone number links. Customers with
+// work orders or appointments can't be deleted (409).
+func (s *Svc) Delete(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	return affectedOne(tenant.DB(ctx, s.db).NewDelete().
+		Model((*Customer)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx))
+}
+
+// affectedOne turns an update or delete that matched no customer into ErrNotFound.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func orderPhoneNumbers(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.OrderExpr("cpn.is_primary DESC, cpn.created_at ASC")
+}
+
+func nonEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+// newPhoneNumber parses a free-form number, national to countryCode unless it carries
+// its own international prefix, into the phone_numbers row. Invalid input is reported
+// as a *phonenumbers.ParseError.
+func newPhoneNumber(countryCode, phoneNumber string) (phonenumbers.PhoneNumber, error) {
+	pn, err := phonenumbers.Parse(phoneNumber, countryCode)
+	if err != nil {
+		return phonenumbers.PhoneNumber{}, err
+	}
+	pn.ID = uuid.New()
+	return pn, nil
+}
+
+// checkCustomer makes sure the customer belongs to the organization. Customer phone
+// number links have no organization of their own, so they are always reached this way.
+func checkCustomer(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) error {
+	exists, err := db.NewSelect().
+		Table("customers").
+		Where("id = ?", id).
+		Where("organization_id = ?", orgID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// lockCustomer is checkCustomer, also locking the customer to serialize its phone number
+// changes, so concurrent requests can't both leave (or remove) the primary number.
+func lockCustomer(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) error {
+	var locked uuid.UUID
+	err := db.NewSelect().
+		Table("customers").
+		Column("id").
+		Where("id = ?", id).
+		Where("organization_id = ?", orgID).
+		For("UPDATE").
+		Scan(ctx, &locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound.Wrap(err)
+	}
+	return err
+}
+
+// linkPhoneNumber stores pn and links it to the customer; re-adding a linked number
+// only promotes it. Marking it primary demotes the customer's other numbers.
+func linkPhoneNumber(ctx context.Context, db bun.IDB, customerID uuid.UUID, pn *phonenumbers.PhoneNumber, isPrimary bool) (*CustomerPhoneNumber, error) {
+	err := phonenumbers.Upsert(ctx, db, pn)
+	if err != nil {
+		return nil, err
+	}
+
+	if isPrimary {
+		err = demotePrimary(ctx, db, customerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cpn := CustomerPhoneNumber{
+		CustomerID:    &customerID,
+		PhoneNumberID: pn.ID,
+		IsPrimary:     isPrimary,
+	}
+	_, err = db.NewInsert().
+		Model(&cpn).
+		Column("customer_id", "phone_number_id", "is_primary").
+		On("CONFLICT (customer_id, phone_number_id) DO UPDATE").
+		Set("is_primary = cpn.is_primary OR EXCLUDED.is_primary").
+		Returning("id").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cpn, nil
+}
+
+// demotePrimary clears the primary flag of every number of the customer.
+func demotePrimary(ctx context.Context, db bun.IDB, customerID uuid.UUID) error {
+	_, err := db.NewUpdate().
+		Table("customer_phone_numbers").
+		Set("is_primary = FALSE").
+		Where("customer_id = ?", customerID).
+		Where("is_primary = TRUE").
+		Exec(ctx)
+	return err
+}
+
+// ensurePrimary promotes the oldest number when the customer has numbers but no primary
+// one, so a customer with phone numbers always has exactly one primary.
+func ensurePrimary(ctx context.Context, db bun.IDB, customerID uuid.UUID) error {
+	_, err := db.NewUpdate().
+		Table("customer_phone_numbers").
+		Set("is_primary = TRUE").
+		Where("id = (SELECT id FROM customer_phone_numbers WHERE customer_id = ? ORDER BY created_at, id LIMIT 1)", customerID).
+		Where("NOT EXISTS (SELECT 1 FROM customer_phone_numbers WHERE customer_id = ? AND is_primary)", customerID).
+		Exec(ctx)
+	return err
+}
+
+// touch records the caller as the last to change the customer.
+func touch(ctx context.Context, db bun.IDB, t tenant.Tenant, customerID uuid.UUID) error {
+	_, err := db.NewUpdate().
+		Model((*Customer)(nil)).
+		Set("updated_by = ?", t.UserID).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", customerID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	return err
+}
+
+// Add links a phone number to a customer. The first number of a customer is always primary.
+func (p *PhoneNumberSvc) Add(ctx context.Context, customerID uuid.UUID, data AddPhoneNumber) (*CustomerPhoneNumber, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	pn, err := newPhoneNumber(data.CountryCode, data.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	cpn, err := linkPhoneNumber(ctx, db, customerID, &pn, data.IsPrimary)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ensurePrimary(ctx, db, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = touch(ctx, db, t, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(ctx, customerID, cpn.ID)
+}
+
+// List lists a customer's phone numbers, primary first.
+func (p *PhoneNumberSvc) List(ctx context.Context, customerID uuid.UUID) ([]*CustomerPhoneNumber, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	err := checkCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	cpns := []*CustomerPhoneNumber{}
+	err = db.NewSelect().
+		Model(&cpns).
+		Where("cpn.customer_id = ?", customerID).
+		Relation("PhoneNumber").
+		OrderExpr("cpn.is_primary DESC, cpn.created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cpns, nil
+}
+
+// ByID gets one of the customer's phone numbers by its link id.
+func (p *PhoneNumberSvc) ByID(ctx context.Context, customerID, id uuid.UUID) (*CustomerPhoneNumber, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	err := checkCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cpn CustomerPhoneNumber
+	err = db.NewSelect().
+		Model(&cpn).
+		Where("cpn.id = ?", id).
+		Where("cpn.customer_id = ?", customerID).
+		Relation("PhoneNumber").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhoneNumberNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cpn, nil
+}
+
+// Update replaces the number behind one of the customer's phone number links, keeping
+// its primary flag.
+func (p *PhoneNumberSvc) Update(ctx context.Context, customerID, id uuid.UUID, data AddPhoneNumber) (*CustomerPhoneNumber, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	pn, err := newPhoneNumber(data.CountryCode, data.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = phonenumbers.Upsert(ctx, db, &pn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = linkAffected(db.NewUpdate().
+		Model((*CustomerPhoneNumber)(nil)).
+		Set("phone_number_id = ?", pn.ID).
+		Where("id = ?", id).
+		Where("customer_id = ?", customerID).
+		Exec(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	err = touch(ctx, db, t, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(ctx, customerID, id)
+}
+
+// Remove unlinks a phone number from the customer. Removing the primary number
+// promotes the oldest remaining one.
+func (p *PhoneNumberSvc) Remove(ctx context.Context, customerID, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	err := lockCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return err
+	}
+
+	err = linkAffected(db.NewDelete().
+		Model((*CustomerPhoneNumber)(nil)).
+		Where("id = ?", id).
+		Where("customer_id = ?", customerID).
+		Exec(ctx))
+	if err != nil {
+		return err
+	}
+
+	err = ensurePrimary(ctx, db, customerID)
+	if err != nil {
+		return err
+	}
+
+	return touch(ctx, db, t, customerID)
+}
+
+// SetPrimary makes the given number the customer's only primary number.
+func (p *PhoneNumberSvc) SetPrimary(ctx context.Context, customerID, id uuid.UUID) (*CustomerPhoneNumber, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, p.db)
+
+	err := lockCustomer(ctx, db, t.OrganizationID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := db.NewSelect().
+		Model((*CustomerPhoneNumber)(nil)).
+		Where("id = ?", id).
+		Where("customer_id = ?", customerID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrPhoneNumberNotFound
+	}
+
+	err = demotePrimary(ctx, db, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewUpdate().
+		Model((*CustomerPhoneNumber)(nil)).
+		Set("is_primary = TRUE").
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = touch(ctx, db, t, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(ctx, customerID, id)
+}
+
+// linkAffected turns an update or delete that matched no phone number link into
+// ErrPhoneNumberNotFound.
+func linkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrPhoneNumberNotFound
+	}
+	return nil
+}
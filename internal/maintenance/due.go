@@ -0,0 +1,226 @@
+package maintenance
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Due is when a vehicle next needs the service of one of its plans.
+//
+// The last service is the latest completed work order of the vehicle with an item
+// matching the plan, at its completion time and the highest odometer reading taken with
+// it (without one, the vehicle's mileage then: its latest reading up to the completion),
+// or the attachment baseline when that is later. DueAt is IntervalMonths after it
+// and DueKM is IntervalKM past its mileage. EstimatedDueAt is when the vehicle should
+// reach DueKM at the pace of its odometer readings, or now when it already has.
+// NextDueAt is the earliest of both.
+type Due struct {
+	VehicleID       uuid.UUID  `json:"vehicle_id"`
+	CustomerID      uuid.UUID  `json:"customer_id"`
+	PlateNumber     *string    `json:"plate_number,omitempty"`
+	PlanID          uuid.UUID  `json:"plan_id"`
+	PlanName        string     `json:"plan_name"`
+	IntervalKM      *int       `json:"interval_km,omitempty"`
+	IntervalMonths  *int       `json:"interval_months,omitempty"`
+	LastServiceAt   time.Time  `json:"last_service_at"`
+	LastServiceKM   *int       `json:"last_service_km,omitempty"`
+	LastWorkOrderID *uuid.UUID `json:"last_work_order_id,omitempty"`
+	CurrentKM       *int       `json:"current_km,omitempty"`
+	KMPerDay        *float64   `json:"km_per_day,omitempty"`
+	DueAt           *time.Time `json:"due_at,omitempty"`
+	DueKM           *int       `json:"due_km,omitempty"`
+	EstimatedDueAt  *time.Time `json:"estimated_due_at,omitempty"`
+	NextDueAt       *time.Time `json:"next_due_at,omitempty"`
+	Overdue         bool       `json:"overdue"`
+	RemindedAt      *time.Time `json:"reminded_at,omitempty"`
+}
+
+// dueRow is a vehicle plan with what dueQuery gathered to compute its Due.
+type dueRow struct {
+	ID             uuid.UUID  `bun:"id"`
+	OrganizationID uuid.UUID  `bun:"organization_id"`
+	VehicleID      uuid.UUID  `bun:"vehicle_id"`
+	CustomerID     uuid.UUID  `bun:"customer_id"`
+	PlateNumber    *string    `bun:"plate_number"`
+	CurrentKM      *int       `bun:"current_km"`
+	PlanID         uuid.UUID  `bun:"plan_id"`
+	PlanName       string     `bun:"plan_name"`
+	IntervalKM     *int       `bun:"interval_km"`
+	IntervalMonths *int       `bun:"interval_months"`
+	BaselineAt     time.Time  `bun:"baseline_at"`
+	BaselineKM     *int       `bun:"baseline_km"`
+	RemindedAt     *time.Time `bun:"reminded_at"`
+
+	LastWorkOrderID *uuid.UUID `bun:"last_work_order_id"`
+	LastCompletedAt *time.Time `bun:"last_completed_at"`
+	LastKM          *int       `bun:"last_km"`
+	LastVehicleKM   *int       `bun:"last_vehicle_km"`
+
+	FirstReadingAt *time.Time `bun:"first_reading_at"`
+	FirstReadingKM *int       `bun:"first_reading_km"`
+	LastReadingAt  *time.Time `bun:"last_reading_at"`
+	LastReadingKM  *int       `bun:"last_reading_km"`
+}
+
+// minUsageSpan is the shortest span of odometer readings the daily mileage is
+// estimated from; readings days apart say little about a car's usage.
+const minUsageSpan = 14 * 24 * time.Hour
+
+// maxEstimateDays is how far ahead EstimatedDueAt is projected.
+const maxEstimateDays = 10 * 365
+
+// dueQuery selects the dueRows of the vehicle plans of an organization.
+func dueQuery(db bun.IDB, orgID uuid.UUID) *bun.SelectQuery {
+	return db.NewSelect().
+		TableExpr("vehicle_maintenance_plans AS vmp").
+		Join("JOIN maintenance_plans AS mp ON mp.id = vmp.plan_id").
+		Join("JOIN vehicles AS v ON v.id = vmp.vehicle_id").
+		// The latest completed work order with an item matching the plan.
+		Join(`LEFT JOIN LATERAL (
+			SELECT wo.id, wo.completed_at,
+				(SELECT max(odo.mileage_km) FROM odometer_readings AS odo
+				 WHERE odo.work_order_id = wo.id AND NOT odo.decreased AND odo.voided_at IS NULL) AS mileage_km,
+				(SELECT odo.mileage_km FROM odometer_readings AS odo
+				 WHERE odo.vehicle_id = wo.vehicle_id AND odo.recorded_at <= wo.completed_at
+					AND NOT odo.decreased AND odo.voided_at IS NULL
+				 ORDER BY odo.recorded_at DESC
+				 LIMIT 1) AS vehicle_km
+			FROM work_orders AS wo
+			WHERE wo.vehicle_id = vmp.vehicle_id
+				AND wo.organization_id = vmp.organization_id
+				AND wo.status = 'completed'
+				AND EXISTS (
+					SELECT 1 FROM work_order_items AS woi, unnest(mp.match_terms) AS term
+					WHERE woi.work_order_id = wo.id
+						AND (lower(woi.sku) = lower(term) OR strpos(lower(woi.name), lower(term)) > 0)
+				)
+			ORDER BY wo.completed_at DESC
+			LIMIT 1
+		) AS last ON true`).
+		// The span of the vehicle's trusted odometer readings, for its daily mileage.
+		Join(`LEFT JOIN LATERAL (
+			SELECT min(odo.recorded_at) AS first_at, min(odo.mileage_km) AS first_km,
+				max(odo.recorded_at) AS last_at, max(odo.mileage_km) AS last_km
+			FROM odometer_readings AS odo
+			WHERE odo.vehicle_id = vmp.vehicle_id AND NOT odo.decreased AND odo.voided_at IS NULL
+		) AS readings ON true`).
+		ColumnExpr("vmp.id, vmp.organization_id, vmp.vehicle_id, vmp.plan_id, vmp.reminded_at").
+		ColumnExpr("vmp.last_service_at AS baseline_at, vmp.last_service_km AS baseline_km").
+		ColumnExpr("v.customer_id, v.plate_number, v.mileage_km AS current_km").
+		ColumnExpr("mp.name AS plan_name, mp.interval_km, mp.interval_months").
+		ColumnExpr("last.id AS last_work_order_id, last.completed_at AS last_completed_at, last.mileage_km AS last_km").
+		ColumnExpr("last.vehicle_km AS last_vehicle_km").
+		ColumnExpr("readings.first_at AS first_reading_at, readings.first_km AS first_reading_km").
+		ColumnExpr("readings.last_at AS last_reading_at, readings.last_km AS last_reading_km").
+		Where("vmp.organization_id = ?", orgID)
+}
+
+// scanDue runs a dueQuery and computes the Due of every row as of now.
+func scanDue(ctx context.Context, q *bun.SelectQuery, now time.Time) ([]*Due, error) {
+	var rows []dueRow
+	err := q.Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	dues := make([]*Due, len(rows))
+	for i, row := range rows {
+		dues[i] = row.due(now)
+	}
+	return dues, nil
+}
+
+func (r dueRow) due(now time.Time) *Due {
+	d := Due{
+		VehicleID:      r.VehicleID,
+		CustomerID:     r.CustomerID,
+		PlateNumber:    r.PlateNumber,
+		PlanID:         r.PlanID,
+		PlanName:       r.PlanName,
+		IntervalKM:     r.IntervalKM,
+		IntervalMonths: r.IntervalMonths,
+		LastServiceAt:  r.BaselineAt,
+		LastServiceKM:  r.BaselineKM,
+		CurrentKM:      r.CurrentKM,
+		RemindedAt:     r.RemindedAt,
+	}
+	if r.LastCompletedAt != nil && r.LastCompletedAt.After(r.BaselineAt) {
+		d.LastServiceAt = *r.LastCompletedAt
+		d.LastServiceKM = r.LastKM
+		if d.LastServiceKM == nil {
+			// No reading was taken with the work order.
+			d.LastServiceKM = r.LastVehicleKM
+		}
+		d.LastWorkOrderID = r.LastWorkOrderID
+	}
+
+	if r.IntervalMonths != nil {
+		at := d.LastServiceAt.AddDate(0, *r.IntervalMonths, 0)
+		d.DueAt = &at
+	}
+
+	if r.FirstReadingAt != nil && r.LastReadingAt != nil && r.LastReadingAt.Sub(*r.FirstReadingAt) >= minUsageSpan {
+		days := r.LastReadingAt.Sub(*r.FirstReadingAt).Hours() / 24
+		perDay := float64(*r.LastReadingKM-*r.FirstReadingKM) / days
+		perDay = math.Round(perDay*10) / 10
+		d.KMPerDay = &perDay
+	}
+
+	if r.IntervalKM != nil && d.LastServiceKM != nil {
+		km := *d.LastServiceKM + *r.IntervalKM
+		d.DueKM = &km
+
+		switch {
+		case r.CurrentKM != nil && *r.CurrentKM >= km:
+			d.EstimatedDueAt = &now
+		case r.CurrentKM != nil && d.KMPerDay != nil && *d.KMPerDay > 0 && r.LastReadingAt != nil:
+			// Past maxEstimateDays the pace says nothing useful (and would overflow a Duration).
+			if days := float64(km-*r.CurrentKM) / *d.KMPerDay; days <= maxEstimateDays {
+				at := r.LastReadingAt.Add(time.Duration(days * 24 * float64(time.Hour))).Truncate(time.Second)
+				d.EstimatedDueAt = &at
+			}
+		}
+	}
+
+	d.NextDueAt = earliest(d.DueAt, d.EstimatedDueAt)
+	d.Overdue = d.NextDueAt != nil && !d.NextDueAt.After(now)
+	return &d
+}
+
+func earliest(a, b *time.Time) *time.Time {
+	switch {
+	case a == nil:
+		return b
+	case b == nil || a.Before(*b):
+		return a
+	}
+	return b
+}
+
+// dueBy keeps the dues with a NextDueAt not after until, soonest first.
+func dueBy(dues []*Due, until time.Time) []*Due {
+	kept := []*Due{}
+	for _, d := range dues {
+		if d.NextDueAt != nil && !d.NextDueAt.After(until) {
+			kept = append(kept, d)
+		}
+	}
+	sortDues(kept)
+	return kept
+}
+
+// sortDues orders dues soonest first, those without a NextDueAt last.
+func sortDues(dues []*Due) {
+	sort.SliceStable(dues, func(i, j int) bool {
+		a, b := dues[i].NextDueAt, dues[j].NextDueAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+}
@@ -0,0 +1,198 @@
+package maintenance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDue(t *testing.T) {
+	now := day(2025, 6, 1)
+	woID := uuid.New()
+
+	tests := []struct {
+		name string
+		row  dueRow
+		want Due // only the computed fields are compared
+	}{
+		{
+			name: "months only",
+			row:  dueRow{IntervalMonths: ptr(6), BaselineAt: day(2025, 3, 1), BaselineKM: ptr(10_000)},
+			want: Due{LastServiceAt: day(2025, 3, 1), LastServiceKM: ptr(10_000), DueAt: ptr(day(2025, 9, 1)),
+				NextDueAt: ptr(day(2025, 9, 1))},
+		},
+		{
+			name: "months only, overdue",
+			row:  dueRow{IntervalMonths: ptr(3), BaselineAt: day(2025, 1, 1)},
+			want: Due{LastServiceAt: day(2025, 1, 1), DueAt: ptr(day(2025, 4, 1)), NextDueAt: ptr(day(2025, 4, 1)),
+				Overdue: true},
+		},
+		{
+			name: "km only, without readings to project from",
+			row:  dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 3, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(12_000)},
+			want: Due{LastServiceAt: day(2025, 3, 1), LastServiceKM: ptr(10_000), DueKM: ptr(15_000)},
+		},
+		{
+			name: "km only, without a baseline mileage",
+			row:  dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 3, 1), CurrentKM: ptr(12_000)},
+			want: Due{LastServiceAt: day(2025, 3, 1)},
+		},
+		{
+			name: "km only, projected from the readings",
+			row: dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(12_000),
+				FirstReadingAt: ptr(day(2025, 1, 1)), FirstReadingKM: ptr(10_000),
+				LastReadingAt: ptr(day(2025, 3, 2)), LastReadingKM: ptr(12_000)},
+			// 2000 km in 60 days is 33.3 km/day; 3000 km to go take 90.1 days.
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), KMPerDay: ptr(33.3), DueKM: ptr(15_000),
+				EstimatedDueAt: ptr(time.Date(2025, 5, 31, 2, 9, 43, 0, time.UTC)),
+				NextDueAt:      ptr(time.Date(2025, 5, 31, 2, 9, 43, 0, time.UTC)), Overdue: true},
+		},
+		{
+			name: "km only, readings too close together for a pace",
+			row: dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(12_000),
+				FirstReadingAt: ptr(day(2025, 5, 20)), FirstReadingKM: ptr(11_000),
+				LastReadingAt: ptr(day(2025, 5, 30)), LastReadingKM: ptr(12_000)},
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), DueKM: ptr(15_000)},
+		},
+		{
+			name: "km already reached",
+			row: dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(15_000),
+				FirstReadingAt: ptr(day(2025, 1, 1)), FirstReadingKM: ptr(10_000),
+				LastReadingAt: ptr(day(2025, 5, 31)), LastReadingKM: ptr(15_000)},
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), KMPerDay: ptr(33.3), DueKM: ptr(15_000),
+				EstimatedDueAt: ptr(now), NextDueAt: ptr(now), Overdue: true},
+		},
+		{
+			name: "projection past maxEstimateDays is dropped",
+			row: dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(10_001),
+				FirstReadingAt: ptr(day(2024, 1, 1)), FirstReadingKM: ptr(10_000),
+				LastReadingAt: ptr(day(2025, 5, 1)), LastReadingKM: ptr(10_050)},
+			// 50 km in 486 days is 0.1 km/day: 4999 km take 137 years.
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), KMPerDay: ptr(0.1), DueKM: ptr(15_000)},
+		},
+		{
+			name: "months and km, months first",
+			row: dueRow{IntervalKM: ptr(10_000), IntervalMonths: ptr(6), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000),
+				CurrentKM: ptr(11_000), FirstReadingAt: ptr(day(2025, 1, 1)), FirstReadingKM: ptr(10_000),
+				LastReadingAt: ptr(day(2025, 5, 1)), LastReadingKM: ptr(11_000)},
+			// 1000 km in 120 days is 8.3 km/day; 9000 km to go take 1084.3 days.
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), KMPerDay: ptr(8.3), DueKM: ptr(20_000),
+				DueAt:          ptr(day(2025, 7, 1)),
+				EstimatedDueAt: ptr(time.Date(2028, 4, 19, 8, 5, 46, 0, time.UTC)), NextDueAt: ptr(day(2025, 7, 1))},
+		},
+		{
+			name: "months and km, km first",
+			row: dueRow{IntervalKM: ptr(5_000), IntervalMonths: ptr(12), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000),
+				CurrentKM: ptr(14_000), FirstReadingAt: ptr(day(2025, 1, 1)), FirstReadingKM: ptr(10_000),
+				LastReadingAt: ptr(day(2025, 5, 1)), LastReadingKM: ptr(14_000)},
+			// 4000 km in 120 days is 33.3 km/day; the last 1000 km take 30 days.
+			want: Due{LastServiceAt: day(2025, 1, 1), LastServiceKM: ptr(10_000), KMPerDay: ptr(33.3), DueKM: ptr(15_000),
+				DueAt:          ptr(day(2026, 1, 1)),
+				EstimatedDueAt: ptr(time.Date(2025, 5, 31, 0, 43, 14, 0, time.UTC)),
+				NextDueAt:      ptr(time.Date(2025, 5, 31, 0, 43, 14, 0, time.UTC)), Overdue: true},
+		},
+		{
+			name: "completed work order after the baseline",
+			row: dueRow{IntervalMonths: ptr(6), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000),
+				LastWorkOrderID: &woID, LastCompletedAt: ptr(day(2025, 4, 1)), LastKM: ptr(13_000), LastVehicleKM: ptr(12_900)},
+			want: Due{LastServiceAt: day(2025, 4, 1), LastServiceKM: ptr(13_000), LastWorkOrderID: &woID,
+				DueAt: ptr(day(2025, 10, 1)), NextDueAt: ptr(day(2025, 10, 1))},
+		},
+		{
+			name: "completed work order without a reading uses the vehicle's mileage then",
+			row: dueRow{IntervalKM: ptr(5_000), BaselineAt: day(2025, 1, 1), BaselineKM: ptr(10_000), CurrentKM: ptr(13_500),
+				LastWorkOrderID: &woID, LastCompletedAt: ptr(day(2025, 4, 1)), LastVehicleKM: ptr(12_900)},
+			want: Due{LastServiceAt: day(2025, 4, 1), LastServiceKM: ptr(12_900), LastWorkOrderID: &woID, DueKM: ptr(17_900)},
+		},
+		{
+			name: "baseline after the completed work order",
+			row: dueRow{IntervalMonths: ptr(6), BaselineAt: day(2025, 2, 1), BaselineKM: ptr(10_000),
+				LastWorkOrderID: &woID, LastCompletedAt: ptr(day(2025, 1, 1)), LastKM: ptr(9_000)},
+			want: Due{LastServiceAt: day(2025, 2, 1), LastServiceKM: ptr(10_000),
+				DueAt: ptr(day(2025, 8, 1)), NextDueAt: ptr(day(2025, 8, 1))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.row.due(now)
+			w := tt.want
+			switch {
+			case !got.LastServiceAt.Equal(w.LastServiceAt):
+				t.Errorf("LastServiceAt = %s, want %s", got.LastServiceAt, w.LastServiceAt)
+			case !sameInt(got.LastServiceKM, w.LastServiceKM):
+				t.Errorf("LastServiceKM = %s, want %s", show(got.LastServiceKM), show(w.LastServiceKM))
+			case !sameValue(got.LastWorkOrderID, w.LastWorkOrderID):
+				t.Errorf("LastWorkOrderID = %s, want %s", show(got.LastWorkOrderID), show(w.LastWorkOrderID))
+			case !sameValue(got.KMPerDay, w.KMPerDay):
+				t.Errorf("KMPerDay = %s, want %s", show(got.KMPerDay), show(w.KMPerDay))
+			case !sameInt(got.DueKM, w.DueKM):
+				t.Errorf("DueKM = %s, want %s", show(got.DueKM), show(w.DueKM))
+			case !sameTime(got.DueAt, w.DueAt):
+				t.Errorf("DueAt = %s, want %s", show(got.DueAt), show(w.DueAt))
+			case !sameTime(got.EstimatedDueAt, w.EstimatedDueAt):
+				t.Errorf("EstimatedDueAt = %s, want %s", show(got.EstimatedDueAt), show(w.EstimatedDueAt))
+			case !sameTime(got.NextDueAt, w.NextDueAt):
+				t.Errorf("NextDueAt = %s, want %s", show(got.NextDueAt), show(w.NextDueAt))
+			case got.Overdue != w.Overdue:
+				t.Errorf("Overdue = %t, want %t", got.Overdue, w.Overdue)
+			}
+		})
+	}
+}
+
+func TestDueBy(t *testing.T) {
+	until := day(2025, 6, 1)
+	dues := []*Due{
+		{PlanName: "unscheduled"},
+		{PlanName: "later", NextDueAt: ptr(day(2025, 6, 2))},
+		{PlanName: "on the day", NextDueAt: ptr(until)},
+		{PlanName: "overdue", NextDueAt: ptr(day(2025, 1, 1))},
+		{PlanName: "soon", NextDueAt: ptr(day(2025, 5, 20))},
+	}
+
+	got := dueBy(dues, until)
+	want := []string{"overdue", "soon", "on the day"}
+	if len(got) != len(want) {
+		t.Fatalf("dueBy kept %d dues, want %d", len(got), len(want))
+	}
+	for i, d := range got {
+		if d.PlanName != want[i] {
+			t.Errorf("dueBy[%d] = %s, want %s", i, d.PlanName, want[i])
+		}
+	}
+
+	if got := dueBy(dues[:2], until); got == nil || len(got) != 0 {
+		t.Fatalf("dueBy with nothing due = %v, want an empty list", got)
+	}
+}
+
+func sameValue[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameInt(a, b *int) bool { return sameValue(a, b) }
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func show[T any](v *T) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,334 @@
+package maintenance
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+)
+
+type h interface {
+	CreatePlan() http.HandlerFunc
+	Plan() http.HandlerFunc
+	Plans() http.HandlerFunc
+	UpdatePlan() http.HandlerFunc
+	DeletePlan() http.HandlerFunc
+	Attach() http.HandlerFunc
+	Schedule() http.HandlerFunc
+	Detach() http.HandlerFunc
+	Due() http.HandlerFunc
+}
+
+type Hdlr struct {
+	db  *bun.DB
+	log zerolog.Logger
+	svc Svc
+}
+
+var _ h = (*Hdlr)(nil)
+
+func Handler(log zerolog.Logger, db *bun.DB) Hdlr {
+	svc := Service(log, db)
+	return Hdlr{db, log, svc}
+}
+
+// CreatePlan is the body of POST /maintenance-plans. At least one interval is required.
+type CreatePlan struct {
+	Name           string   `json:"name" validate:"required,max=200"`
+	Description    *string  `json:"description,omitempty" validate:"max=2000"`
+	IntervalKM     *int     `json:"interval_km,omitempty" validate:"min=1,max=1000000"`
+	IntervalMonths *int     `json:"interval_months,omitempty" validate:"min=1,max=120"`
+	MatchTerms     []string `json:"match_terms,omitempty" validate:"max=20"`
+}
+
+func (p CreatePlan) Validate() error {
+	var fe api.FieldErrors
+	if p.IntervalKM == nil && p.IntervalMonths == nil {
+		fe.Add("interval_km", "interval_km or interval_months is required")
+	}
+	validateTerms(&fe, p.MatchTerms)
+	return fe.Err()
+}
+
+// UpdatePlan holds the fields PATCH /maintenance-plans/{id} may change; nil fields are
+// left untouched, an empty description clears it and so does 0 for an interval.
+type UpdatePlan struct {
+	Name           *string  `json:"name,omitempty" validate:"min=1,max=200"`
+	Description    *string  `json:"description,omitempty" validate:"max=2000"`
+	IntervalKM     *int     `json:"interval_km,omitempty" validate:"min=0,max=1000000"`
+	IntervalMonths *int     `json:"interval_months,omitempty" validate:"min=0,max=120"`
+	MatchTerms     []string `json:"match_terms,omitempty" validate:"max=20"`
+}
+
+func (p UpdatePlan) Validate() error {
+	var fe api.FieldErrors
+	validateTerms(&fe, p.MatchTerms)
+	return fe.Err()
+}
+
+func validateTerms(fe *api.FieldErrors, terms []string) {
+	for _, term := range terms {
+		if len(term) > 100 {
+			fe.Add("match_terms", "terms must be at most %d characters", 100)
+			return
+		}
+	}
+}
+
+// AttachPlan is the body of POST /vehicles/{id}/maintenance. LastServiceAt and
+// LastServiceKM tell when the service was last done, if before it was tracked.
+type AttachPlan struct {
+	PlanID        uuid.UUID  `json:"plan_id" validate:"required"`
+	LastServiceAt *time.Time `json:"last_service_at,omitempty"`
+	LastServiceKM *int       `json:"last_service_km,omitempty" validate:"min=0,max=5000000"`
+}
+
+func (a AttachPlan) Validate() error {
+	var fe api.FieldErrors
+	if a.LastServiceAt != nil && a.LastServiceAt.After(time.Now()) {
+		fe.Add("last_service_at", "must not be in the future")
+	}
+	return fe.Err()
+}
+
+// CreatePlan adds a maintenance plan.
+func (h *Hdlr) CreatePlan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreatePlan](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		p, err := h.svc.CreatePlan(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Plan](w, http.StatusCreated, p)
+	}
+}
+
+// Plan gets a maintenance plan.
+func (h *Hdlr) Plan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "id", "invalid maintenance plan id")
+		if !ok {
+			return
+		}
+
+		p, err := h.svc.Plan(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Plan](w, http.StatusOK, p)
+	}
+}
+
+// Plans lists the organization's maintenance plans, see PlanListSpec.
+func (h *Hdlr) Plans() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, PlanListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		ps, page, err := h.svc.Plans(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing maintenance plans")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*Plan](w, http.StatusOK, ps, page)
+	}
+}
+
+// UpdatePlan changes a maintenance plan.
+func (h *Hdlr) UpdatePlan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "id", "invalid maintenance plan id")
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdatePlan](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		p, err := h.svc.UpdatePlan(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Plan](w, http.StatusOK, p)
+	}
+}
+
+// DeletePlan deletes a maintenance plan.
+func (h *Hdlr) DeletePlan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "id", "invalid maintenance plan id")
+		if !ok {
+			return
+		}
+
+		err := h.svc.DeletePlan(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Attach puts the vehicle in the path on a maintenance plan.
+func (h *Hdlr) Attach() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vehicleID, ok := pathID(w, r, "id", "invalid vehicle id")
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[AttachPlan](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		d, err := h.svc.Attach(r.Context(), vehicleID, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error attaching maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Due](w, http.StatusCreated, d)
+	}
+}
+
+// Schedule lists when the vehicle in the path next needs each of its plans.
+func (h *Hdlr) Schedule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vehicleID, ok := pathID(w, r, "id", "invalid vehicle id")
+		if !ok {
+			return
+		}
+
+		dues, err := h.svc.Schedule(r.Context(), vehicleID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting maintenance schedule")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Due](w, http.StatusOK, dues)
+	}
+}
+
+// Detach takes the vehicle in the path off a maintenance plan.
+func (h *Hdlr) Detach() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vehicleID, ok := pathID(w, r, "id", "invalid vehicle id")
+		if !ok {
+			return
+		}
+		planID, ok := pathID(w, r, "planID", "invalid maintenance plan id")
+		if !ok {
+			return
+		}
+
+		err := h.svc.Detach(r.Context(), vehicleID, planID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error detaching maintenance plan")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Due window limits.
+const (
+	defaultWithin = 30 * 24 * time.Hour
+	maxWithin     = 366 * 24 * time.Hour
+)
+
+// Due lists the services due within ?within= (default 30d), overdue ones included.
+func (h *Hdlr) Due() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		within := defaultWithin
+		if raw := r.URL.Query().Get("within"); raw != "" {
+			d, err := parseWithin(raw)
+			if err != nil || d < 0 || d > maxWithin {
+				api.WriteError(w, api.Validation("invalid query parameters", api.FieldError{
+					Field:   "within",
+					Message: "must be a duration such as 30d, 2w or 72h, of at most 366d",
+				}))
+				return
+			}
+			within = d
+		}
+
+		dues, err := h.svc.Due(r.Context(), within)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing due maintenance")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Due](w, http.StatusOK, dues)
+	}
+}
+
+// parseWithin parses a time.Duration, also accepting whole days ("30d") and weeks
+// ("2w").
+func parseWithin(raw string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(raw, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(raw, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(raw)
+	}
+
+	n, err := strconv.Atoi(raw[:len(raw)-1])
+	if err != nil {
+		return 0, err
+	}
+	if n > int(maxWithin/unit) {
+		return maxWithin + 1, nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, name, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		api.WriteError(w, api.BadRequest(message))
+		return uuid.Nil, false
+	}
+	return id, true
+}
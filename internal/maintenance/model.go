@@ -0,0 +1,43 @@
+package maintenance
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Plan is a preventive service the organization offers on a schedule, such as an oil
+// change every 10,000 km or 12 months, whichever comes first. A completed work order
+// performed the service when one of its items has a SKU equal to one of MatchTerms, or
+// a name containing one, ignoring case.
+type Plan struct {
+	bun.BaseModel `bun:"table:maintenance_plans,alias:mp"`
+
+	ID             uuid.UUID `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID `bun:"organization_id,notnull" json:"organization_id"`
+	Name           string    `bun:"name,notnull" json:"name"`
+	Description    *string   `bun:"description" json:"description,omitempty"`
+	IntervalKM     *int      `bun:"interval_km" json:"interval_km,omitempty"`
+	IntervalMonths *int      `bun:"interval_months" json:"interval_months,omitempty"`
+	MatchTerms     []string  `bun:"match_terms,array,notnull" json:"match_terms"`
+	CreatedAt      time.Time `bun:"created_at,notnull,default:now()" json:"created_at"`
+	UpdatedAt      time.Time `bun:"updated_at,notnull,default:now()" json:"updated_at"`
+}
+
+// VehiclePlan attaches a plan to a vehicle. LastServiceAt and LastServiceKM are the
+// baseline the first interval counts from: when the service was last done before it
+// was tracked, or the time and mileage the plan was attached.
+type VehiclePlan struct {
+	bun.BaseModel `bun:"table:vehicle_maintenance_plans,alias:vmp"`
+
+	ID             uuid.UUID  `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `bun:"organization_id,notnull" json:"organization_id"`
+	VehicleID      uuid.UUID  `bun:"vehicle_id,notnull" json:"vehicle_id"`
+	PlanID         uuid.UUID  `bun:"plan_id,notnull" json:"plan_id"`
+	LastServiceAt  time.Time  `bun:"last_service_at,notnull" json:"last_service_at"`
+	LastServiceKM  *int       `bun:"last_service_km" json:"last_service_km,omitempty"`
+	RemindedAt     *time.Time `bun:"reminded_at" json:"reminded_at,omitempty"`
+	CreatedBy      uuid.UUID  `bun:"created_by,notnull" json:"created_by"`
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
+}
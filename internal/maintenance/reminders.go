@@ -0,0 +1,231 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/internal/notifications"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// ReminderTemplate is the template key of maintenance reminders.
+const ReminderTemplate = "maintenance_due"
+
+// Reminders is the scheduled job queueing a notification to the customer when one of
+// their vehicles' services comes due. Each service is reminded once per cycle: again
+// only after it is performed. The notifications are left queued in notification_logs
+// for a sender to deliver, by email when the customer has one and by SMS to their
+// primary phone number otherwise.
+//
+// The job runs outside any request: it lists the organizations and handles each in its
+// own transaction configured for that organization as tenant.SystemUserID, so
+// row-level security applies to it as it does to requests.
+type Reminders struct {
+	db       *bun.DB
+	log      zerolog.Logger
+	interval time.Duration
+	lead     time.Duration
+}
+
+// NewReminders returns a job that runs every interval and reminds services due within
+// lead.
+func NewReminders(log zerolog.Logger, db *bun.DB, interval, lead time.Duration) *Reminders {
+	return &Reminders{
+		db:       db,
+		log:      log,
+		interval: interval,
+		lead:     lead,
+	}
+}
+
+// Start runs the job now and then every interval until ctx is done. A zero interval
+// disables it.
+func (r *Reminders) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		r.log.Info().Msg("maintenance reminders disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := r.Run(ctx, time.Now())
+			if err != nil {
+				r.log.Error().Err(err).Msg("failed to queue maintenance reminders")
+			} else if n > 0 {
+				r.log.Info().Int("queued", n).Msg("queued maintenance reminders")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run queues the reminders due as of now and returns how many it queued. An
+// organization failing does not stop the others; the first error is returned.
+func (r *Reminders) Run(ctx context.Context, now time.Time) (int, error) {
+	var orgIDs []uuid.UUID
+	err := r.db.RunInTx(ctx, &sql.TxOptions{ReadOnly: true}, func(ctx context.Context, tx bun.Tx) error {
+		err := tenant.ConfigureUser(ctx, tx, tenant.SystemUserID)
+		if err != nil {
+			return err
+		}
+		return tx.NewSelect().
+			Model((*organizations.Organization)(nil)).
+			Column("id").
+			Scan(ctx, &orgIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	var first error
+	for _, orgID := range orgIDs {
+		n, err := r.runOrganization(ctx, orgID, now)
+		if err != nil {
+			r.log.Error().Err(err).Stringer("organization_id", orgID).Msg("failed to queue maintenance reminders")
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		queued += n
+	}
+	return queued, first
+}
+
+// reminderMeta is the meta of a maintenance reminder notification.
+type reminderMeta struct {
+	VehicleID   uuid.UUID  `json:"vehicle_id"`
+	PlateNumber *string    `json:"plate_number,omitempty"`
+	PlanID      uuid.UUID  `json:"plan_id"`
+	PlanName    string     `json:"plan_name"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	DueKM       *int       `json:"due_km,omitempty"`
+	NextDueAt   time.Time  `json:"next_due_at"`
+	Overdue     bool       `json:"overdue"`
+}
+
+// contact is where a customer is reminded.
+type contact struct {
+	Email *string `bun:"email"`
+	Phone *string `bun:"phone"`
+}
+
+func (r *Reminders) runOrganization(ctx context.Context, orgID uuid.UUID, now time.Time) (int, error) {
+	queued := 0
+	err := r.db.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := tenant.Configure(ctx, tx, tenant.SystemUserID, orgID)
+		if err != nil {
+			return err
+		}
+
+		all, err := scanDue(ctx, dueQuery(tx, orgID), now)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range dueBy(all, now.Add(r.lead)) {
+			if d.RemindedAt != nil && d.RemindedAt.After(d.LastServiceAt) {
+				continue
+			}
+
+			c, err := customerContact(ctx, tx, orgID, d.CustomerID)
+			if err != nil {
+				return err
+			}
+			channel, recipient := notifications.ChannelEmail, c.Email
+			if recipient == nil {
+				channel, recipient = notifications.ChannelSMS, c.Phone
+			}
+			if recipient == nil {
+				r.log.Debug().Stringer("customer_id", d.CustomerID).Msg("no contact for maintenance reminder")
+				continue
+			}
+
+			// Claiming the reminder first keeps concurrent runs from queueing it twice.
+			res, err := tx.NewUpdate().
+				Model((*VehiclePlan)(nil)).
+				Set("reminded_at = ?", now).
+				Where("vehicle_id = ?", d.VehicleID).
+				Where("plan_id = ?", d.PlanID).
+				Where("organization_id = ?", orgID).
+				Where("(reminded_at IS NULL OR reminded_at <= ?)", d.LastServiceAt).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue
+			}
+
+			meta, err := json.Marshal(reminderMeta{
+				VehicleID:   d.VehicleID,
+				PlateNumber: d.PlateNumber,
+				PlanID:      d.PlanID,
+				PlanName:    d.PlanName,
+				DueAt:       d.DueAt,
+				DueKM:       d.DueKM,
+				NextDueAt:   *d.NextDueAt,
+				Overdue:     d.Overdue,
+			})
+			if err != nil {
+				return err
+			}
+
+			template := ReminderTemplate
+			nl := notifications.NotificationLog{
+				OrganizationID: orgID,
+				CustomerID:     &d.CustomerID,
+				Channel:        channel,
+				Recipient:      *recipient,
+				TemplateKey:    &template,
+				Status:         notifications.StatusQueued,
+				QueuedAt:       now,
+				Meta:           meta,
+			}
+			_, err = tx.NewInsert().
+				Model(&nl).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			queued++
+		}
+		return nil
+	})
+	return queued, err
+}
+
+// customerContact gets the email and primary phone number (E.164) of a customer.
+func customerContact(ctx context.Context, db bun.IDB, orgID, customerID uuid.UUID) (contact, error) {
+	var c contact
+	err := db.NewSelect().
+		TableExpr("customers AS c").
+		ColumnExpr("nullif(btrim(c.email), '') AS email").
+		ColumnExpr(`(SELECT pn.e164 FROM customer_phone_numbers AS cpn
+			JOIN phone_numbers AS pn ON pn.id = cpn.phone_number_id
+			WHERE cpn.customer_id = c.id AND cpn.is_primary) AS phone`).
+		Where("c.id = ?", customerID).
+		Where("c.organization_id = ?", orgID).
+		Scan(ctx, &c)
+	return c, err
+}
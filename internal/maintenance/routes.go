@@ -0,0 +1,41 @@
+package maintenance
+
+import (
+	"context"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the maintenance plan endpoints and the maintenance endpoints under
+// /vehicles. They are organization scoped: requests need the X-Org-Id header and a role
+// granting the endpoint's permission; tenancy authenticates the caller and scopes the
+// request to the organization (see middleware.Tenancy). Register them before
+// vehicles.Routes, whose /vehicles/{id} would otherwise match /vehicles/due.
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, tenancy mwchain.Chain) {
+	mp := v1.PathPrefix("/maintenance-plans").Subrouter()
+	mtLog := log.With().Str("route", "maintenance").Logger()
+	mtHandler := Handler(mtLog, db)
+
+	scoped := mwchain.NewChain(middleware.Logger(mtLog)).Extend(tenancy)
+	read := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesRead))
+	write := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesWrite))
+	manage := scoped.Append(middleware.RequirePermission(organizations.PermMaintenanceManage))
+
+	mp.Handle("", read.Then(mtHandler.Plans())).Methods(api.GET)
+	mp.Handle("", manage.Then(mtHandler.CreatePlan())).Methods(api.POST)
+	mp.Handle("/{id}", read.Then(mtHandler.Plan())).Methods(api.GET)
+	mp.Handle("/{id}", manage.Then(mtHandler.UpdatePlan())).Methods(api.PATCH)
+	mp.Handle("/{id}", manage.Then(mtHandler.DeletePlan())).Methods(api.DEL)
+
+	v1.Handle("/vehicles/due", read.Then(mtHandler.Due())).Methods(api.GET)
+	v1.Handle("/vehicles/{id}/maintenance", read.Then(mtHandler.Schedule())).Methods(api.GET)
+	v1.Handle("/vehicles/{id}/maintenance", write.Then(mtHandler.Attach())).Methods(api.POST)
+	v1.Handle("/vehicles/{id}/maintenance/{planID}", write.Then(mtHandler.Detach())).Methods(api.DEL)
+}
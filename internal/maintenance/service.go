@@ -0,0 +1,349 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrPlanNotFound        = api.NotFound("maintenance plan not found")
+	ErrVehicleNotFound     = api.NotFound("vehicle not found")
+	ErrVehiclePlanNotFound = api.NotFound("maintenance plan is not attached to this vehicle")
+	ErrAlreadyAttached     = api.Conflict("maintenance plan is already attached to this vehicle")
+)
+
+type s interface {
+	CreatePlan(ctx context.Context, data CreatePlan) (*Plan, error)
+	Plan(ctx context.Context, id uuid.UUID) (*Plan, error)
+	Plans(ctx context.Context, params api.ListParams) ([]*Plan, api.Page, error)
+	UpdatePlan(ctx context.Context, id uuid.UUID, data UpdatePlan) (*Plan, error)
+	DeletePlan(ctx context.Context, id uuid.UUID) error
+	Attach(ctx context.Context, vehicleID uuid.UUID, data AttachPlan) (*Due, error)
+	Schedule(ctx context.Context, vehicleID uuid.UUID) ([]*Due, error)
+	Detach(ctx context.Context, vehicleID, planID uuid.UUID) error
+	Due(ctx context.Context, within time.Duration) ([]*Due, error)
+}
+
+// Svc manages the maintenance plans of the request's organization and their vehicles.
+// Every method must run behind middleware.Tenancy: queries go through the request
+// transaction (tenant.DB) and are filtered by the tenant's organization.
+type Svc struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+var _ s = (*Svc)(nil)
+
+func Service(log zerolog.Logger, db *bun.DB) Svc {
+	return Svc{
+		db:  db,
+		log: log,
+	}
+}
+
+// PlanListSpec is the sort orders accepted by GET /maintenance-plans.
+var PlanListSpec = api.ListSpec{
+	Alias:   "mp",
+	Sorts:   []string{"name", "created_at", "updated_at"},
+	Default: "name",
+	Search:  []string{"name"},
+}
+
+// CreatePlan adds a maintenance plan. Without match terms the plan matches items named
+// like it.
+func (s *Svc) CreatePlan(ctx context.Context, data CreatePlan) (*Plan, error) {
+	t := tenant.MustFromContext(ctx)
+
+	p := Plan{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		Name:           strings.TrimSpace(data.Name),
+		Description:    data.Description,
+		IntervalKM:     data.IntervalKM,
+		IntervalMonths: data.IntervalMonths,
+		MatchTerms:     matchTerms(data.MatchTerms),
+	}
+	if len(p.MatchTerms) == 0 {
+		p.MatchTerms = []string{p.Name}
+	}
+
+	_, err := tenant.DB(ctx, s.db).NewInsert().
+		Model(&p).
+		ExcludeColumn("created_at", "updated_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Plan(ctx, p.ID)
+}
+
+// Plan gets a maintenance plan.
+func (s *Svc) Plan(ctx context.Context, id uuid.UUID) (*Plan, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var p Plan
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&p).
+		Where("mp.id = ?", id).
+		Where("mp.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlanNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Plans lists one page of maintenance plans.
+func (s *Svc) Plans(ctx context.Context, params api.ListParams) ([]*Plan, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	ps := []*Plan{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&ps).
+		Where("mp.organization_id = ?", t.OrganizationID)
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	ps, page := api.PageOf(params, ps)
+	return ps, page, nil
+}
+
+// UpdatePlan changes a maintenance plan. An interval of 0 clears it; a plan keeps at
+// least one (422 otherwise).
+func (s *Svc) UpdatePlan(ctx context.Context, id uuid.UUID, data UpdatePlan) (*Plan, error) {
+	t := tenant.MustFromContext(ctx)
+
+	q := tenant.DB(ctx, s.db).NewUpdate().
+		Model((*Plan)(nil)).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	if data.Name != nil {
+		q = q.Set("name = ?", strings.TrimSpace(*data.Name))
+	}
+	if data.Description != nil {
+		q = q.Set("description = NULLIF(?, '')", *data.Description)
+	}
+	if data.IntervalKM != nil {
+		q = q.Set("interval_km = NULLIF(?, 0)", *data.IntervalKM)
+	}
+	if data.IntervalMonths != nil {
+		q = q.Set("interval_months = NULLIF(?, 0)", *data.IntervalMonths)
+	}
+	if data.MatchTerms != nil {
+		terms := matchTerms(data.MatchTerms)
+		if len(terms) == 0 {
+			return nil, api.Validation("request validation failed", api.FieldError{
+				Field:   "match_terms",
+				Message: "must have at least one term",
+			})
+		}
+		q = q.Set("match_terms = ?", pgdialect.Array(terms))
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := affectedOne(res, ErrPlanNotFound); err != nil {
+		return nil, err
+	}
+
+	return s.Plan(ctx, id)
+}
+
+// DeletePlan deletes a maintenance plan, detaching it from its vehicles.
+func (s *Svc) DeletePlan(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	res, err := tenant.DB(ctx, s.db).NewDelete().
+		Model((*Plan)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, ErrPlanNotFound)
+}
+
+// Attach puts a vehicle on a maintenance plan. The baseline the first interval counts
+// from defaults to now and the vehicle's current mileage.
+func (s *Svc) Attach(ctx context.Context, vehicleID uuid.UUID, data AttachPlan) (*Due, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	var mileage *int
+	err := db.NewSelect().
+		Table("vehicles").
+		Column("mileage_km").
+		Where("id = ?", vehicleID).
+		Where("organization_id = ?", t.OrganizationID).
+		Scan(ctx, &mileage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVehicleNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := db.NewSelect().
+		Model((*Plan)(nil)).
+		Where("mp.id = ?", data.PlanID).
+		Where("mp.organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, api.Validation("request validation failed", api.FieldError{
+			Field:   "plan_id",
+			Message: "maintenance plan not found",
+		})
+	}
+
+	attached, err := db.NewSelect().
+		Model((*VehiclePlan)(nil)).
+		Where("vmp.vehicle_id = ?", vehicleID).
+		Where("vmp.plan_id = ?", data.PlanID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if attached {
+		return nil, ErrAlreadyAttached
+	}
+
+	vp := VehiclePlan{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		VehicleID:      vehicleID,
+		PlanID:         data.PlanID,
+		LastServiceAt:  time.Now(),
+		LastServiceKM:  mileage,
+		CreatedBy:      t.UserID,
+	}
+	if data.LastServiceAt != nil {
+		vp.LastServiceAt = *data.LastServiceAt
+	}
+	if data.LastServiceKM != nil {
+		vp.LastServiceKM = data.LastServiceKM
+	}
+
+	_, err = db.NewInsert().
+		Model(&vp).
+		ExcludeColumn("reminded_at", "created_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dues, err := scanDue(ctx, dueQuery(db, t.OrganizationID).Where("vmp.id = ?", vp.ID), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return dues[0], nil
+}
+
+// Schedule lists when a vehicle next needs each of its plans, soonest first; plans
+// without a computable due date go last.
+func (s *Svc) Schedule(ctx context.Context, vehicleID uuid.UUID) ([]*Due, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	exists, err := db.NewSelect().
+		Table("vehicles").
+		Where("id = ?", vehicleID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrVehicleNotFound
+	}
+
+	dues, err := scanDue(ctx, dueQuery(db, t.OrganizationID).Where("vmp.vehicle_id = ?", vehicleID), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	sortDues(dues)
+	return dues, nil
+}
+
+// Detach takes a vehicle off a maintenance plan.
+func (s *Svc) Detach(ctx context.Context, vehicleID, planID uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	res, err := tenant.DB(ctx, s.db).NewDelete().
+		Model((*VehiclePlan)(nil)).
+		Where("vehicle_id = ?", vehicleID).
+		Where("plan_id = ?", planID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, ErrVehiclePlanNotFound)
+}
+
+// Due lists the services of the organization's vehicles due within the given time from
+// now, overdue ones included, soonest first.
+func (s *Svc) Due(ctx context.Context, within time.Duration) ([]*Due, error) {
+	t := tenant.MustFromContext(ctx)
+	now := time.Now()
+
+	dues, err := scanDue(ctx, dueQuery(tenant.DB(ctx, s.db), t.OrganizationID), now)
+	if err != nil {
+		return nil, err
+	}
+	return dueBy(dues, now.Add(within)), nil
+}
+
+// matchTerms trims terms and drops the empty ones and duplicates, ignoring case.
+func matchTerms(terms []string) []string {
+	seen := map[string]bool{}
+	kept := []string{}
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		key := strings.ToLower(term)
+		if term == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, term)
+	}
+	return kept
+}
+
+// affectedOne returns notFound unless res affected a row.
+func affectedOne(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -1,24 +1,29 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
 
 	"github.com/brxyxn/engine-care-api/api"
 	"github.com/brxyxn/engine-care-api/config"
+	"github.com/brxyxn/engine-care-api/internal/auth"
 )
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
 )
 
-// Auth is middleware that verifies the JWT token provided in the Authorization header.
-func Auth(conf config.Config) func(http.Handler) http.Handler {
-	jwtKey := conf.JwtSecret
+// Auth is middleware that verifies the JWT token provided in the Authorization header
+// and stores the resulting auth.Principal in the request context.
+func Auth(log zerolog.Logger, conf config.Config) func(http.Handler) http.Handler {
+	parser := newParser(conf)
+	keyFunc := newKeyFunc(log, conf)
 
 	return func(next http.Handler) http.Handler {
 
@@ -26,34 +31,108 @@ func Auth(conf config.Config) func(http.Handler) http.Handler {
 			// Expect the header to be in the format "Bearer <token>".
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				api.Error(w, http.StatusUnauthorized, api.ErrorResponse{Message: "authorization header missing"})
+				api.WriteError(w, api.Unauthorized("authorization header missing"))
 				return
 			}
 
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				api.Error(w, http.StatusUnauthorized, api.ErrorResponse{Message: "invalid authorization header format"})
+				api.WriteError(w, api.Unauthorized("invalid authorization header format"))
 				return
 			}
 			tokenStr := parts[1]
 
 			// Parse and validate the token.
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+			claims := jwt.MapClaims{}
+			token, err := parser.ParseWithClaims(tokenStr, claims, keyFunc(r.Context()))
+			if err == nil && !token.Valid {
+				err = ErrInvalidToken
+			}
+			if err != nil {
+				api.WriteError(w, api.Unauthorized("invalid token").Wrap(err))
+				return
+			}
+
+			principal, err := auth.NewPrincipal(claims)
+			if err != nil {
+				api.WriteError(w, api.Unauthorized("invalid token").Wrap(err))
+				return
+			}
+
+			// Token is valid; proceed with the request.
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// asymmetricMethods are the algorithms accepted when a JWKS source is configured.
+var asymmetricMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// hmacMethods are the algorithms accepted when tokens are signed with JwtSecret.
+var hmacMethods = []string{"HS256", "HS384", "HS512"}
+
+func usesJWKS(conf config.Config) bool {
+	return conf.JwksURL != "" || conf.JwksFile != ""
+}
+
+// newParser builds a parser enforcing the signing algorithms, exp/nbf (with leeway),
+// iss and, when configured, aud.
+func newParser(conf config.Config) *jwt.Parser {
+	methods := hmacMethods
+	if usesJWKS(conf) {
+		methods = asymmetricMethods
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(conf.JwtLeeway),
+	}
+
+	if conf.JwtIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(conf.JwtIssuer))
+	}
+
+	if len(conf.JwtAudience) > 0 {
+		opts = append(opts, jwt.WithAudience(conf.JwtAudience...))
+	}
+
+	return jwt.NewParser(opts...)
+}
+
+// newKeyFunc resolves the verification key: the JWKS key selected by the token's
+// kid when a JWKS source is configured, the shared HMAC secret otherwise.
+func newKeyFunc(log zerolog.Logger, conf config.Config) func(ctx context.Context) jwt.Keyfunc {
+	if !usesJWKS(conf) {
+		secret := []byte(conf.JwtSecret)
+		return func(context.Context) jwt.Keyfunc {
+			return func(token *jwt.Token) (interface{}, error) {
 				// Don't forget to validate the alg is what you expect:
 				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 				}
+				return secret, nil
+			}
+		}
+	}
 
-				// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-				return []byte(jwtKey), nil
-			})
-			if err != nil || !token.Valid {
-				api.Error(w, http.StatusUnauthorized, api.ErrorResponse{Stack: ErrInvalidToken.Error(), Message: "invalid token"})
-				return
+	keys := auth.SharedKeySet(auth.KeySetOptions{
+		URL:             conf.JwksURL,
+		File:            conf.JwksFile,
+		RefreshInterval: conf.JwksRefreshInterval,
+		Log:             log,
+	})
+
+	return func(ctx context.Context) jwt.Keyfunc {
+		return func(token *jwt.Token) (interface{}, error) {
+			switch token.Method.(type) {
+			case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+			default:
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 
-			// Token is valid; proceed with the request.
-			next.ServeHTTP(w, r)
-		})
+			kid, _ := token.Header["kid"].(string)
+			return keys.Key(ctx, kid, token.Method.Alg())
+		}
 	}
 }
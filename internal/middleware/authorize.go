@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// ForbiddenDetails is the error detail returned when the caller's role is not enough.
+type ForbiddenDetails struct {
+	Role     organizations.OrgRole      `json:"role,omitempty"`
+	Required []organizations.Permission `json:"required_permissions,omitempty"`
+	Roles    []organizations.OrgRole    `json:"required_roles,omitempty"`
+}
+
+// RequirePermission is middleware that only lets through members whose role grants
+// every one of perms (see organizations.Permission). It must run after Tenancy.
+func RequirePermission(perms ...organizations.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, ok := tenant.FromContext(r.Context())
+			if !ok {
+				forbidden(w, ForbiddenDetails{Required: perms})
+				return
+			}
+
+			if !t.Role.Can(perms...) {
+				forbidden(w, ForbiddenDetails{Role: t.Role, Required: perms})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole is middleware that only lets through members with one of roles.
+// Prefer RequirePermission; use this for the few actions tied to a role itself.
+// It must run after Tenancy.
+func RequireRole(roles ...organizations.OrgRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, ok := tenant.FromContext(r.Context())
+			if !ok {
+				forbidden(w, ForbiddenDetails{Roles: roles})
+				return
+			}
+
+			if !slices.Contains(roles, t.Role) {
+				forbidden(w, ForbiddenDetails{Role: t.Role, Roles: roles})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, details ForbiddenDetails) {
+	api.WriteError(w, api.Forbidden("insufficient permissions").WithDetails(details))
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var allPermissions = []organizations.Permission{
+	organizations.PermOrganizationManage,
+	organizations.PermMembersRead,
+	organizations.PermMembersManage,
+	organizations.PermCustomersRead,
+	organizations.PermCustomersWrite,
+	organizations.PermCustomersDelete,
+	organizations.PermVehiclesRead,
+	organizations.PermVehiclesWrite,
+	organizations.PermVehiclesDelete,
+	organizations.PermMaintenanceManage,
+	organizations.PermWorkOrdersRead,
+	organizations.PermWorkOrdersWrite,
+	organizations.PermWorkOrdersStatus,
+	organizations.PermWorkOrdersCancel,
+	organizations.PermWorkOrdersDelete,
+	organizations.PermAppointmentsRead,
+	organizations.PermAppointmentsWrite,
+	organizations.PermAppointmentsDelete,
+	organizations.PermProjectsRead,
+	organizations.PermProjectsWrite,
+	organizations.PermNotificationsRead,
+	organizations.PermNotificationsSend,
+}
+
+var viewerGrants = []organizations.Permission{
+	organizations.PermMembersRead,
+	organizations.PermCustomersRead,
+	organizations.PermVehiclesRead,
+	organizations.PermWorkOrdersRead,
+	organizations.PermAppointmentsRead,
+	organizations.PermProjectsRead,
+	organizations.PermNotificationsRead,
+}
+
+var mechanicGrants = append([]organizations.Permission{
+	organizations.PermCustomersWrite,
+	organizations.PermVehiclesWrite,
+	organizations.PermWorkOrdersWrite,
+	organizations.PermWorkOrdersStatus,
+	organizations.PermAppointmentsWrite,
+	organizations.PermNotificationsSend,
+}, viewerGrants...)
+
+var managerGrants = append([]organizations.Permission{
+	organizations.PermCustomersDelete,
+	organizations.PermVehiclesDelete,
+	organizations.PermMaintenanceManage,
+	organizations.PermWorkOrdersCancel,
+	organizations.PermWorkOrdersDelete,
+	organizations.PermAppointmentsDelete,
+	organizations.PermProjectsWrite,
+}, mechanicGrants...)
+
+// expectedGrants is the permission matrix the API promises, written out independently
+// of organizations.rolePermissions so a change to it has to be made here as well.
+var expectedGrants = map[organizations.OrgRole][]organizations.Permission{
+	organizations.OrgRoleOwner:    allPermissions,
+	organizations.OrgRoleAdmin:    allPermissions,
+	organizations.OrgRoleManager:  managerGrants,
+	organizations.OrgRoleMechanic: mechanicGrants,
+	organizations.OrgRoleViewer:   viewerGrants,
+}
+
+type forbiddenBody struct {
+	Code  int `json:"code"`
+	Error struct {
+		Code    api.ErrorCode    `json:"code"`
+		Message string           `json:"message"`
+		Details ForbiddenDetails `json:"details"`
+	} `json:"error"`
+}
+
+// serve runs a request through RequirePermission(perms...) as a member with role, or
+// without a tenant when role is empty.
+func serve(t *testing.T, role organizations.OrgRole, perms ...organizations.Permission) *httptest.ResponseRecorder {
+	t.Helper()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.Success[string](w, http.StatusOK, "ok")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if role != "" {
+		r = r.WithContext(tenant.WithTenant(r.Context(), tenant.Tenant{
+			OrganizationID: uuid.New(),
+			UserID:         uuid.New(),
+			Role:           role,
+		}))
+	}
+	w := httptest.NewRecorder()
+	RequirePermission(perms...)(ok).ServeHTTP(w, r)
+	return w
+}
+
+func decodeForbidden(t *testing.T, w *httptest.ResponseRecorder) forbiddenBody {
+	t.Helper()
+
+	var body forbiddenBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding 403 body %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestRequirePermissionMatrix(t *testing.T) {
+	for role, granted := range expectedGrants {
+		for _, perm := range allPermissions {
+			allowed := slices.Contains(granted, perm)
+
+			t.Run(string(role)+"/"+string(perm), func(t *testing.T) {
+				w := serve(t, role, perm)
+
+				if !allowed {
+					if w.Code != http.StatusForbidden {
+						t.Fatalf("status = %d, want 403", w.Code)
+					}
+					body := decodeForbidden(t, w)
+					if body.Code != http.StatusForbidden || body.Error.Code != api.CodeForbidden ||
+						body.Error.Message != "insufficient permissions" {
+						t.Fatalf("403 body = %s", w.Body.String())
+					}
+					d := body.Error.Details
+					if d.Role != role || !slices.Equal(d.Required, []organizations.Permission{perm}) {
+						t.Fatalf("403 details = %+v", d)
+					}
+					return
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRequirePermissionSpotChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  organizations.OrgRole
+		perms []organizations.Permission
+		want  int
+	}{
+		{"mechanic moves work orders", organizations.OrgRoleMechanic, []organizations.Permission{organizations.PermWorkOrdersStatus}, http.StatusOK},
+		{"mechanic cannot delete customers", organizations.OrgRoleMechanic, []organizations.Permission{organizations.PermCustomersDelete}, http.StatusForbidden},
+		{"viewer reads work orders", organizations.OrgRoleViewer, []organizations.Permission{organizations.PermWorkOrdersRead}, http.StatusOK},
+		{"viewer cannot write work orders", organizations.OrgRoleViewer, []organizations.Permission{organizations.PermWorkOrdersWrite}, http.StatusForbidden},
+		{"every permission is required", organizations.OrgRoleMechanic, []organizations.Permission{organizations.PermWorkOrdersWrite, organizations.PermWorkOrdersCancel}, http.StatusForbidden},
+		{"unknown role", organizations.OrgRole("intern"), []organizations.Permission{organizations.PermWorkOrdersRead}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(t, tt.role, tt.perms...); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequirePermissionWithoutTenant(t *testing.T) {
+	w := serve(t, "", organizations.PermCustomersRead)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+
+	d := decodeForbidden(t, w).Error.Details
+	if d.Role != "" || !slices.Equal(d.Required, []organizations.Permission{organizations.PermCustomersRead}) {
+		t.Fatalf("403 details = %+v", d)
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/auth"
+)
+
+var (
+	ErrInactiveUser = errors.New("user is deactivated")
+)
+
+// Provisioner maps a verified principal to an internal user id,
+// creating the user the first time it is seen.
+type Provisioner interface {
+	Provision(ctx context.Context, p *auth.Principal) (uuid.UUID, error)
+}
+
+// Provision is middleware that makes sure the authenticated caller has a users row
+// and sets auth.Principal.UserID. It must run after Auth.
+func Provision(log zerolog.Logger, prov Provisioner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				api.WriteError(w, api.Unauthorized("authentication required"))
+				return
+			}
+
+			userID, err := prov.Provision(r.Context(), principal)
+			if errors.Is(err, ErrInactiveUser) {
+				api.WriteError(w, api.Forbidden(ErrInactiveUser.Error()).Wrap(err))
+				return
+			}
+			if err != nil {
+				log.Debug().Err(err).Str("stack_user_id", principal.StackUserID).Msg("failed to provision user")
+				api.WriteError(w, err)
+				return
+			}
+
+			// Copy so the principal in the parent context stays untouched.
+			p := *principal
+			p.UserID = userID
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), &p)))
+		})
+	}
+}
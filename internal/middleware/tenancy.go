@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/auth"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrNotMember      = errors.New("not a member of this organization")
+	ErrInactiveMember = errors.New("membership in this organization is deactivated")
+)
+
+// Tenancy is middleware that scopes a request to the organization in the X-Org-Id header.
+// It must run after Auth (and Provision, when present). The caller's membership is
+// resolved and stored in the context (see tenant.FromContext), and the rest of the
+// request runs inside a transaction with app.user_id and app.organization_id set
+// locally, so the row-level security policies on every organization_id column apply
+// to the handler's queries (see tenant.DB).
+// The transaction commits when the handler answers with a non-error status.
+func Tenancy(log zerolog.Logger, db *bun.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				api.WriteError(w, api.Unauthorized("authentication required"))
+				return
+			}
+
+			orgHeader := r.Header.Get(tenant.HeaderOrgID)
+			if orgHeader == "" {
+				api.WriteError(w, api.BadRequest("X-Org-Id header missing"))
+				return
+			}
+
+			orgID, err := uuid.Parse(orgHeader)
+			if err != nil {
+				api.WriteError(w, api.BadRequest("invalid X-Org-Id header"))
+				return
+			}
+
+			tx, err := db.BeginTx(r.Context(), &sql.TxOptions{})
+			if err != nil {
+				log.Debug().Err(err).Msg("failed to begin tenant transaction")
+				api.WriteError(w, err)
+				return
+			}
+
+			committed := false
+			defer func() {
+				if !committed {
+					_ = tx.Rollback()
+				}
+			}()
+
+			t, err := resolveTenant(r.Context(), tx, principal, orgID)
+			if errors.Is(err, ErrNotMember) || errors.Is(err, ErrInactiveMember) {
+				api.WriteError(w, api.Forbidden(err.Error()).Wrap(err))
+				return
+			}
+			if err != nil {
+				log.Debug().Err(err).Str("organization_id", orgID.String()).Msg("failed to resolve tenant")
+				api.WriteError(w, err)
+				return
+			}
+
+			ctx := tenant.WithTenant(r.Context(), t)
+			ctx = tenant.WithTx(ctx, tx)
+
+			// Hold the response until the transaction is settled so a failed commit
+			// is never reported to the client as a success.
+			bw := &bufferedWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(bw, r.WithContext(ctx))
+
+			if bw.code >= http.StatusBadRequest {
+				bw.flush()
+				return
+			}
+
+			if err := tx.Commit(); err != nil {
+				log.Debug().Err(err).Str("organization_id", orgID.String()).Msg("failed to commit tenant transaction")
+				api.WriteError(w, err)
+				return
+			}
+			committed = true
+
+			bw.flush()
+		})
+	}
+}
+
+// resolveTenant sets the row-level security settings for the transaction and loads
+// the caller's membership in orgID, which must be active.
+func resolveTenant(ctx context.Context, tx bun.Tx, principal *auth.Principal, orgID uuid.UUID) (tenant.Tenant, error) {
+	// Provision already resolved (and activity-checked) the user.
+	userID := principal.UserID
+	if userID == uuid.Nil {
+		err := tx.NewSelect().
+			Table("users").
+			Column("id").
+			Where("stack_user_id = ?", principal.StackUserID).
+			Where("is_active").
+			Scan(ctx, &userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tenant.Tenant{}, ErrNotMember
+		}
+		if err != nil {
+			return tenant.Tenant{}, err
+		}
+	}
+
+	err := tenant.Configure(ctx, tx, userID, orgID)
+	if err != nil {
+		return tenant.Tenant{}, err
+	}
+
+	member := organizations.OrganizationMember{}
+	err = tx.NewSelect().
+		Model(&member).
+		Where("om.organization_id = ?", orgID).
+		Where("om.user_id = ?", userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tenant.Tenant{}, ErrNotMember
+	}
+	if err != nil {
+		return tenant.Tenant{}, err
+	}
+	if !member.IsActive {
+		return tenant.Tenant{}, ErrInactiveMember
+	}
+
+	return tenant.Tenant{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           member.Role,
+	}, nil
+}
+
+// bufferedWriter holds the status code and body written by a handler until flush.
+type bufferedWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (b *bufferedWriter) WriteHeader(code int) {
+	if b.wroteHeader {
+		return
+	}
+	b.code = code
+	b.wroteHeader = true
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.buf.Write(p)
+}
+
+func (b *bufferedWriter) flush() {
+	b.ResponseWriter.WriteHeader(b.code)
+	_, _ = b.buf.WriteTo(b.ResponseWriter)
+}
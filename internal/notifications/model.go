@@ -18,6 +18,35 @@ const (
 	ChannelWebhook  Channel = "webhook"
 )
 
+// Valid reports whether c is a known notification channel.
+func (c Channel) Valid() bool {
+	switch c {
+	case ChannelEmail, ChannelSMS, ChannelWhatsApp, ChannelPush, ChannelWebhook:
+		return true
+	}
+	return false
+}
+
+// Status is where a notification is in its delivery.
+type Status string
+
+const (
+	StatusQueued Status = "queued"
+	StatusSent   Status = "sent"
+	StatusFailed Status = "failed"
+)
+
+// Valid reports whether s is a known notification status.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusQueued, StatusSent, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// NotificationLog is a notification to a customer. Queued notifications wait for a
+// sender and have no SentAt yet.
 type NotificationLog struct {
 	bun.BaseModel `bun:"table:notification_logs,alias:nl"`
 
@@ -29,6 +58,8 @@ type NotificationLog struct {
 	Channel        Channel         `bun:"channel,type:notify_channel,notnull" json:"channel"`
 	Recipient      string          `bun:"recipient,notnull" json:"recipient"`
 	TemplateKey    *string         `bun:"template_key" json:"template_key,omitempty"`
-	SentAt         time.Time       `bun:"sent_at,notnull,default:now()" json:"sent_at"`
+	Status         Status          `bun:"status,type:notify_status,notnull,default:sent" json:"status"`
+	QueuedAt       time.Time       `bun:"queued_at,notnull,default:now()" json:"queued_at"`
+	SentAt         *time.Time      `bun:"sent_at" json:"sent_at,omitempty"`
 	Meta           json.RawMessage `bun:"meta,type:jsonb,notnull,default:'{}'" json:"meta"`
 }
@@ -0,0 +1,169 @@
+package organizations
+
+import (
+	"context"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+)
+
+var (
+	hexColor     = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// UpdateBranding holds the branding fields PATCH /organization/branding may change; nil
+// fields are left untouched and empty strings clear them.
+type UpdateBranding struct {
+	LegalName     *string `json:"legal_name,omitempty" validate:"max=200"`
+	Address       *string `json:"address,omitempty" validate:"max=500"`
+	TaxID         *string `json:"tax_id,omitempty" validate:"max=64"`
+	Email         *string `json:"email,omitempty" validate:"max=254"`
+	Phone         *string `json:"phone,omitempty" validate:"max=40"`
+	Website       *string `json:"website,omitempty" validate:"max=2048"`
+	LogoURL       *string `json:"logo_url,omitempty" validate:"max=2048"`
+	AccentColor   *string `json:"accent_color,omitempty"`
+	Currency      *string `json:"currency,omitempty"`
+	InvoiceFooter *string `json:"invoice_footer,omitempty" validate:"max=1000"`
+}
+
+// Validate checks the formats of the fields being set; empty strings clear a field and
+// are always accepted.
+func (b UpdateBranding) Validate() error {
+	var fe api.FieldErrors
+	if b.AccentColor != nil && *b.AccentColor != "" && !hexColor.MatchString(*b.AccentColor) {
+		fe.Add("accent_color", "must be a hex color such as #1f2937")
+	}
+	if b.LogoURL != nil && *b.LogoURL != "" && !httpsURL(*b.LogoURL) {
+		fe.Add("logo_url", "must be a valid https URL")
+	}
+	if b.Email != nil && *b.Email != "" {
+		if addr, err := mail.ParseAddress(*b.Email); err != nil || addr.Address != *b.Email {
+			fe.Add("email", "must be a valid email address")
+		}
+	}
+	if b.Website != nil && *b.Website != "" && !httpURL(*b.Website) {
+		fe.Add("website", "must be a valid http(s) URL")
+	}
+	if b.Currency != nil && *b.Currency != "" && !currencyCode.MatchString(*b.Currency) {
+		fe.Add("currency", "must be an ISO 4217 code such as USD")
+	}
+	return fe.Err()
+}
+
+// Accent returns the accent color, or def when none is set or it is not a #rrggbb
+// color (branding saved before it was validated).
+func (b Branding) Accent(def string) string {
+	if hexColor.MatchString(b.AccentColor) {
+		return b.AccentColor
+	}
+	return def
+}
+
+// httpURL reports whether s is an absolute http or https URL.
+func httpURL(s string) bool {
+	u, err := url.ParseRequestURI(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// httpsURL reports whether s is an absolute https URL. Logos are embedded in invoice
+// pages, where an http image would be blocked as mixed content.
+func httpsURL(s string) bool {
+	u, err := url.ParseRequestURI(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// Scope returns the request transaction and organization of an organization scoped
+// request. tenant and middleware build on this package, so it cannot read the tenant
+// itself; internal.Routes hands it tenant.DB and the tenant's organization.
+type Scope func(ctx context.Context) (bun.IDB, uuid.UUID)
+
+type bs interface {
+	Branding(ctx context.Context) (*Branding, error)
+	UpdateBranding(ctx context.Context, data UpdateBranding) (*Branding, error)
+}
+
+// BrandingSvc manages the branding of the request's organization. Every method must
+// run behind middleware.Tenancy, see Scope.
+type BrandingSvc struct {
+	scope Scope
+	log   zerolog.Logger
+}
+
+var _ bs = (*BrandingSvc)(nil)
+
+func BrandingService(log zerolog.Logger, scope Scope) BrandingSvc {
+	return BrandingSvc{
+		scope: scope,
+		log:   log,
+	}
+}
+
+// Branding gets the organization's branding, see Branding.
+func (s *BrandingSvc) Branding(ctx context.Context) (*Branding, error) {
+	db, orgID := s.scope(ctx)
+
+	var org Organization
+	err := db.NewSelect().
+		Model(&org).
+		Column("branding").
+		Where("org.id = ?", orgID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &org.Branding, nil
+}
+
+// UpdateBranding applies the non-nil fields of data to the organization's branding.
+// It shows on invoices rendered from then on; issued invoices keep theirs.
+func (s *BrandingSvc) UpdateBranding(ctx context.Context, data UpdateBranding) (*Branding, error) {
+	db, orgID := s.scope(ctx)
+
+	var org Organization
+	err := db.NewSelect().
+		Model(&org).
+		Column("branding").
+		Where("org.id = ?", orgID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b := org.Branding
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = strings.TrimSpace(*value)
+		}
+	}
+	set(&b.LegalName, data.LegalName)
+	set(&b.Address, data.Address)
+	set(&b.TaxID, data.TaxID)
+	set(&b.Email, data.Email)
+	set(&b.Phone, data.Phone)
+	set(&b.Website, data.Website)
+	set(&b.LogoURL, data.LogoURL)
+	set(&b.AccentColor, data.AccentColor)
+	set(&b.Currency, data.Currency)
+	set(&b.InvoiceFooter, data.InvoiceFooter)
+
+	_, err = db.NewUpdate().
+		Model((*Organization)(nil)).
+		Set("branding = ?", b).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", orgID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
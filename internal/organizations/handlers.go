@@ -0,0 +1,60 @@
+package organizations
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/brxyxn/engine-care-api/api"
+)
+
+type bh interface {
+	Branding() http.HandlerFunc
+	UpdateBranding() http.HandlerFunc
+}
+
+type BrandingHdlr struct {
+	log zerolog.Logger
+	svc BrandingSvc
+}
+
+var _ bh = (*BrandingHdlr)(nil)
+
+func BrandingHandler(log zerolog.Logger, scope Scope) BrandingHdlr {
+	svc := BrandingService(log, scope)
+	return BrandingHdlr{log, svc}
+}
+
+// Branding returns how the organization presents itself on invoices.
+func (h *BrandingHdlr) Branding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := h.svc.Branding(r.Context())
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting organization branding")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Branding](w, http.StatusOK, b)
+	}
+}
+
+// UpdateBranding changes the organization's branding.
+func (h *BrandingHdlr) UpdateBranding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[UpdateBranding](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		b, err := h.svc.UpdateBranding(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating organization branding")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Branding](w, http.StatusOK, b)
+	}
+}
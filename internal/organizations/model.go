@@ -24,10 +24,27 @@ type Organization struct {
 	ID          uuid.UUID `bun:"id,pk,default:gen_random_uuid()" json:"id"`
 	Name        string    `bun:"name,notnull" json:"name"`
 	StackTeamID *string   `bun:"stack_team_id" json:"stack_team_id,omitempty"`
+	Branding    Branding  `bun:"branding,type:jsonb,notnull,default:'{}'" json:"branding"`
+	TimeZone    string    `bun:"time_zone,notnull,default:'UTC'" json:"time_zone"` // IANA name, e.g. America/Bogota
 	CreatedAt   time.Time `bun:"created_at,notnull,default:now()" json:"created_at"`
 	UpdatedAt   time.Time `bun:"updated_at,notnull,default:now()" json:"updated_at"`
 }
 
+// Branding is how an organization presents itself on customer documents such as
+// invoices. Every field is optional.
+type Branding struct {
+	LegalName     string `json:"legal_name,omitempty"`
+	Address       string `json:"address,omitempty"`
+	TaxID         string `json:"tax_id,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Phone         string `json:"phone,omitempty"`
+	Website       string `json:"website,omitempty"`
+	LogoURL       string `json:"logo_url,omitempty"`
+	AccentColor   string `json:"accent_color,omitempty"` // #rrggbb
+	Currency      string `json:"currency,omitempty"`     // shown next to amounts, e.g. USD
+	InvoiceFooter string `json:"invoice_footer,omitempty"`
+}
+
 type OrganizationMember struct {
 	bun.BaseModel `bun:"table:organization_members,alias:om"`
 
@@ -36,5 +53,6 @@ type OrganizationMember struct {
 	UserID         uuid.UUID  `bun:"user_id,notnull" json:"user_id"`
 	Role           OrgRole    `bun:"role,type:org_role,notnull,default:viewer" json:"role"`
 	InvitedBy      *uuid.UUID `bun:"invited_by" json:"invited_by,omitempty"`
+	IsActive       bool       `bun:"is_active,notnull,default:true" json:"is_active"`
 	CreatedAt      time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
 }
@@ -0,0 +1,111 @@
+package organizations
+
+// Permission is an action a member may perform inside an organization,
+// written as "<resource>:<action>".
+type Permission string
+
+const (
+	PermOrganizationManage Permission = "organization:manage"
+	PermMembersRead        Permission = "members:read"
+	PermMembersManage      Permission = "members:manage"
+
+	PermCustomersRead   Permission = "customers:read"
+	PermCustomersWrite  Permission = "customers:write"
+	PermCustomersDelete Permission = "customers:delete"
+
+	PermVehiclesRead   Permission = "vehicles:read"
+	PermVehiclesWrite  Permission = "vehicles:write"
+	PermVehiclesDelete Permission = "vehicles:delete"
+	// PermVehiclesCorrect voids wrong odometer readings.
+	PermVehiclesCorrect Permission = "vehicles:correct"
+
+	PermMaintenanceManage Permission = "maintenance:manage"
+
+	PermWorkOrdersRead   Permission = "workorders:read"
+	PermWorkOrdersWrite  Permission = "workorders:write"
+	PermWorkOrdersStatus Permission = "workorders:status"
+	PermWorkOrdersCancel Permission = "workorders:cancel"
+	PermWorkOrdersDelete Permission = "workorders:delete"
+
+	PermAppointmentsRead   Permission = "appointments:read"
+	PermAppointmentsWrite  Permission = "appointments:write"
+	PermAppointmentsDelete Permission = "appointments:delete"
+
+	PermProjectsRead  Permission = "projects:read"
+	PermProjectsWrite Permission = "projects:write"
+
+	PermNotificationsRead Permission = "notifications:read"
+	PermNotificationsSend Permission = "notifications:send"
+)
+
+var readPermissions = []Permission{
+	PermMembersRead,
+	PermCustomersRead,
+	PermVehiclesRead,
+	PermWorkOrdersRead,
+	PermAppointmentsRead,
+	PermProjectsRead,
+	PermNotificationsRead,
+}
+
+// mechanicPermissions lets mechanics run the shop floor: they can create and
+// move work orders, touch customers/vehicles/appointments, but never delete.
+var mechanicPermissions = append([]Permission{
+	PermCustomersWrite,
+	PermVehiclesWrite,
+	PermWorkOrdersWrite,
+	PermWorkOrdersStatus,
+	PermAppointmentsWrite,
+	PermNotificationsSend,
+}, readPermissions...)
+
+var managerPermissions = append([]Permission{
+	PermWorkOrdersCancel,
+	PermCustomersDelete,
+	PermVehiclesDelete,
+	PermVehiclesCorrect,
+	PermWorkOrdersDelete,
+	PermAppointmentsDelete,
+	PermProjectsWrite,
+	PermMaintenanceManage,
+}, mechanicPermissions...)
+
+var adminPermissions = append([]Permission{
+	PermOrganizationManage,
+	PermMembersManage,
+}, managerPermissions...)
+
+// rolePermissions is the permission matrix. Keep it in sync with the
+// has_org_role(...) checks in the RLS policies under cmd/bun/migrations.
+var rolePermissions = map[OrgRole]map[Permission]bool{
+	OrgRoleOwner:    permissionSet(adminPermissions),
+	OrgRoleAdmin:    permissionSet(adminPermissions),
+	OrgRoleManager:  permissionSet(managerPermissions),
+	OrgRoleMechanic: permissionSet(mechanicPermissions),
+	OrgRoleViewer:   permissionSet(readPermissions),
+}
+
+func permissionSet(perms []Permission) map[Permission]bool {
+	set := make(map[Permission]bool, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+// Valid reports whether r is one of the known roles.
+func (r OrgRole) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants every one of perms.
+func (r OrgRole) Can(perms ...Permission) bool {
+	granted := rolePermissions[r]
+	for _, p := range perms {
+		if !granted[p] {
+			return false
+		}
+	}
+	return true
+}
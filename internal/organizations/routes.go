@@ -0,0 +1,20 @@
+package organizations
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the organization branding endpoints; branding is what invoices show
+// of the organization. They are organization scoped, but middleware builds on this
+// package: internal.Routes passes the read and manage chains (tenancy and the
+// permission checks) and the request Scope.
+func Routes(v1 *mux.Router, log zerolog.Logger, scope Scope, read, manage mwchain.Chain) {
+	brHandler := BrandingHandler(log, scope)
+
+	v1.Handle("/organization/branding", read.Then(brHandler.Branding())).Methods(api.GET)
+	v1.Handle("/organization/branding", manage.Then(brHandler.UpdateBranding())).Methods(api.PATCH)
+}
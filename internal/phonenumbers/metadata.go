@@ -0,0 +1,148 @@
+package phonenumbers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// metadata.json holds, per country calling code, the valid national number lengths,
+// the national (trunk) prefix dialed inside the country, and the patterns used to
+// validate and classify numbers. Patterns match the whole national significant number.
+//
+//go:embed metadata.json
+var metadataJSON []byte
+
+type countryMetadata struct {
+	CountryCode    string   `json:"country_code"`
+	Regions        []string `json:"regions"`
+	NationalPrefix string   `json:"national_prefix"`
+	Lengths        []int    `json:"lengths"`
+	Pattern        string   `json:"pattern"`
+	Mobile         string   `json:"mobile"`
+	FixedLine      string   `json:"fixed_line"`
+
+	pattern   *regexp.Regexp
+	mobile    *regexp.Regexp
+	fixedLine *regexp.Regexp
+}
+
+// metadata is keyed by country calling code.
+var metadata = loadMetadata(metadataJSON)
+
+// ituCallingCodes lists the country calling codes assigned by ITU-T E.164. Codes
+// without an entry in metadata.json are validated by the generic E.164 rules only.
+var ituCallingCodes = []string{
+	"1", "7",
+	"20", "27", "30", "31", "32", "33", "34", "36", "39", "40", "41", "43", "44", "45", "46", "47", "48", "49",
+	"51", "52", "53", "54", "55", "56", "57", "58", "60", "61", "62", "63", "64", "65", "66",
+	"81", "82", "84", "86", "90", "91", "92", "93", "94", "95", "98",
+	"211", "212", "213", "216", "218", "220", "221", "222", "223", "224", "225", "226", "227", "228", "229",
+	"230", "231", "232", "233", "234", "235", "236", "237", "238", "239", "240", "241", "242", "243", "244",
+	"245", "246", "247", "248", "249", "250", "251", "252", "253", "254", "255", "256", "257", "258",
+	"260", "261", "262", "263", "264", "265", "266", "267", "268", "269", "290", "291", "297", "298", "299",
+	"350", "351", "352", "353", "354", "355", "356", "357", "358", "359",
+	"370", "371", "372", "373", "374", "375", "376", "377", "378", "380", "381", "382", "383", "385", "386",
+	"387", "389", "420", "421", "423",
+	"500", "501", "502", "503", "504", "505", "506", "507", "508", "509",
+	"590", "591", "592", "593", "594", "595", "596", "597", "598", "599",
+	"670", "672", "673", "674", "675", "676", "677", "678", "679", "680", "681", "682", "683", "685", "686",
+	"687", "688", "689", "690", "691", "692",
+	"800", "808", "850", "852", "853", "855", "856", "870", "878", "880", "881", "882", "883", "886", "888",
+	"960", "961", "962", "963", "964", "965", "966", "967", "968", "970", "971", "972", "973", "974", "975",
+	"976", "977", "979", "992", "993", "994", "995", "996", "998",
+}
+
+// E.164 numbers have at most 15 digits including the calling code; no country uses
+// national numbers shorter than 4 digits.
+const (
+	maxE164Digits     = 15
+	minNationalDigits = 4
+)
+
+func loadMetadata(data []byte) map[string]*countryMetadata {
+	var countries []*countryMetadata
+	if err := json.Unmarshal(data, &countries); err != nil {
+		panic(fmt.Sprintf("phonenumbers: invalid metadata: %v", err))
+	}
+
+	byCode := make(map[string]*countryMetadata, len(countries))
+	for _, c := range countries {
+		c.pattern = compileWhole(c.Pattern)
+		c.mobile = compileWhole(c.Mobile)
+		c.fixedLine = compileWhole(c.FixedLine)
+		byCode[c.CountryCode] = c
+	}
+
+	for _, cc := range ituCallingCodes {
+		if _, ok := byCode[cc]; !ok {
+			byCode[cc] = genericMetadata(cc)
+		}
+	}
+	return byCode
+}
+
+// genericMetadata accepts any national number of cc that fits in E.164, without
+// stripping a trunk prefix or telling mobile and fixed lines apart.
+func genericMetadata(cc string) *countryMetadata {
+	c := &countryMetadata{CountryCode: cc}
+	for l := minNationalDigits; l <= maxE164Digits-len(cc); l++ {
+		c.Lengths = append(c.Lengths, l)
+	}
+	return c
+}
+
+func compileWhole(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	return regexp.MustCompile("^(?:" + pattern + ")$")
+}
+
+func (c *countryMetadata) validLength(national string) bool {
+	for _, l := range c.Lengths {
+		if len(national) == l {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *countryMetadata) minLength() int {
+	m := c.Lengths[0]
+	for _, l := range c.Lengths {
+		m = min(m, l)
+	}
+	return m
+}
+
+func (c *countryMetadata) maxLength() int {
+	m := c.Lengths[0]
+	for _, l := range c.Lengths {
+		m = max(m, l)
+	}
+	return m
+}
+
+func (c *countryMetadata) lineType(national string) LineType {
+	mobile := c.mobile != nil && c.mobile.MatchString(national)
+	fixed := c.fixedLine != nil && c.fixedLine.MatchString(national)
+
+	switch {
+	case mobile && fixed:
+		return LineTypeFixedLineOrMobile
+	case mobile:
+		return LineTypeMobile
+	case fixed:
+		return LineTypeFixedLine
+	default:
+		return LineTypeUnknown
+	}
+}
+
+// SupportedCountryCode reports whether numbers with the calling code cc can be parsed.
+func SupportedCountryCode(cc string) bool {
+	_, ok := metadata[cc]
+	return ok
+}
@@ -1,6 +1,7 @@
 package phonenumbers
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,5 +16,25 @@ type PhoneNumber struct {
 	E164           string    `bun:"e164,notnull" json:"e164"`
 	CountryCode    string    `bun:"country_code,notnull" json:"country_code"`
 	NationalNumber string    `bun:"national_number,notnull" json:"national_number"`
+	LineType       LineType  `bun:"line_type,notnull,default:'unknown'" json:"line_type"`
 	CreatedAt      time.Time `bun:"created_at,notnull,default:now()" json:"created_at"`
 }
+
+// CanReceiveSMS reports whether the number may be a mobile line.
+func (pn PhoneNumber) CanReceiveSMS() bool {
+	return pn.LineType == LineTypeMobile || pn.LineType == LineTypeFixedLineOrMobile
+}
+
+// Upsert stores pn, reusing the existing row with the same E.164 number; pn.ID is set
+// to the stored row's ID.
+func Upsert(ctx context.Context, db bun.IDB, pn *PhoneNumber) error {
+	_, err := db.NewInsert().
+		Model(pn).
+		Column("id", "raw_number", "e164", "country_code", "national_number", "line_type").
+		On("CONFLICT (e164) DO UPDATE").
+		Set("raw_number = EXCLUDED.raw_number").
+		Set("line_type = EXCLUDED.line_type").
+		Returning("id").
+		Exec(ctx)
+	return err
+}
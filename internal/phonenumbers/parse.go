@@ -0,0 +1,193 @@
+package phonenumbers
+
+import (
+	"errors"
+	"strings"
+)
+
+// LineType classifies a number as mobile or landline, when the country's numbering plan allows telling them apart.
+type LineType string
+
+const (
+	LineTypeMobile            LineType = "mobile"
+	LineTypeFixedLine         LineType = "fixed_line"
+	LineTypeFixedLineOrMobile LineType = "fixed_line_or_mobile" // e.g. NANP, where both share the same ranges
+	LineTypeUnknown           LineType = "unknown"
+)
+
+// Fields reported by ParseError.
+const (
+	FieldCountryCode = "country_code"
+	FieldNumber      = "number"
+)
+
+// maxDigits is the longest digit string accepted: 15 digits of E.164 plus a 00 exit code.
+const maxDigits = 17
+
+var (
+	ErrEmpty              = errors.New("phone number is required")
+	ErrInvalidCharacters  = errors.New("phone number contains invalid characters")
+	ErrMissingCountryCode = errors.New("country code is required for numbers without an international prefix")
+	ErrUnknownCountryCode = errors.New("unsupported country calling code")
+	ErrTooShort           = errors.New("phone number is too short")
+	ErrTooLong            = errors.New("phone number is too long")
+	ErrInvalidLength      = errors.New("phone number has an invalid length for its country")
+	ErrInvalidNumber      = errors.New("phone number is not valid for its country")
+)
+
+// ParseError is returned by Parse and names the input field that was rejected.
+type ParseError struct {
+	Field string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse parses a free-form phone number into its E.164 form.
+//
+// raw may contain spaces, dashes, dots, slashes and parentheses. Numbers starting with
+// "+" or "00" (or "011" for NANP callers) are international and carry their own calling
+// code; anything else is a national number in countryCode, which may be written as "1",
+// "+1" or "001". A national (trunk) prefix such as the leading 0 of "020 7946 0018" is
+// dropped, also when it was kept after the calling code ("+44 (0)20 ...").
+func Parse(raw, countryCode string) (PhoneNumber, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return PhoneNumber{}, &ParseError{FieldNumber, ErrEmpty}
+	}
+
+	cc, err := normalizeCountryCode(countryCode)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+
+	digits, plus, err := extractDigits(raw)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+	if len(digits) > maxDigits {
+		return PhoneNumber{}, &ParseError{FieldNumber, ErrTooLong}
+	}
+
+	var national string
+	switch {
+	case plus:
+		cc, national, err = splitCountryCode(digits)
+	case strings.HasPrefix(digits, "00"):
+		cc, national, err = splitCountryCode(digits[2:])
+	case cc == "1" && strings.HasPrefix(digits, "011"):
+		cc, national, err = splitCountryCode(digits[3:])
+	case cc == "":
+		err = &ParseError{FieldCountryCode, ErrMissingCountryCode}
+	default:
+		national = digits
+	}
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+
+	meta := metadata[cc]
+	national = stripNationalPrefix(meta, national)
+
+	if err := validate(meta, national); err != nil {
+		return PhoneNumber{}, err
+	}
+
+	return PhoneNumber{
+		RawNumber:      raw,
+		E164:           "+" + cc + national,
+		CountryCode:    cc,
+		NationalNumber: national,
+		LineType:       meta.lineType(national),
+	}, nil
+}
+
+// normalizeCountryCode accepts "", "1", "+1" or "001" and returns the bare calling code.
+func normalizeCountryCode(countryCode string) (string, error) {
+	cc := strings.TrimSpace(countryCode)
+	cc = strings.TrimPrefix(cc, "+")
+	cc = strings.TrimPrefix(cc, "00")
+	if cc == "" {
+		return "", nil
+	}
+
+	if !SupportedCountryCode(cc) {
+		return "", &ParseError{FieldCountryCode, ErrUnknownCountryCode}
+	}
+	return cc, nil
+}
+
+// extractDigits drops formatting characters from raw and reports whether it started with "+".
+func extractDigits(raw string) (string, bool, error) {
+	var b strings.Builder
+	plus := false
+
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			plus = true
+		case r == ' ', r == '-', r == '.', r == '/', r == '(', r == ')':
+		default:
+			return "", false, &ParseError{FieldNumber, ErrInvalidCharacters}
+		}
+	}
+
+	if b.Len() == 0 {
+		return "", false, &ParseError{FieldNumber, ErrInvalidCharacters}
+	}
+	return b.String(), plus, nil
+}
+
+// splitCountryCode splits an international digit string into its calling code and
+// national number. Calling codes are prefix-free, so the first match is the only one.
+func splitCountryCode(digits string) (string, string, error) {
+	for i := 1; i <= 3 && i <= len(digits); i++ {
+		if SupportedCountryCode(digits[:i]) {
+			return digits[:i], digits[i:], nil
+		}
+	}
+	return "", "", &ParseError{FieldNumber, ErrUnknownCountryCode}
+}
+
+// stripNationalPrefix removes the country's trunk prefix when the number is only valid without it.
+func stripNationalPrefix(meta *countryMetadata, national string) string {
+	prefix := meta.NationalPrefix
+	if prefix == "" || !strings.HasPrefix(national, prefix) {
+		return national
+	}
+	if validate(meta, national) == nil {
+		return national
+	}
+
+	stripped := national[len(prefix):]
+	if validate(meta, stripped) != nil {
+		return national
+	}
+	return stripped
+}
+
+func validate(meta *countryMetadata, national string) error {
+	if !meta.validLength(national) {
+		switch {
+		case len(national) < meta.minLength():
+			return &ParseError{FieldNumber, ErrTooShort}
+		case len(national) > meta.maxLength():
+			return &ParseError{FieldNumber, ErrTooLong}
+		default:
+			return &ParseError{FieldNumber, ErrInvalidLength}
+		}
+	}
+
+	if meta.pattern != nil && !meta.pattern.MatchString(national) {
+		return &ParseError{FieldNumber, ErrInvalidNumber}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package phonenumbers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw, cc     string
+		e164        string
+		national    string
+		lineType    LineType
+		countryCode string
+	}{
+		{"spaces", "202 555 0143", "1", "+12025550143", "2025550143", LineTypeFixedLineOrMobile, "1"},
+		{"dashes", "202-555-0143", "1", "+12025550143", "2025550143", LineTypeFixedLineOrMobile, "1"},
+		{"parentheses", "(202) 555-0143", "+1", "+12025550143", "2025550143", LineTypeFixedLineOrMobile, "1"},
+		{"dots and slashes", "202.555/0143", "001", "+12025550143", "2025550143", LineTypeFixedLineOrMobile, "1"},
+		{"NANP trunk prefix", "1 202 555 0143", "1", "+12025550143", "2025550143", LineTypeFixedLineOrMobile, "1"},
+		{"plus prefix", "+44 20 7946 0018", "", "+442079460018", "2079460018", LineTypeFixedLine, "44"},
+		{"plus prefix overrides country", "+52 55 1234 5678", "1", "+525512345678", "5512345678", LineTypeUnknown, "52"},
+		{"00 prefix", "0044 7700 900123", "", "+447700900123", "7700900123", LineTypeMobile, "44"},
+		{"011 prefix of NANP callers", "011 52 55 1234 5678", "1", "+525512345678", "5512345678", LineTypeUnknown, "52"},
+		{"trunk prefix", "020 7946 0018", "44", "+442079460018", "2079460018", LineTypeFixedLine, "44"},
+		{"trunk prefix after calling code", "+44 (0)20 7946 0018", "", "+442079460018", "2079460018", LineTypeFixedLine, "44"},
+		{"trunk prefix, mobile", "(011) 98765-4321", "55", "+5511987654321", "11987654321", LineTypeMobile, "55"},
+		{"surrounding space", "  +49 30 1234567 ", "", "+49301234567", "301234567", LineTypeFixedLine, "49"},
+		{"generic rules, 1-digit code", "+7 495 123-45-67", "", "+74951234567", "4951234567", LineTypeUnknown, "7"},
+		{"generic rules, 3-digit code", "+254 712 345678", "", "+254712345678", "712345678", LineTypeUnknown, "254"},
+		{"generic rules, national", "712 345678", "254", "+254712345678", "712345678", LineTypeUnknown, "254"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pn, err := Parse(tt.raw, tt.cc)
+			if err != nil {
+				t.Fatalf("Parse(%q, %q): %v", tt.raw, tt.cc, err)
+			}
+			if pn.E164 != tt.e164 || pn.NationalNumber != tt.national || pn.CountryCode != tt.countryCode {
+				t.Errorf("Parse(%q, %q) = %s (%s %s), want %s (%s %s)",
+					tt.raw, tt.cc, pn.E164, pn.CountryCode, pn.NationalNumber, tt.e164, tt.countryCode, tt.national)
+			}
+			if pn.LineType != tt.lineType {
+				t.Errorf("line type = %s, want %s", pn.LineType, tt.lineType)
+			}
+			if pn.RawNumber != strings.TrimSpace(tt.raw) {
+				t.Errorf("raw number = %q, want the trimmed input", pn.RawNumber)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw, cc string
+		field   string
+		err     error
+	}{
+		{"empty", "   ", "1", FieldNumber, ErrEmpty},
+		{"letters", "call me", "1", FieldNumber, ErrInvalidCharacters},
+		{"vanity letters", "1-800-FLOWERS", "1", FieldNumber, ErrInvalidCharacters},
+		{"extension mark", "202 555 0143 #12", "1", FieldNumber, ErrInvalidCharacters},
+		{"plus inside", "202+5550143", "1", FieldNumber, ErrInvalidCharacters},
+		{"only formatting", "+ ( ) -", "1", FieldNumber, ErrInvalidCharacters},
+		{"missing country code", "202 555 0143", "", FieldCountryCode, ErrMissingCountryCode},
+		{"unassigned country code", "12345678", "999", FieldCountryCode, ErrUnknownCountryCode},
+		{"unassigned international code", "+999 1234 5678", "", FieldNumber, ErrUnknownCountryCode},
+		{"too short", "202 555", "1", FieldNumber, ErrTooShort},
+		{"too long", "202 555 0143 99", "1", FieldNumber, ErrTooLong},
+		{"over 17 digits", "+1 202 555 0143 0143 0143", "", FieldNumber, ErrTooLong},
+		{"invalid number", "05 1234 5678", "52", FieldNumber, ErrInvalidNumber},
+		{"NANP area code", "102 555 0143", "1", FieldNumber, ErrInvalidNumber},
+		{"generic too short", "+7 123", "", FieldNumber, ErrTooShort},
+		{"generic too long", "+254 1234 5678 9012 3", "", FieldNumber, ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.raw, tt.cc)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q, %q) error = %v, want %v", tt.raw, tt.cc, err, tt.err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Field != tt.field {
+				t.Fatalf("Parse(%q, %q) error field = %v, want %s", tt.raw, tt.cc, err, tt.field)
+			}
+		})
+	}
+}
+
+func TestCallingCodesArePrefixFree(t *testing.T) {
+	for a := range metadata {
+		for b := range metadata {
+			if a != b && len(a) < len(b) && b[:len(a)] == a {
+				t.Errorf("calling code %s is a prefix of %s", a, b)
+			}
+		}
+	}
+}
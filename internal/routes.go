@@ -4,12 +4,23 @@ import (
 	"context"
 
 	"github.com/brxyxn/go-logger"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/uptrace/bun"
 
+	"github.com/brxyxn/engine-care-api/api"
 	"github.com/brxyxn/engine-care-api/config"
+	"github.com/brxyxn/engine-care-api/internal/appointments"
+	"github.com/brxyxn/engine-care-api/internal/customers"
+	"github.com/brxyxn/engine-care-api/internal/maintenance"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
 	"github.com/brxyxn/engine-care-api/internal/status"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
 	"github.com/brxyxn/engine-care-api/internal/users"
+	"github.com/brxyxn/engine-care-api/internal/vehicles"
+	"github.com/brxyxn/engine-care-api/internal/workorders"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
 )
 
 type Routes struct {
@@ -21,6 +32,8 @@ type Routes struct {
 }
 
 func NewRoutes(ctx context.Context, cfg config.Config, log *logger.Logger, db *bun.DB) *Routes {
+	api.SetEnv(cfg.Env)
+
 	return &Routes{
 		rtr: mux.NewRouter(),
 		ctx: ctx,
@@ -43,8 +56,45 @@ func (r Routes) ConfigRoutes() *mux.Router {
 	// Public endpoints.
 	status.Routes(v1, log, cfg, db)
 
-	// Private endpoints
-	users.Routes(ctx, v1, log, db)
+	// Private endpoints share one authentication chain: verify the token, then
+	// make sure the caller has a users row (created on first sight).
+	authLog := log.With().Str("component", "auth").Logger()
+	provLog := log.With().Str("component", "provisioner").Logger()
+	provisioner := users.NewProvisioner(provLog, db, cfg.UserSyncInterval)
+	authn := mwchain.NewChain(
+		middleware.Auth(authLog, cfg),
+		middleware.Provision(provLog, provisioner),
+	)
+
+	users.Routes(ctx, v1, log, db, provisioner, authn)
+
+	// Organization scoped endpoints also resolve the caller's membership in the
+	// X-Org-Id organization.
+	tenancyLog := log.With().Str("component", "tenancy").Logger()
+	r.organizationRoutes(v1, provisioner, authn.Append(middleware.Tenancy(tenancyLog, db)))
 
 	return r.rtr
 }
+
+// organizationRoutes registers the organization scoped endpoints behind tenancy.
+func (r Routes) organizationRoutes(v1 *mux.Router, prov *users.Provisioner, tenancy mwchain.Chain) {
+	users.MemberRoutes(r.ctx, v1, r.log, r.db, prov, tenancy)
+	customers.Routes(r.ctx, v1, r.log, r.db, tenancy)
+	maintenance.Routes(r.ctx, v1, r.log, r.db, tenancy) // before vehicles, see maintenance.Routes
+	vehicles.Routes(r.ctx, v1, r.log, r.db, tenancy)
+	workorders.Routes(r.ctx, v1, r.log, r.cfg, r.db, tenancy)
+	appointments.Routes(r.ctx, v1, r.log, r.db, tenancy)
+
+	// organizations sits below middleware and tenant, so its chains and request scope
+	// are assembled here.
+	orgLog := r.log.With().Str("route", "organization").Logger()
+	scoped := mwchain.NewChain(middleware.Logger(orgLog)).Extend(tenancy)
+	organizations.Routes(v1, orgLog, r.scope,
+		scoped.Append(middleware.RequirePermission(organizations.PermWorkOrdersRead)),
+		scoped.Append(middleware.RequirePermission(organizations.PermOrganizationManage)))
+}
+
+// scope is the organizations.Scope of a request behind middleware.Tenancy.
+func (r Routes) scope(ctx context.Context) (bun.IDB, uuid.UUID) {
+	return tenant.DB(ctx, r.db), tenant.MustFromContext(ctx).OrganizationID
+}
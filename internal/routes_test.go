@@ -0,0 +1,340 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/config"
+	"github.com/brxyxn/engine-care-api/internal/auth"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+	"github.com/brxyxn/engine-care-api/internal/users"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// endpoint is an organization scoped route and the permission it must be registered
+// with; public endpoints have none.
+type endpoint struct {
+	method, path string
+	perm         organizations.Permission
+}
+
+// endpoints lists every route organizationRoutes registers, written out independently
+// of the routes.go files so wiring a route to the wrong chain fails here.
+var endpoints = []endpoint{
+	{api.POST, "/v1/organization/members/{id}/activate", organizations.PermMembersManage},
+	{api.POST, "/v1/organization/members/{id}/deactivate", organizations.PermMembersManage},
+
+	{api.GET, "/v1/customers", organizations.PermCustomersRead},
+	{api.POST, "/v1/customers", organizations.PermCustomersWrite},
+	{api.GET, "/v1/customers/duplicates", organizations.PermCustomersRead},
+	{api.GET, "/v1/customers/{id}", organizations.PermCustomersRead},
+	{api.PATCH, "/v1/customers/{id}", organizations.PermCustomersWrite},
+	{api.DEL, "/v1/customers/{id}", organizations.PermCustomersDelete},
+	{api.POST, "/v1/customers/{id}/merge", organizations.PermCustomersDelete},
+	{api.GET, "/v1/customers/{id}/phone-numbers", organizations.PermCustomersRead},
+	{api.POST, "/v1/customers/{id}/phone-numbers", organizations.PermCustomersWrite},
+	{api.GET, "/v1/customers/{id}/phone-numbers/{pnID}", organizations.PermCustomersRead},
+	{api.PATCH, "/v1/customers/{id}/phone-numbers/{pnID}", organizations.PermCustomersWrite},
+	{api.DEL, "/v1/customers/{id}/phone-numbers/{pnID}", organizations.PermCustomersWrite},
+	{api.POST, "/v1/customers/{id}/phone-numbers/{pnID}/set-primary", organizations.PermCustomersWrite},
+
+	{api.GET, "/v1/maintenance-plans", organizations.PermVehiclesRead},
+	{api.POST, "/v1/maintenance-plans", organizations.PermMaintenanceManage},
+	{api.GET, "/v1/maintenance-plans/{id}", organizations.PermVehiclesRead},
+	{api.PATCH, "/v1/maintenance-plans/{id}", organizations.PermMaintenanceManage},
+	{api.DEL, "/v1/maintenance-plans/{id}", organizations.PermMaintenanceManage},
+	{api.GET, "/v1/vehicles/due", organizations.PermVehiclesRead},
+	{api.GET, "/v1/vehicles/{id}/maintenance", organizations.PermVehiclesRead},
+	{api.POST, "/v1/vehicles/{id}/maintenance", organizations.PermVehiclesWrite},
+	{api.DEL, "/v1/vehicles/{id}/maintenance/{planID}", organizations.PermVehiclesWrite},
+
+	{api.POST, "/v1/customers/{id}/vehicles", organizations.PermVehiclesWrite},
+	{api.GET, "/v1/vehicles", organizations.PermVehiclesRead},
+	{api.GET, "/v1/vehicles/lookup", organizations.PermVehiclesRead},
+	{api.GET, "/v1/vehicles/vin/{vin}", organizations.PermVehiclesRead},
+	{api.GET, "/v1/vehicles/{id}", organizations.PermVehiclesRead},
+	{api.PATCH, "/v1/vehicles/{id}", organizations.PermVehiclesWrite},
+	{api.DEL, "/v1/vehicles/{id}", organizations.PermVehiclesDelete},
+	{api.GET, "/v1/vehicles/{id}/history", organizations.PermVehiclesRead},
+	{api.GET, "/v1/vehicles/{id}/mileage", organizations.PermVehiclesRead},
+	{api.POST, "/v1/vehicles/{id}/mileage", organizations.PermVehiclesWrite},
+	{api.POST, "/v1/vehicles/{id}/mileage/{readingID}/void", organizations.PermVehiclesCorrect},
+	{api.GET, "/v1/vehicles/{id}/owners", organizations.PermVehiclesRead},
+	{api.POST, "/v1/vehicles/{id}/transfer", organizations.PermVehiclesWrite},
+
+	{api.GET, "/v1/work-orders", organizations.PermWorkOrdersRead},
+	{api.POST, "/v1/work-orders", organizations.PermWorkOrdersWrite},
+	{api.GET, "/v1/work-orders/{id}", organizations.PermWorkOrdersRead},
+	{api.PATCH, "/v1/work-orders/{id}", organizations.PermWorkOrdersWrite},
+	{api.DEL, "/v1/work-orders/{id}", organizations.PermWorkOrdersDelete},
+	{api.PATCH, "/v1/work-orders/{id}/status", organizations.PermWorkOrdersStatus},
+	{api.GET, "/v1/work-orders/{id}/transitions", organizations.PermWorkOrdersRead},
+	{api.GET, "/v1/work-orders/{id}/invoice", organizations.PermWorkOrdersRead},
+	{api.GET, "/v1/work-orders/{id}/estimates", organizations.PermWorkOrdersRead},
+	{api.POST, "/v1/work-orders/{id}/estimates", organizations.PermWorkOrdersWrite},
+	{api.POST, "/v1/work-orders/{id}/items", organizations.PermWorkOrdersWrite},
+	{api.PATCH, "/v1/work-orders/{id}/items/{itemID}", organizations.PermWorkOrdersWrite},
+	{api.DEL, "/v1/work-orders/{id}/items/{itemID}", organizations.PermWorkOrdersWrite},
+	{api.GET, "/v1/organization/branding", organizations.PermWorkOrdersRead},
+	{api.PATCH, "/v1/organization/branding", organizations.PermOrganizationManage},
+	{api.GET, "/v1/public/estimates/{token}", ""},
+	{api.POST, "/v1/public/estimates/{token}/decision", ""},
+
+	{api.GET, "/v1/appointments", organizations.PermAppointmentsRead},
+	{api.POST, "/v1/appointments", organizations.PermAppointmentsWrite},
+	{api.GET, "/v1/appointments/availability", organizations.PermAppointmentsRead},
+	{api.GET, "/v1/appointments/{id}", organizations.PermAppointmentsRead},
+	{api.PATCH, "/v1/appointments/{id}", organizations.PermAppointmentsWrite},
+	{api.DEL, "/v1/appointments/{id}", organizations.PermAppointmentsDelete},
+	{api.PATCH, "/v1/appointments/{id}/status", organizations.PermAppointmentsWrite},
+	{api.GET, "/v1/bays", organizations.PermAppointmentsRead},
+	{api.POST, "/v1/bays", organizations.PermOrganizationManage},
+	{api.PATCH, "/v1/bays/{id}", organizations.PermOrganizationManage},
+	{api.DEL, "/v1/bays/{id}", organizations.PermOrganizationManage},
+	{api.GET, "/v1/business-hours", organizations.PermAppointmentsRead},
+	{api.PUT, "/v1/business-hours", organizations.PermOrganizationManage},
+	{api.GET, "/v1/closures", organizations.PermAppointmentsRead},
+	{api.POST, "/v1/closures", organizations.PermOrganizationManage},
+	{api.DEL, "/v1/closures/{id}", organizations.PermOrganizationManage},
+}
+
+var roles = []organizations.OrgRole{
+	organizations.OrgRoleOwner,
+	organizations.OrgRoleAdmin,
+	organizations.OrgRoleManager,
+	organizations.OrgRoleMechanic,
+	organizations.OrgRoleViewer,
+}
+
+// roleHeader carries the stub tenant's role in the tests.
+const roleHeader = "X-Test-Role"
+
+// stubTenancy stands in for authentication and middleware.Tenancy: the caller is a
+// member with the role in roleHeader, or unauthenticated without one.
+func stubTenancy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := organizations.OrgRole(r.Header.Get(roleHeader))
+		if role == "" {
+			api.WriteError(w, api.Unauthorized("authentication required"))
+			return
+		}
+
+		userID := uuid.New()
+		ctx := auth.WithPrincipal(r.Context(), &auth.Principal{Subject: "test", StackUserID: "test", UserID: userID})
+		ctx = tenant.WithTenant(ctx, tenant.Tenant{OrganizationID: uuid.New(), UserID: userID, Role: role})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// unreachable is a database connector that always fails, so handlers past the
+// permission check answer with an error instead of reaching a server.
+type unreachable struct{}
+
+func (unreachable) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("no database in tests")
+}
+
+func (unreachable) Driver() driver.Driver { return nil }
+
+// testRouter builds the organization scoped routes behind stubTenancy.
+func testRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	db := bun.NewDB(sql.OpenDB(unreachable{}), pgdialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+
+	r := Routes{
+		rtr: mux.NewRouter(),
+		ctx: context.Background(),
+		log: logger.NewLogger(func(o *logger.Opts) { o.Level = "disabled" }),
+		cfg: config.Config{
+			EstimateLinkSecret: strings.Repeat("s", 32),
+			EstimateLinkTTL:    time.Hour,
+			PublicBaseURL:      "http://localhost",
+		},
+		db: db,
+	}
+	prov := users.NewProvisioner(zerolog.Nop(), db, time.Minute)
+	r.organizationRoutes(r.rtr.PathPrefix("/v1").Subrouter(), prov, mwchain.NewChain(stubTenancy))
+	return r.rtr
+}
+
+// concrete fills in the variables of a route template.
+func concrete(path string) string {
+	return strings.NewReplacer(
+		"{id}", uuid.NewString(),
+		"{pnID}", uuid.NewString(),
+		"{planID}", uuid.NewString(),
+		"{itemID}", uuid.NewString(),
+		"{vin}", "1HGCM82633A004352",
+		"{token}", "token",
+	).Replace(path)
+}
+
+func serve(rtr *mux.Router, role organizations.OrgRole, method, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, concrete(path), strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	if role != "" {
+		r.Header.Set(roleHeader, string(role))
+	}
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, r)
+	return w
+}
+
+// reachedHandler reports whether a request got past routing and the permission check.
+func reachedHandler(code int) bool {
+	return code != http.StatusForbidden && code != http.StatusNotFound && code != http.StatusMethodNotAllowed
+}
+
+func TestOrganizationRoutesAreListed(t *testing.T) {
+	registered := map[string]bool{}
+	err := testRouter(t).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefix
+		}
+		for _, m := range methods {
+			registered[m+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := map[string]bool{}
+	for _, e := range endpoints {
+		key := e.method + " " + e.path
+		listed[key] = true
+		if !registered[key] {
+			t.Errorf("%s is not registered", key)
+		}
+	}
+	for key := range registered {
+		if !listed[key] {
+			t.Errorf("%s is registered but missing from endpoints", key)
+		}
+	}
+}
+
+func TestOrganizationRoutesPermissions(t *testing.T) {
+	rtr := testRouter(t)
+
+	for _, role := range roles {
+		for _, e := range endpoints {
+			if e.perm == "" {
+				continue
+			}
+
+			t.Run(string(role)+" "+e.method+" "+e.path, func(t *testing.T) {
+				w := serve(rtr, role, e.method, e.path)
+
+				if role.Can(e.perm) {
+					if !reachedHandler(w.Code) {
+						t.Fatalf("status = %d, want the handler to run: %s", w.Code, w.Body.String())
+					}
+					return
+				}
+
+				if w.Code != http.StatusForbidden {
+					t.Fatalf("status = %d, want 403: %s", w.Code, w.Body.String())
+				}
+				var body struct {
+					Error struct {
+						Code    api.ErrorCode `json:"code"`
+						Details struct {
+							Required []organizations.Permission `json:"required_permissions"`
+						} `json:"details"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != api.CodeForbidden || !slices.Equal(body.Error.Details.Required, []organizations.Permission{e.perm}) {
+					t.Fatalf("403 body = %s, want %s required", w.Body.String(), e.perm)
+				}
+			})
+		}
+	}
+}
+
+func TestOrganizationRoutesSpotChecks(t *testing.T) {
+	rtr := testRouter(t)
+
+	tests := []struct {
+		name         string
+		role         organizations.OrgRole
+		method, path string
+		allowed      bool
+	}{
+		{"mechanic moves a work order", organizations.OrgRoleMechanic, api.PATCH, "/v1/work-orders/{id}/status", true},
+		{"mechanic cannot delete a customer", organizations.OrgRoleMechanic, api.DEL, "/v1/customers/{id}", false},
+		{"mechanic cannot merge customers", organizations.OrgRoleMechanic, api.POST, "/v1/customers/{id}/merge", false},
+		{"mechanic cannot cancel through delete", organizations.OrgRoleMechanic, api.DEL, "/v1/work-orders/{id}", false},
+		{"manager merges customers", organizations.OrgRoleManager, api.POST, "/v1/customers/{id}/merge", true},
+		{"manager cannot edit branding", organizations.OrgRoleManager, api.PATCH, "/v1/organization/branding", false},
+		{"manager cannot suspend members", organizations.OrgRoleManager, api.POST, "/v1/organization/members/{id}/deactivate", false},
+		{"admin suspends members", organizations.OrgRoleAdmin, api.POST, "/v1/organization/members/{id}/deactivate", true},
+		{"admin edits branding", organizations.OrgRoleAdmin, api.PATCH, "/v1/organization/branding", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(rtr, tt.role, tt.method, tt.path)
+			if reachedHandler(w.Code) != tt.allowed {
+				t.Fatalf("status = %d, want allowed = %t: %s", w.Code, tt.allowed, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestViewerIsReadOnly(t *testing.T) {
+	rtr := testRouter(t)
+
+	for _, e := range endpoints {
+		if e.perm == "" {
+			continue
+		}
+		w := serve(rtr, organizations.OrgRoleViewer, e.method, e.path)
+		if reachedHandler(w.Code) != (e.method == api.GET) {
+			t.Errorf("viewer %s %s: status = %d", e.method, e.path, w.Code)
+		}
+	}
+}
+
+func TestPublicEstimateRoutesNeedNoLogin(t *testing.T) {
+	rtr := testRouter(t)
+
+	for _, e := range endpoints {
+		if e.perm != "" {
+			continue
+		}
+		// An unknown token is a 404 from the handler itself.
+		w := serve(rtr, "", e.method, e.path)
+		if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden || w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s without login: status = %d", e.method, e.path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+)
+
+// HeaderOrgID is the request header selecting the organization a request acts on.
+const HeaderOrgID = "X-Org-Id"
+
+var ErrMissingTenant = errors.New("no tenant in context")
+
+// Tenant is the organization a request is scoped to and the caller's membership in it.
+type Tenant struct {
+	OrganizationID uuid.UUID             `json:"organization_id"`
+	UserID         uuid.UUID             `json:"user_id"`
+	Role           organizations.OrgRole `json:"role"`
+}
+
+type (
+	tenantKey struct{}
+	txKey     struct{}
+)
+
+// WithTenant returns a copy of ctx carrying t.
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// FromContext returns the tenant stored by middleware.Tenancy, if any.
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(Tenant)
+	return t, ok
+}
+
+// MustFromContext returns the tenant or panics; use it only behind middleware.Tenancy.
+func MustFromContext(ctx context.Context) Tenant {
+	t, ok := FromContext(ctx)
+	if !ok {
+		panic(ErrMissingTenant)
+	}
+	return t
+}
+
+// WithTx returns a copy of ctx carrying the request transaction.
+func WithTx(ctx context.Context, tx bun.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// DB returns the request transaction opened by middleware.Tenancy, which has the
+// app.user_id/app.organization_id settings row-level security relies on, or db
+// when the request is not tenant scoped.
+func DB(ctx context.Context, db bun.IDB) bun.IDB {
+	if tx, ok := ctx.Value(txKey{}).(bun.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// SystemUserID is the identity server jobs act as (app.system_user_id() in the
+// database). Configured with an organization, the policies treat it as a member of that
+// organization with every role; with ConfigureUser alone it sees every organization.
+var SystemUserID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Configure sets the app.user_id/app.organization_id settings row-level security
+// relies on for the rest of tx.
+func Configure(ctx context.Context, tx bun.Tx, userID, orgID uuid.UUID) error {
+	// SET LOCAL does not accept bind parameters; set_config(..., true) is equivalent.
+	_, err := tx.ExecContext(ctx,
+		"SELECT set_config('app.user_id', ?, true), set_config('app.organization_id', ?, true)",
+		userID.String(), orgID.String(),
+	)
+	return err
+}
+
+// ConfigureUser sets only app.user_id for the rest of tx, for queries about the user
+// outside any organization: app.current_org_id() stays NULL, so the policies let them
+// see their own memberships and organizations.
+func ConfigureUser(ctx context.Context, tx bun.Tx, userID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, "SELECT set_config('app.user_id', ?, true)", userID.String())
+	return err
+}
@@ -2,23 +2,33 @@ package users
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/brxyxn/go-logger"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 	"github.com/uptrace/bun"
 
 	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/auth"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
 )
 
 type h interface {
-	Create() http.HandlerFunc
 	List() http.HandlerFunc
 	ByEmail() http.HandlerFunc
 	ByID() http.HandlerFunc
+	Update() http.HandlerFunc
+	Deactivate() http.HandlerFunc
+	ActivateMember() http.HandlerFunc
+	DeactivateMember() http.HandlerFunc
+	Me() http.HandlerFunc
 }
 
 type pnh interface {
@@ -26,13 +36,17 @@ type pnh interface {
 	List() http.HandlerFunc
 	ByNumber() http.HandlerFunc
 	ByID() http.HandlerFunc
+	Update() http.HandlerFunc
+	Remove() http.HandlerFunc
+	SetPrimary() http.HandlerFunc
 }
 
 type Hdlr struct {
-	ctx context.Context
-	db  *bun.DB
-	log zerolog.Logger
-	svc Svc
+	ctx  context.Context
+	db   *bun.DB
+	log  zerolog.Logger
+	svc  Svc
+	prov *Provisioner
 }
 
 type PhoneNumberHdlr struct {
@@ -45,79 +59,464 @@ type PhoneNumberHdlr struct {
 var _ h = (*Hdlr)(nil)
 var _ pnh = (*PhoneNumberHdlr)(nil)
 
-func Handler(ctx context.Context, log zerolog.Logger, db *bun.DB) Hdlr {
+func Handler(ctx context.Context, log zerolog.Logger, db *bun.DB, prov *Provisioner) Hdlr {
 	svc := Service(ctx, log, db)
-	return Hdlr{ctx, db, log, svc}
+	return Hdlr{ctx, db, log, svc, prov}
 }
 
-type CreateUser struct {
-	StackUserID string  `json:"stack_user_id"`
-	Email       string  `json:"email"`
-	FirstName   string  `json:"first_name"`
-	LastName    *string `json:"last_name,omitempty"`
-	AvatarURL   *string `json:"avatar_url,omitempty"`
+// UpdateUser holds the profile fields a user may change; nil fields are left untouched
+// and an empty avatar_url clears it.
+type UpdateUser struct {
+	DisplayName *string `json:"display_name,omitempty" validate:"min=1,max=200"`
+	AvatarURL   *string `json:"avatar_url,omitempty" validate:"url"`
 }
 
-func (h *Hdlr) Create() http.HandlerFunc {
+// List lists the users that share an organization with the caller, see ListSpec.
+func (h *Hdlr) List() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := CreateUser{}
-		err := json.NewDecoder(r.Body).Decode(&data)
+		principal := auth.MustFromContext(r.Context())
+
+		params, err := api.ParseList(r, ListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		users, page, err := h.svc.List(principal.UserID, params)
 		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing users")
+			api.WriteError(w, err)
 			return
 		}
 
-		displayName := fmt.Sprintf("%s %s", data.FirstName, *data.LastName)
-		user := User{
-			ID:          uuid.New(), // todo: validate if StackUserID is defined and unique otherwise create a new one
-			StackUserID: data.StackUserID,
-			Email:       data.Email,
-			DisplayName: displayName,
-			AvatarURL:   data.AvatarURL,
+		api.SuccessPage[*User](w, http.StatusOK, users, page)
+	}
+}
+
+// ByEmail gets a user by the email query parameter.
+func (h *Hdlr) ByEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+
+		email := r.URL.Query().Get("email")
+		if email == "" {
+			api.WriteError(w, api.BadRequest("email query parameter is required"))
+			return
 		}
 
-		err = h.svc.Create(user)
+		user, err := h.svc.ByEmail(principal.UserID, email)
 		if err != nil {
-			// todo: validate error type for conflict vs internal server error
-			h.log.Debug().Err(err).Msg("error creating user")
-			api.Error(w, http.StatusInternalServerError, api.ErrorResponse{Stack: err.Error()})
+			h.userError(w, err, "error getting user by email")
 			return
 		}
 
-		api.Success[User](w, http.StatusCreated, user)
+		api.Success[*User](w, http.StatusOK, user)
 	}
 }
 
-func (h *Hdlr) List() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+// ByID gets a user by the {id} path variable or, on /by-id, the id query parameter.
+func (h *Hdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+
+		id, ok := userID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := h.svc.ByID(principal.UserID, id)
+		if err != nil {
+			h.userError(w, err, "error getting user by id")
+			return
+		}
+
+		api.Success[*User](w, http.StatusOK, user)
+	}
 }
 
-func (h *Hdlr) ByEmail() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+// Update changes the caller's own profile.
+func (h *Hdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+
+		id, ok := userID(w, r)
+		if !ok {
+			return
+		}
+
+		if id != principal.UserID {
+			api.WriteError(w, api.Forbidden("users can only update their own profile"))
+			return
+		}
+
+		data, err := api.Decode[UpdateUser](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		user, err := h.svc.Update(id, data)
+		if err != nil {
+			h.userError(w, err, "error updating user")
+			return
+		}
+
+		api.Success[*User](w, http.StatusOK, user)
+	}
 }
 
-func (h *Hdlr) ByID() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+// Deactivate closes the caller's own account: further requests of the user are rejected
+// in every organization. Reopening it is left to an operator. Owners and admins suspend
+// a member of their organization with DeactivateMember instead.
+func (h *Hdlr) Deactivate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+
+		id, ok := userID(w, r)
+		if !ok {
+			return
+		}
+		if id != principal.UserID {
+			api.WriteError(w, api.Forbidden("users can only deactivate their own account"))
+			return
+		}
+
+		user, err := h.svc.SetActive(id, false)
+		if err != nil {
+			h.userError(w, err, "error deactivating user")
+			return
+		}
+
+		// Drop the cached sync so the change applies on the user's next request.
+		h.prov.Forget(user.StackUserID)
+
+		api.Success[*User](w, http.StatusOK, user)
+	}
+}
+
+// ActivateMember reactivates a member of the request's organization.
+func (h *Hdlr) ActivateMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.setMemberActive(w, r, true)
+	}
+}
+
+// DeactivateMember suspends a member of the request's organization: their requests to
+// it are rejected, their account and other organizations are unaffected.
+func (h *Hdlr) DeactivateMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.setMemberActive(w, r, false)
+	}
+}
+
+func (h *Hdlr) setMemberActive(w http.ResponseWriter, r *http.Request, active bool) {
+	t := tenant.MustFromContext(r.Context())
+
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	if id == t.UserID {
+		api.WriteError(w, api.Forbidden("members cannot change their own membership"))
+		return
+	}
+
+	member, err := h.svc.SetMemberActive(r.Context(), id, active)
+	if err != nil {
+		h.log.Debug().Err(err).Msg("error changing membership activity")
+		api.WriteError(w, err)
+		return
+	}
+
+	api.Success[*organizations.OrganizationMember](w, http.StatusOK, member)
+}
+
+// userError maps service errors to a response: 404 for missing rows, 500 otherwise.
+func (h *Hdlr) userError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = api.NotFound("user not found").Wrap(err)
+	}
+
+	h.log.Debug().Err(err).Msg(msg)
+	api.WriteError(w, err)
+}
+
+// userID reads the user id from the {id} path variable or the id query parameter.
+func userID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	raw, ok := mux.Vars(r)["id"]
+	if !ok {
+		raw = r.URL.Query().Get("id")
+	}
+
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid user id"))
+		return uuid.Nil, false
+	}
+
+	return id, true
 }
 
+// Me returns the authenticated user and their organization memberships.
+func (h *Hdlr) Me() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.MustFromContext(r.Context())
+
+		user, err := h.svc.ByID(principal.UserID, principal.UserID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting current user")
+			api.WriteError(w, err)
+			return
+		}
+
+		memberships, err := h.svc.Memberships(user.ID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing memberships")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[Me](w, http.StatusOK, Me{User: user, Memberships: memberships})
+	}
+}
+
+// AddPhoneNumber is the body of POST /users/{id}/phone-numbers and PATCH /users/{id}/phone-numbers/{pnID}.
+// Number is free-form; CountryCode is only needed when Number has no international prefix.
+type AddPhoneNumber struct {
+	CountryCode string `json:"country_code" validate:"max=5"`
+	Number      string `json:"number" validate:"required,max=32"`
+	IsPrimary   bool   `json:"is_primary"`
+}
+
+func PhoneNumberHandler(ctx context.Context, log *logger.Logger, db *bun.DB) PhoneNumberHdlr {
+	svc := PhoneNumberService(ctx, log, db)
+	return PhoneNumberHdlr{ctx, db, log, svc}
+}
+
+// Add links a phone number to the caller.
 func (p PhoneNumberHdlr) Add() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		data, ok := decodePhoneNumber(w, r)
+		if !ok {
+			return
+		}
+
+		upn, err := p.svc.Add(userID, data.CountryCode, data.Number, data.IsPrimary)
+		if err != nil {
+			p.phoneNumberError(w, err, "error adding phone number")
+			return
+		}
+
+		api.Success[*UserPhoneNumber](w, http.StatusCreated, upn)
+	}
 }
 
+// List lists the caller's phone numbers, primary first.
 func (p PhoneNumberHdlr) List() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		upn, err := p.svc.List(userID)
+		if err != nil {
+			p.phoneNumberError(w, err, "error listing phone numbers")
+			return
+		}
+
+		api.Success[[]*UserPhoneNumber](w, http.StatusOK, upn)
+	}
 }
 
+// ByNumber finds one of the caller's phone numbers by the number query parameter,
+// national to the optional country_code parameter.
 func (p PhoneNumberHdlr) ByNumber() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		number, countryCode := strings.TrimSpace(q.Get("number")), q.Get("country_code")
+		if number == "" {
+			api.WriteError(w, api.BadRequest("number query parameter is required"))
+			return
+		}
+
+		// An unescaped "+" in a query string decodes to a space; without a country
+		// code the number can only be international, so put it back.
+		if countryCode == "" && !strings.HasPrefix(number, "+") && !strings.HasPrefix(number, "00") {
+			number = "+" + number
+		}
+
+		pn, err := phonenumbers.Parse(number, countryCode)
+		if err != nil {
+			p.phoneNumberError(w, err, "invalid phone number")
+			return
+		}
+
+		upn, err := p.svc.ByNumber(userID, pn.E164)
+		if err != nil {
+			p.phoneNumberError(w, err, "error getting phone number by number")
+			return
+		}
+
+		api.Success[*UserPhoneNumber](w, http.StatusOK, upn)
+	}
 }
 
+// ByID gets one of the caller's phone numbers.
 func (p PhoneNumberHdlr) ByID() http.HandlerFunc {
-	//TODO implement me
-	panic("implement me")
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := phoneNumberID(w, r)
+		if !ok {
+			return
+		}
+
+		upn, err := p.svc.ByID(userID, id)
+		if err != nil {
+			p.phoneNumberError(w, err, "error getting phone number")
+			return
+		}
+
+		api.Success[*UserPhoneNumber](w, http.StatusOK, upn)
+	}
+}
+
+// Update changes the number behind one of the caller's phone numbers.
+func (p PhoneNumberHdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := phoneNumberID(w, r)
+		if !ok {
+			return
+		}
+
+		data, ok := decodePhoneNumber(w, r)
+		if !ok {
+			return
+		}
+
+		upn, err := p.svc.Update(userID, id, data.CountryCode, data.Number)
+		if err != nil {
+			p.phoneNumberError(w, err, "error updating phone number")
+			return
+		}
+
+		api.Success[*UserPhoneNumber](w, http.StatusOK, upn)
+	}
+}
+
+// Remove unlinks one of the caller's phone numbers.
+func (p PhoneNumberHdlr) Remove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := phoneNumberID(w, r)
+		if !ok {
+			return
+		}
+
+		err := p.svc.Remove(userID, id)
+		if err != nil {
+			p.phoneNumberError(w, err, "error removing phone number")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetPrimary makes one of the caller's phone numbers the primary one.
+func (p PhoneNumberHdlr) SetPrimary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := ownUserID(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := phoneNumberID(w, r)
+		if !ok {
+			return
+		}
+
+		upn, err := p.svc.SetPrimary(userID, id)
+		if err != nil {
+			p.phoneNumberError(w, err, "error setting primary phone number")
+			return
+		}
+
+		api.Success[*UserPhoneNumber](w, http.StatusOK, upn)
+	}
+}
+
+func (p PhoneNumberHdlr) phoneNumberError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = api.NotFound("phone number not found").Wrap(err)
+	}
+
+	var parseErr *phonenumbers.ParseError
+	if errors.As(err, &parseErr) {
+		err = api.Validation("invalid phone number", api.FieldError{
+			Field:   parseErr.Field,
+			Message: parseErr.Err.Error(),
+		}).Wrap(err)
+	}
+
+	p.log.Debug().Err(err).Msg(msg)
+	api.WriteError(w, err)
+}
+
+// ownUserID reads the {id} path variable and makes sure it is the caller;
+// users only manage their own phone numbers.
+func ownUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, ok := userID(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if id != auth.MustFromContext(r.Context()).UserID {
+		api.WriteError(w, api.Forbidden("users can only manage their own phone numbers"))
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+func phoneNumberID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["pnID"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid phone number id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func decodePhoneNumber(w http.ResponseWriter, r *http.Request) (AddPhoneNumber, bool) {
+	data, err := api.Decode[AddPhoneNumber](w, r)
+	if err != nil {
+		api.WriteError(w, err)
+		return data, false
+	}
+
+	return data, true
 }
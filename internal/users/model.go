@@ -6,6 +6,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 
+	"github.com/brxyxn/engine-care-api/internal/organizations"
 	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
 )
 
@@ -36,3 +37,18 @@ type UserPhoneNumber struct {
 	User        *User                     `bun:"rel:belongs-to,join:user_id=id" json:"user,omitempty"`
 	PhoneNumber *phonenumbers.PhoneNumber `bun:"rel:belongs-to,join:phone_number_id=id" json:"phone_number,omitempty"`
 }
+
+// Membership is a user's role in one organization.
+type Membership struct {
+	OrganizationID   uuid.UUID             `bun:"organization_id" json:"organization_id"`
+	OrganizationName string                `bun:"organization_name" json:"organization_name"`
+	Role             organizations.OrgRole `bun:"role" json:"role"`
+	IsActive         bool                  `bun:"is_active" json:"is_active"`
+	JoinedAt         time.Time             `bun:"joined_at" json:"joined_at"`
+}
+
+// Me is the authenticated user along with the organizations they belong to.
+type Me struct {
+	User        *User        `json:"user"`
+	Memberships []Membership `json:"memberships"`
+}
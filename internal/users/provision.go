@@ -0,0 +1,172 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/internal/auth"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+)
+
+// maxProvisionCache bounds the in-memory sync cache before expired entries are purged.
+const maxProvisionCache = 10_000
+
+// Provisioner creates users on their first authenticated request and keeps
+// their profile (email, display name, avatar) in sync with the token claims.
+// A user is synced at most once per interval per process; whether they are still
+// active is checked on every request.
+type Provisioner struct {
+	db       *bun.DB
+	log      zerolog.Logger
+	interval time.Duration
+
+	mu     sync.Mutex
+	synced map[string]syncedUser
+}
+
+type syncedUser struct {
+	id       uuid.UUID
+	syncedAt time.Time
+}
+
+var _ middleware.Provisioner = (*Provisioner)(nil)
+
+func NewProvisioner(log zerolog.Logger, db *bun.DB, interval time.Duration) *Provisioner {
+	return &Provisioner{
+		db:       db,
+		log:      log,
+		interval: interval,
+		synced:   map[string]syncedUser{},
+	}
+}
+
+// Provision upserts the user keyed on the principal's Stack user id and returns its id.
+func (p *Provisioner) Provision(ctx context.Context, principal *auth.Principal) (uuid.UUID, error) {
+	if id, ok := p.recent(principal.StackUserID); ok {
+		active, err := p.isActive(ctx, id)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if active {
+			return id, nil
+		}
+		// Deactivated since it was cached, here or by another process: the sync below
+		// reports it.
+		p.Forget(principal.StackUserID)
+	}
+
+	user := profileFromPrincipal(principal)
+
+	// Only touch the row when the profile actually changed.
+	err := p.db.NewInsert().
+		Model(&user).
+		Column("stack_user_id", "email", "display_name", "avatar_url").
+		On("CONFLICT (stack_user_id) DO UPDATE").
+		Set("email = EXCLUDED.email").
+		Set("display_name = EXCLUDED.display_name").
+		Set("avatar_url = EXCLUDED.avatar_url").
+		Set("updated_at = now()").
+		Where("(u.email, u.display_name, u.avatar_url) IS DISTINCT FROM (EXCLUDED.email, EXCLUDED.display_name, EXCLUDED.avatar_url)").
+		Returning("id, is_active").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already up to date, nothing was returned by the upsert.
+		err = p.db.NewSelect().
+			Model(&user).
+			Column("id", "is_active").
+			Where("stack_user_id = ?", user.StackUserID).
+			Scan(ctx)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !user.IsActive {
+		return uuid.Nil, middleware.ErrInactiveUser
+	}
+
+	p.remember(principal.StackUserID, user.ID)
+	p.log.Debug().Str("user_id", user.ID.String()).Msg("user provisioned")
+
+	return user.ID, nil
+}
+
+// isActive reports whether the user with id still exists and is active.
+func (p *Provisioner) isActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	return p.db.NewSelect().
+		Model((*User)(nil)).
+		Where("id = ?", id).
+		Where("is_active").
+		Exists(ctx)
+}
+
+// Forget drops the user from the sync cache, so their next request is checked and
+// synced against the database again.
+func (p *Provisioner) Forget(stackUserID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.synced, stackUserID)
+}
+
+func (p *Provisioner) recent(stackUserID string) (uuid.UUID, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.synced[stackUserID]
+	if !ok || time.Since(s.syncedAt) >= p.interval {
+		return uuid.Nil, false
+	}
+	return s.id, true
+}
+
+func (p *Provisioner) remember(stackUserID string, id uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.synced) >= maxProvisionCache {
+		for k, s := range p.synced {
+			if time.Since(s.syncedAt) >= p.interval {
+				delete(p.synced, k)
+			}
+		}
+	}
+
+	p.synced[stackUserID] = syncedUser{id: id, syncedAt: time.Now()}
+}
+
+// profileFromPrincipal maps Stack Auth claims onto a User. Stack Auth issues
+// "name" and "profile_image_url"; "picture" is the OIDC equivalent.
+func profileFromPrincipal(principal *auth.Principal) User {
+	user := User{
+		StackUserID: principal.StackUserID,
+		Email:       principal.Email,
+		DisplayName: principal.Claim("name"),
+		IsActive:    true,
+	}
+
+	if user.DisplayName == "" {
+		user.DisplayName, _, _ = strings.Cut(user.Email, "@")
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = principal.Subject
+	}
+
+	avatar := principal.Claim("profile_image_url")
+	if avatar == "" {
+		avatar = principal.Claim("picture")
+	}
+	if avatar != "" {
+		user.AvatarURL = &avatar
+	}
+
+	return user
+}
@@ -9,15 +9,51 @@ import (
 
 	"github.com/brxyxn/engine-care-api/api"
 	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
 	"github.com/brxyxn/engine-care-api/pkg/mwchain"
 )
 
-func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB) {
+// Routes registers the user endpoints. authn is the shared authentication chain
+// (Auth + Provision) built in internal.Routes with prov; Provision creates the users
+// from their tokens, so there is no endpoint to create one.
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, prov *Provisioner, authn mwchain.Chain) {
 	u := v1.PathPrefix("/users").Subrouter()
 	usrLog := log.With().Str("route", "users").Logger()
-	usrHandler := Handler(ctx, usrLog, db)
-	u.Handle("", mwchain.NewChain(middleware.Logger(usrLog)).Then(api.Placeholder())).Methods(api.GET)
-	u.Handle("/by-id", mwchain.NewChain(middleware.Logger(usrLog)).Then(api.Placeholder())).Methods(api.GET)
-	u.Handle("/by-email", mwchain.NewChain(middleware.Logger(usrLog)).Then(api.Placeholder())).Methods(api.GET)
-	u.Handle("/create", mwchain.NewChain(middleware.Logger(usrLog)).Then(usrHandler.Create())).Methods(api.POST)
+	usrHandler := Handler(ctx, usrLog, db, prov)
+	pnHandler := PhoneNumberHandler(ctx, log, db)
+
+	private := mwchain.NewChain(middleware.Logger(usrLog)).Extend(authn)
+
+	v1.Handle("/me", private.Then(usrHandler.Me())).Methods(api.GET)
+
+	u.Handle("", private.Then(usrHandler.List())).Methods(api.GET)
+	u.Handle("/by-id", private.Then(usrHandler.ByID())).Methods(api.GET)
+	u.Handle("/by-email", private.Then(usrHandler.ByEmail())).Methods(api.GET)
+	u.Handle("/{id}", private.Then(usrHandler.ByID())).Methods(api.GET)
+	u.Handle("/{id}", private.Then(usrHandler.Update())).Methods(api.PATCH)
+	u.Handle("/{id}/deactivate", private.Then(usrHandler.Deactivate())).Methods(api.POST)
+
+	u.Handle("/{id}/phone-numbers", private.Then(pnHandler.List())).Methods(api.GET)
+	u.Handle("/{id}/phone-numbers", private.Then(pnHandler.Add())).Methods(api.POST)
+	u.Handle("/{id}/phone-numbers/by-number", private.Then(pnHandler.ByNumber())).Methods(api.GET)
+	u.Handle("/{id}/phone-numbers/{pnID}", private.Then(pnHandler.ByID())).Methods(api.GET)
+	u.Handle("/{id}/phone-numbers/{pnID}", private.Then(pnHandler.Update())).Methods(api.PATCH)
+	u.Handle("/{id}/phone-numbers/{pnID}", private.Then(pnHandler.Remove())).Methods(api.DEL)
+	u.Handle("/{id}/phone-numbers/{pnID}/set-primary", private.Then(pnHandler.SetPrimary())).Methods(api.POST)
+}
+
+// MemberRoutes registers the endpoints owners and admins manage the members of their
+// organization with. They are organization scoped: tenancy authenticates the caller and
+// scopes the request to the X-Org-Id organization (see middleware.Tenancy).
+func MemberRoutes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, prov *Provisioner, tenancy mwchain.Chain) {
+	m := v1.PathPrefix("/organization/members").Subrouter()
+	memLog := log.With().Str("route", "members").Logger()
+	memHandler := Handler(ctx, memLog, db, prov)
+
+	manage := mwchain.NewChain(middleware.Logger(memLog)).
+		Extend(tenancy).
+		Append(middleware.RequirePermission(organizations.PermMembersManage))
+
+	m.Handle("/{id}/activate", manage.Then(memHandler.ActivateMember())).Methods(api.POST)
+	m.Handle("/{id}/deactivate", manage.Then(memHandler.DeactivateMember())).Methods(api.POST)
 }
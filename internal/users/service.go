@@ -3,29 +3,37 @@ package users
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"time"
+	"errors"
 
 	"github.com/brxyxn/go-logger"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/uptrace/bun"
 
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
 	"github.com/brxyxn/engine-care-api/internal/phonenumbers"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
 )
 
 type s interface {
-	Create(user User) error
-	List() ([]*User, error)
-	ByEmail(email string) (*User, error)
-	ByID(id string) (*User, error)
-	// todo: Update, Delete
+	List(viewerID uuid.UUID, params api.ListParams) ([]*User, api.Page, error)
+	ByEmail(viewerID uuid.UUID, email string) (*User, error)
+	ByID(viewerID, id uuid.UUID) (*User, error)
+	Update(id uuid.UUID, data UpdateUser) (*User, error)
+	SetActive(id uuid.UUID, active bool) (*User, error)
+	SetMemberActive(ctx context.Context, userID uuid.UUID, active bool) (*organizations.OrganizationMember, error)
+	Memberships(userID uuid.UUID) ([]Membership, error)
 }
 
 type pn interface {
-	Add(userID uuid.UUID, countryCode, phoneNumber string, isPrimary bool) error
+	Add(userID uuid.UUID, countryCode, phoneNumber string, isPrimary bool) (*UserPhoneNumber, error)
 	List(userID uuid.UUID) ([]*UserPhoneNumber, error)
-	// todo: Remove, SetPrimary, Update
+	ByID(userID, id uuid.UUID) (*UserPhoneNumber, error)
+	ByNumber(userID uuid.UUID, e164 string) (*UserPhoneNumber, error)
+	Remove(userID, id uuid.UUID) error
+	SetPrimary(userID, id uuid.UUID) (*UserPhoneNumber, error)
+	Update(userID, id uuid.UUID, countryCode, phoneNumber string) (*UserPhoneNumber, error)
 }
 
 type Svc struct {
@@ -59,29 +67,62 @@ func PhoneNumberService(ctx context.Context, log *logger.Logger, db *bun.DB) Pho
 	}
 }
 
-// Create creates a new user.
-func (s *Svc) Create(user User) error {
-	_, err := s.db.NewInsert().Model(&user).Returning("id").Exec(s.ctx)
-	if err != nil {
-		return err
-	}
-	return nil
+// asViewer runs fn in a read-only transaction with app.user_id set to the viewer, so the
+// row-level security policies show the memberships of their organizations.
+func (s *Svc) asViewer(viewerID uuid.UUID, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return s.db.RunInTx(s.ctx, &sql.TxOptions{ReadOnly: true}, func(ctx context.Context, tx bun.Tx) error {
+		err := tenant.ConfigureUser(ctx, tx, viewerID)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, tx)
+	})
+}
+
+// visibleTo limits a users query to the viewer and the users sharing an organization with them.
+func visibleTo(q *bun.SelectQuery, viewerID uuid.UUID) *bun.SelectQuery {
+	return q.Where(`u.id = ? OR EXISTS (
+		SELECT 1 FROM organization_members AS mine
+		JOIN organization_members AS theirs ON theirs.organization_id = mine.organization_id
+		WHERE mine.user_id = ? AND theirs.user_id = u.id)`, viewerID, viewerID)
+}
+
+// ListSpec is the filters and sort orders accepted by GET /users.
+var ListSpec = api.ListSpec{
+	Alias: "u",
+	Filters: []api.Filter{
+		{Param: "is_active", Column: "is_active", Parse: api.ParseBool},
+		{Param: "created_after", Column: "created_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "created_before", Column: "created_at", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:   []string{"created_at", "display_name", "email"},
+	Default: "display_name",
+	Search:  []string{"display_name", "email"},
 }
 
-// List lists all users.
-func (s *Svc) List() ([]*User, error) {
-	var users []*User
-	err := s.db.NewSelect().Model(&users).Scan(s.ctx)
+// List lists one page of the users visible to the viewer.
+func (s *Svc) List(viewerID uuid.UUID, params api.ListParams) ([]*User, api.Page, error) {
+	users := []*User{}
+	err := s.asViewer(viewerID, func(ctx context.Context, tx bun.Tx) error {
+		return params.Apply(visibleTo(tx.NewSelect().Model(&users), viewerID)).
+			Scan(ctx)
+	})
 	if err != nil {
-		return nil, err
+		return nil, api.Page{}, err
 	}
-	return users, nil
+
+	users, page := api.PageOf(params, users)
+	return users, page, nil
 }
 
 // ByEmail gets a user by email.
-func (s *Svc) ByEmail(email string) (*User, error) {
+func (s *Svc) ByEmail(viewerID uuid.UUID, email string) (*User, error) {
 	var user User
-	err := s.db.NewSelect().Model(&user).Where("email = ?", email).Scan(s.ctx)
+	err := s.asViewer(viewerID, func(ctx context.Context, tx bun.Tx) error {
+		return visibleTo(tx.NewSelect().Model(&user), viewerID).
+			Where("lower(u.email) = lower(?)", email).
+			Scan(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -89,13 +130,53 @@ func (s *Svc) ByEmail(email string) (*User, error) {
 }
 
 // ByID gets a user by ID, with phone numbers preloaded.
-func (s *Svc) ByID(id string) (*User, error) {
+func (s *Svc) ByID(viewerID, id uuid.UUID) (*User, error) {
 	var user User
-	err := s.db.NewSelect().
+	err := s.asViewer(viewerID, func(ctx context.Context, tx bun.Tx) error {
+		return visibleTo(tx.NewSelect().Model(&user), viewerID).
+			Where("u.id = ?", id).
+			Relation("PhoneNumbers").
+			Relation("PhoneNumbers.PhoneNumber").
+			Scan(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Update applies the non-nil profile fields of data.
+func (s *Svc) Update(id uuid.UUID, data UpdateUser) (*User, error) {
+	user := User{ID: id}
+	q := s.db.NewUpdate().
 		Model(&user).
-		Where("u.id = ?", id).
-		Relation("PhoneNumbers").
-		Relation("PhoneNumbers.PhoneNumber").
+		Set("updated_at = now()").
+		WherePK().
+		Returning("*")
+
+	if data.DisplayName != nil {
+		q = q.Set("display_name = ?", *data.DisplayName)
+	}
+	if data.AvatarURL != nil {
+		q = q.Set("avatar_url = NULLIF(?, '')", *data.AvatarURL)
+	}
+
+	err := q.Scan(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetActive activates or deactivates a user account, in every organization.
+func (s *Svc) SetActive(id uuid.UUID, active bool) (*User, error) {
+	user := User{ID: id}
+	err := s.db.NewUpdate().
+		Model(&user).
+		Set("is_active = ?", active).
+		Set("updated_at = now()").
+		WherePK().
+		Returning("*").
 		Scan(s.ctx)
 	if err != nil {
 		return nil, err
@@ -103,73 +184,176 @@ func (s *Svc) ByID(id string) (*User, error) {
 	return &user, nil
 }
 
-// Add adds a phone number to a user.
-func (p *PhoneNumberSvc) Add(userID uuid.UUID, countryCode, phoneNumber string, isPrimary bool) error {
-	raw := fmt.Sprintf("%s%s", countryCode, phoneNumber)
-	e164 := fmt.Sprintf("+%s%s", countryCode, phoneNumber)
-	// Normalize/build phone number record
-	// NOTE: If you use a lib to format to E.164, set pn.E164 accordingly.
-	pn := phonenumbers.PhoneNumber{
-		ID:             uuid.New(), // let app set, DB also can default
-		RawNumber:      raw,
-		E164:           e164, // assume input is already E.164; replace if you normalize
-		CountryCode:    countryCode,
-		NationalNumber: phoneNumber,
-		CreatedAt:      time.Time{}, // DB default now()
+// SetMemberActive activates or deactivates the membership of a user in the request's
+// organization, leaving their account and other organizations alone. Only owners change
+// the membership of another owner. It must run behind middleware.Tenancy.
+func (s *Svc) SetMemberActive(ctx context.Context, userID uuid.UUID, active bool) (*organizations.OrganizationMember, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	member := organizations.OrganizationMember{}
+	err := db.NewSelect().
+		Model(&member).
+		Where("om.organization_id = ?", t.OrganizationID).
+		Where("om.user_id = ?", userID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, api.NotFound("member not found").Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == organizations.OrgRoleOwner && t.Role != organizations.OrgRoleOwner {
+		return nil, api.Forbidden("only owners can change the membership of another owner")
 	}
 
-	return p.db.RunInTx(p.ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+	err = db.NewUpdate().
+		Model(&member).
+		Set("is_active = ?", active).
+		Where("id = ?", member.ID).
+		Where("organization_id = ?", t.OrganizationID).
+		Returning("*").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Memberships lists the organizations a user belongs to, with their role in each.
+func (s *Svc) Memberships(userID uuid.UUID) ([]Membership, error) {
+	memberships := []Membership{}
+	err := s.asViewer(userID, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().
+			TableExpr("organization_members AS om").
+			Join("JOIN organizations AS org ON org.id = om.organization_id").
+			ColumnExpr("om.organization_id").
+			ColumnExpr("org.name AS organization_name").
+			ColumnExpr("om.role").
+			ColumnExpr("om.is_active").
+			ColumnExpr("om.created_at AS joined_at").
+			Where("om.user_id = ?", userID).
+			OrderExpr("org.name ASC").
+			Scan(ctx, &memberships)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// newPhoneNumber parses a free-form number, national to countryCode unless it carries
+// its own international prefix, into the phone_numbers row. Invalid input is reported
+// as a *phonenumbers.ParseError.
+func newPhoneNumber(countryCode, phoneNumber string) (phonenumbers.PhoneNumber, error) {
+	pn, err := phonenumbers.Parse(phoneNumber, countryCode)
+	if err != nil {
+		return phonenumbers.PhoneNumber{}, err
+	}
+	pn.ID = uuid.New() // let app set, DB also can default
+	return pn, nil
+}
+
+// lockUser serializes phone number changes of one user, so concurrent requests
+// can't both leave (or remove) the primary number.
+func lockUser(ctx context.Context, tx bun.Tx, userID uuid.UUID) error {
+	var id uuid.UUID
+	return tx.NewSelect().
+		Table("users").
+		Column("id").
+		Where("id = ?", userID).
+		For("UPDATE").
+		Scan(ctx, &id)
+}
+
+// demotePrimary clears the primary flag of every number of the user.
+func demotePrimary(ctx context.Context, tx bun.Tx, userID uuid.UUID) error {
+	_, err := tx.NewUpdate().
+		Table("user_phone_numbers").
+		Set("is_primary = FALSE").
+		Where("user_id = ?", userID).
+		Where("is_primary = TRUE").
+		Exec(ctx)
+	return err
+}
+
+// ensurePrimary promotes the oldest number when the user has numbers but no primary one,
+// so a user with phone numbers always has exactly one primary.
+func ensurePrimary(ctx context.Context, tx bun.Tx, userID uuid.UUID) error {
+	_, err := tx.NewUpdate().
+		Table("user_phone_numbers").
+		Set("is_primary = TRUE").
+		Where("id = (SELECT id FROM user_phone_numbers WHERE user_id = ? ORDER BY created_at, id LIMIT 1)", userID).
+		Where("NOT EXISTS (SELECT 1 FROM user_phone_numbers WHERE user_id = ? AND is_primary)", userID).
+		Exec(ctx)
+	return err
+}
+
+// Add adds a phone number to a user. The first number of a user is always primary.
+func (p *PhoneNumberSvc) Add(userID uuid.UUID, countryCode, phoneNumber string, isPrimary bool) (*UserPhoneNumber, error) {
+	pn, err := newPhoneNumber(countryCode, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	upn := UserPhoneNumber{
+		UserID:    &userID,
+		IsPrimary: isPrimary,
+	}
+
+	err = p.db.RunInTx(p.ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
 		// Upsert phone number by E.164 and return its ID
-		_, err := tx.NewInsert().
-			Model(&pn).
-			Column("id", "raw_number", "e164", "country_code", "national_number").
-			On("CONFLICT (e164) DO UPDATE SET raw_number = EXCLUDED.raw_number").
-			Returning("id").
-			Exec(ctx)
+		err = phonenumbers.Upsert(ctx, tx, &pn)
 		if err != nil {
 			return err
 		}
 
 		// If marking as primary, demote others first
 		if isPrimary {
-			_, err = tx.NewUpdate().
-				Table("user_phone_numbers").
-				Set("is_primary = FALSE").
-				Where("user_id = ?", userID).
-				Where("is_primary = TRUE").
-				Exec(ctx)
+			err = demotePrimary(ctx, tx, userID)
 			if err != nil {
 				return err
 			}
 		}
 
-		upn := UserPhoneNumber{
-			UserID:        &userID,
-			PhoneNumberID: pn.ID,
-			IsPrimary:     isPrimary,
-		}
+		upn.PhoneNumberID = pn.ID
 
-		// Link user to phone number (ignore duplicate links)
+		// Link user to phone number; re-adding an existing link only promotes it.
 		_, err = tx.NewInsert().
 			Model(&upn).
-			On("CONFLICT (user_id, phone_number_id) DO NOTHING").
+			Column("user_id", "phone_number_id", "is_primary").
+			On("CONFLICT (user_id, phone_number_id) DO UPDATE").
+			Set("is_primary = upn.is_primary OR EXCLUDED.is_primary").
+			Returning("id").
 			Exec(ctx)
 		if err != nil {
 			p.log.Err(err).Msg("failed to link user to phone number")
 			return err
 		}
 
-		return nil
+		return ensurePrimary(ctx, tx, userID)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(userID, upn.ID)
 }
 
-// List lists all phone numbers for a user with phone data.
+// List lists all phone numbers for a user with phone data, primary first.
 func (p *PhoneNumberSvc) List(userID uuid.UUID) ([]*UserPhoneNumber, error) {
-	var upn []*UserPhoneNumber
+	upn := []*UserPhoneNumber{}
 	err := p.db.NewSelect().
 		Model(&upn).
 		Where("upn.user_id = ?", userID).
 		Relation("PhoneNumber").
+		OrderExpr("upn.is_primary DESC, upn.created_at ASC").
 		Scan(p.ctx)
 	if err != nil {
 		p.log.Debug().Err(err).Msg("failed to list phone_numbers")
@@ -177,3 +361,148 @@ func (p *PhoneNumberSvc) List(userID uuid.UUID) ([]*UserPhoneNumber, error) {
 	}
 	return upn, nil
 }
+
+// ByID gets one of the user's phone numbers by its link id.
+func (p *PhoneNumberSvc) ByID(userID, id uuid.UUID) (*UserPhoneNumber, error) {
+	var upn UserPhoneNumber
+	err := p.db.NewSelect().
+		Model(&upn).
+		Where("upn.id = ?", id).
+		Where("upn.user_id = ?", userID).
+		Relation("PhoneNumber").
+		Scan(p.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &upn, nil
+}
+
+// ByNumber gets one of the user's phone numbers by its E.164 form.
+func (p *PhoneNumberSvc) ByNumber(userID uuid.UUID, e164 string) (*UserPhoneNumber, error) {
+	var upn UserPhoneNumber
+	err := p.db.NewSelect().
+		Model(&upn).
+		Relation("PhoneNumber").
+		Where("upn.user_id = ?", userID).
+		Where("phone_number.e164 = ?", e164).
+		Scan(p.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &upn, nil
+}
+
+// Remove unlinks a phone number from the user. Removing the primary number
+// promotes the oldest remaining one.
+func (p *PhoneNumberSvc) Remove(userID, id uuid.UUID) error {
+	return p.db.RunInTx(p.ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewDelete().
+			Model((*UserPhoneNumber)(nil)).
+			Where("id = ?", id).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return ensurePrimary(ctx, tx, userID)
+	})
+}
+
+// SetPrimary makes the given number the user's only primary number.
+func (p *PhoneNumberSvc) SetPrimary(userID, id uuid.UUID) (*UserPhoneNumber, error) {
+	err := p.db.RunInTx(p.ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		exists, err := tx.NewSelect().
+			Model((*UserPhoneNumber)(nil)).
+			Where("id = ?", id).
+			Where("user_id = ?", userID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		err = demotePrimary(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*UserPhoneNumber)(nil)).
+			Set("is_primary = TRUE").
+			Where("id = ?", id).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(userID, id)
+}
+
+// Update replaces the number behind one of the user's phone number links,
+// keeping its primary flag.
+func (p *PhoneNumberSvc) Update(userID, id uuid.UUID, countryCode, phoneNumber string) (*UserPhoneNumber, error) {
+	pn, err := newPhoneNumber(countryCode, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.db.RunInTx(p.ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		err = phonenumbers.Upsert(ctx, tx, &pn)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewUpdate().
+			Model((*UserPhoneNumber)(nil)).
+			Set("phone_number_id = ?", pn.ID).
+			Where("id = ?", id).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ByID(userID, id)
+}
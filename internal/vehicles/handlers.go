@@ -0,0 +1,383 @@
+package vehicles
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/vin"
+)
+
+type h interface {
+	Create() http.HandlerFunc
+	ByID() http.HandlerFunc
+	List() http.HandlerFunc
+	Lookup() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	DecodeVIN() http.HandlerFunc
+	Mileage() http.HandlerFunc
+	AddMileage() http.HandlerFunc
+	VoidMileage() http.HandlerFunc
+	History() http.HandlerFunc
+	Transfer() http.HandlerFunc
+	Owners() http.HandlerFunc
+}
+
+type Hdlr struct {
+	db  *bun.DB
+	log zerolog.Logger
+	svc Svc
+}
+
+var _ h = (*Hdlr)(nil)
+
+func Handler(log zerolog.Logger, db *bun.DB) Hdlr {
+	svc := Service(log, db)
+	return Hdlr{db, log, svc}
+}
+
+// CreateVehicle is the body of POST /customers/{id}/vehicles. Make and Year are taken
+// from the VIN when omitted.
+type CreateVehicle struct {
+	VIN         *string `json:"vin,omitempty" validate:"max=32"`
+	PlateNumber *string `json:"plate_number,omitempty" validate:"max=20"`
+	Make        *string `json:"make,omitempty" validate:"max=100"`
+	Model       *string `json:"model,omitempty" validate:"max=100"`
+	Year        *int    `json:"year,omitempty" validate:"min=1900"`
+	Color       *string `json:"color,omitempty" validate:"max=50"`
+	MileageKM   *int    `json:"mileage_km,omitempty" validate:"min=0,max=5000000"`
+}
+
+func (v CreateVehicle) Validate() error {
+	var fe api.FieldErrors
+	validateYear(&fe, v.Year)
+	return fe.Err()
+}
+
+// UpdateVehicle holds the fields PATCH /vehicles/{id} may change; nil fields are left
+// untouched and empty strings clear them. MileageKM is logged as an odometer reading.
+type UpdateVehicle struct {
+	VIN         *string `json:"vin,omitempty" validate:"max=32"`
+	PlateNumber *string `json:"plate_number,omitempty" validate:"max=20"`
+	Make        *string `json:"make,omitempty" validate:"max=100"`
+	Model       *string `json:"model,omitempty" validate:"max=100"`
+	Year        *int    `json:"year,omitempty" validate:"min=1900"`
+	Color       *string `json:"color,omitempty" validate:"max=50"`
+	MileageKM   *int    `json:"mileage_km,omitempty" validate:"min=0,max=5000000"`
+}
+
+func (v UpdateVehicle) Validate() error {
+	var fe api.FieldErrors
+	validateYear(&fe, v.Year)
+	return fe.Err()
+}
+
+// AddMileage is the body of POST /vehicles/{id}/mileage.
+type AddMileage struct {
+	MileageKM int `json:"mileage_km" validate:"min=0,max=5000000"`
+}
+
+// TransferVehicle is the body of POST /vehicles/{id}/transfer. EffectiveAt is when the
+// new customer became the owner, now by default; Svc.Transfer rejects future times.
+type TransferVehicle struct {
+	CustomerID  uuid.UUID  `json:"customer_id" validate:"required"`
+	EffectiveAt *time.Time `json:"effective_at,omitempty"`
+	Notes       *string    `json:"notes,omitempty" validate:"max=1000"`
+}
+
+// validateYear rejects model years after next year's.
+func validateYear(fe *api.FieldErrors, year *int) {
+	if maxYear := time.Now().Year() + 1; year != nil && *year > maxYear {
+		fe.Add("year", "must be at most %d", maxYear)
+	}
+}
+
+// Create adds a vehicle to the customer in the path.
+func (h *Hdlr) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			api.WriteError(w, api.BadRequest("invalid customer id"))
+			return
+		}
+
+		data, err := api.Decode[CreateVehicle](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		v, err := h.svc.Create(r.Context(), customerID, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating vehicle")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Vehicle](w, http.StatusCreated, v)
+	}
+}
+
+// ByID gets a vehicle.
+func (h *Hdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		v, err := h.svc.ByID(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting vehicle")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Vehicle](w, http.StatusOK, v)
+	}
+}
+
+// List lists the organization's vehicles, see ListSpec.
+func (h *Hdlr) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, ListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		vs, page, err := h.svc.List(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing vehicles")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*Vehicle](w, http.StatusOK, vs, page)
+	}
+}
+
+// Lookup finds vehicles by the plate and/or vin query parameters.
+func (h *Hdlr) Lookup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plate := r.URL.Query().Get("plate")
+		v := r.URL.Query().Get("vin")
+		if plate == "" && v == "" {
+			api.WriteError(w, api.BadRequest("plate or vin is required"))
+			return
+		}
+
+		vs, err := h.svc.Lookup(r.Context(), plate, v)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error looking up vehicles")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Vehicle](w, http.StatusOK, vs)
+	}
+}
+
+// Update changes the details of a vehicle.
+func (h *Hdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateVehicle](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		v, err := h.svc.Update(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating vehicle")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Vehicle](w, http.StatusOK, v)
+	}
+}
+
+// Delete deletes a vehicle.
+func (h *Hdlr) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		err := h.svc.Delete(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting vehicle")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DecodeVIN validates the VIN in the path and returns what it tells about the vehicle,
+// without storing anything.
+func (h *Hdlr) DecodeVIN() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, err := parseVIN(mux.Vars(r)["vin"])
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[vin.Info](w, http.StatusOK, info)
+	}
+}
+
+// Mileage lists the odometer readings of a vehicle.
+func (h *Hdlr) Mileage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		readings, err := h.svc.Mileage(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing vehicle mileage")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*MileageReading](w, http.StatusOK, readings)
+	}
+}
+
+// AddMileage logs an odometer reading taken outside a work order.
+func (h *Hdlr) AddMileage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[AddMileage](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		reading, err := h.svc.AddMileage(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error adding vehicle mileage")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*MileageReading](w, http.StatusCreated, reading)
+	}
+}
+
+// VoidMileage withdraws a wrong odometer reading and recomputes the vehicle's mileage.
+func (h *Hdlr) VoidMileage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+		readingID, err := uuid.Parse(mux.Vars(r)["readingID"])
+		if err != nil {
+			api.WriteError(w, api.BadRequest("invalid reading id"))
+			return
+		}
+
+		reading, err := h.svc.VoidMileage(r.Context(), id, readingID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error voiding vehicle mileage")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*MileageReading](w, http.StatusOK, reading)
+	}
+}
+
+// History gets the service timeline of a vehicle.
+func (h *Hdlr) History() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		entries, err := h.svc.History(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting vehicle history")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*TimelineEntry](w, http.StatusOK, entries)
+	}
+}
+
+// Transfer moves a vehicle to another customer.
+func (h *Hdlr) Transfer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[TransferVehicle](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		transferred, err := h.svc.Transfer(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error transferring vehicle")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Transferred](w, http.StatusOK, transferred)
+	}
+}
+
+// Owners lists the ownership history of a vehicle.
+func (h *Hdlr) Owners() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := vehicleID(w, r)
+		if !ok {
+			return
+		}
+
+		owners, err := h.svc.Owners(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing vehicle owners")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Ownership](w, http.StatusOK, owners)
+	}
+}
+
+func vehicleID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid vehicle id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,163 @@
+package vehicles
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// EntryType is the kind of event of a vehicle's timeline.
+type EntryType string
+
+const (
+	EntryAppointment EntryType = "appointment"
+	EntryWorkOrder   EntryType = "work_order"
+	EntryLineItem    EntryType = "line_item"
+	EntryMileage     EntryType = "mileage"
+	EntryOwnership   EntryType = "ownership"
+)
+
+// TimelineEntry is one event of a vehicle's history. At is when it happened and only the
+// field matching Type is set.
+type TimelineEntry struct {
+	Type        EntryType            `json:"type"`
+	At          time.Time            `json:"at"`
+	Appointment *TimelineAppointment `json:"appointment,omitempty"`
+	WorkOrder   *TimelineWorkOrder   `json:"work_order,omitempty"`
+	LineItem    *TimelineLineItem    `json:"line_item,omitempty"`
+	Mileage     *MileageReading      `json:"mileage,omitempty"`
+	Ownership   *Ownership           `json:"ownership,omitempty"`
+}
+
+// TimelineAppointment is an appointment for the vehicle, at its start time.
+type TimelineAppointment struct {
+	ID         uuid.UUID `bun:"id" json:"id"`
+	CustomerID uuid.UUID `bun:"customer_id" json:"customer_id"`
+	Title      string    `bun:"title" json:"title"`
+	Status     string    `bun:"status" json:"status"`
+	StartTime  time.Time `bun:"start_time" json:"start_time"`
+	EndTime    time.Time `bun:"end_time" json:"end_time"`
+}
+
+// TimelineWorkOrder is a work order on the vehicle, at the time it was opened.
+// CustomerID is the customer it was done for.
+type TimelineWorkOrder struct {
+	ID          uuid.UUID  `bun:"id" json:"id"`
+	CustomerID  uuid.UUID  `bun:"customer_id" json:"customer_id"`
+	Title       string     `bun:"title" json:"title"`
+	Status      string     `bun:"status" json:"status"`
+	OpenedAt    time.Time  `bun:"opened_at" json:"opened_at"`
+	CompletedAt *time.Time `bun:"completed_at" json:"completed_at,omitempty"`
+	TotalCents  int64      `bun:"total_cents" json:"total_cents"`
+}
+
+// TimelineLineItem is a line item of a completed work order: work performed on the
+// vehicle, at the time the work order was completed.
+type TimelineLineItem struct {
+	ID          uuid.UUID       `bun:"id" json:"id"`
+	WorkOrderID uuid.UUID       `bun:"work_order_id" json:"work_order_id"`
+	ItemType    string          `bun:"item_type" json:"item_type"`
+	SKU         *string         `bun:"sku" json:"sku,omitempty"`
+	Name        string          `bun:"name" json:"name"`
+	Qty         decimal.Decimal `bun:"qty" json:"qty"`
+	CompletedAt time.Time       `bun:"completed_at" json:"-"`
+}
+
+// History is the vehicle's timeline: its appointments, work orders, the line items of
+// its completed work orders, its odometer readings and the start of each ownership,
+// oldest first.
+func (s *Svc) History(ctx context.Context, id uuid.UUID) ([]*TimelineEntry, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	err := checkVehicle(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var appointments []*TimelineAppointment
+	err = db.NewSelect().
+		Table("appointments").
+		Column("id", "customer_id", "title", "status", "start_time", "end_time").
+		Where("vehicle_id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Scan(ctx, &appointments)
+	if err != nil {
+		return nil, err
+	}
+
+	var workOrders []*TimelineWorkOrder
+	err = db.NewSelect().
+		Table("work_orders").
+		Column("id", "customer_id", "title", "status", "opened_at", "completed_at", "total_cents").
+		Where("vehicle_id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Scan(ctx, &workOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*TimelineLineItem
+	err = db.NewSelect().
+		TableExpr("work_order_items AS woi").
+		Join("JOIN work_orders AS wo ON wo.id = woi.work_order_id").
+		ColumnExpr("woi.id, woi.work_order_id, woi.item_type, woi.sku, woi.name, woi.qty").
+		ColumnExpr("wo.completed_at").
+		Where("wo.vehicle_id = ?", id).
+		Where("wo.organization_id = ?", t.OrganizationID).
+		Where("wo.status = 'completed'").
+		OrderExpr("woi.position ASC").
+		Scan(ctx, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []*MileageReading
+	err = db.NewSelect().
+		Model(&readings).
+		Where("odo.vehicle_id = ?", id).
+		Where("odo.organization_id = ?", t.OrganizationID).
+		Where("odo.voided_at IS NULL").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []*Ownership
+	err = db.NewSelect().
+		Model(&owners).
+		Where("vo.vehicle_id = ?", id).
+		Where("vo.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*TimelineEntry, 0, len(appointments)+len(workOrders)+len(items)+len(readings)+len(owners))
+	for _, a := range appointments {
+		entries = append(entries, &TimelineEntry{Type: EntryAppointment, At: a.StartTime, Appointment: a})
+	}
+	for _, wo := range workOrders {
+		entries = append(entries, &TimelineEntry{Type: EntryWorkOrder, At: wo.OpenedAt, WorkOrder: wo})
+	}
+	for _, it := range items {
+		entries = append(entries, &TimelineEntry{Type: EntryLineItem, At: it.CompletedAt, LineItem: it})
+	}
+	for _, r := range readings {
+		entries = append(entries, &TimelineEntry{Type: EntryMileage, At: r.RecordedAt, Mileage: r})
+	}
+	for _, o := range owners {
+		entries = append(entries, &TimelineEntry{Type: EntryOwnership, At: o.StartedAt, Ownership: o})
+	}
+
+	// Stable, so line items keep their work order position.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries, nil
+}
@@ -0,0 +1,274 @@
+package vehicles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// ReadingSource is when an odometer reading was taken.
+type ReadingSource string
+
+const (
+	ReadingCheckIn  ReadingSource = "check_in"
+	ReadingCheckOut ReadingSource = "check_out"
+	ReadingManual   ReadingSource = "manual"
+)
+
+// Valid reports whether s is a known reading source (the odometer_reading_source enum).
+func (s ReadingSource) Valid() bool {
+	switch s {
+	case ReadingCheckIn, ReadingCheckOut, ReadingManual:
+		return true
+	}
+	return false
+}
+
+// MileageReading is one entry of a vehicle's odometer log. Decreased flags a reading
+// lower than the vehicle's mileage at the time (PreviousKM): a rollback, a swapped
+// odometer or a typo for someone to review. A voided reading (VoidedAt) was withdrawn by
+// a manager and no longer counts, see Svc.VoidMileage.
+type MileageReading struct {
+	bun.BaseModel `bun:"table:odometer_readings,alias:odo"`
+
+	ID             uuid.UUID     `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID     `bun:"organization_id,notnull" json:"organization_id"`
+	VehicleID      uuid.UUID     `bun:"vehicle_id,notnull" json:"vehicle_id"`
+	WorkOrderID    *uuid.UUID    `bun:"work_order_id" json:"work_order_id,omitempty"`
+	Source         ReadingSource `bun:"source,type:odometer_reading_source,notnull" json:"source"`
+	MileageKM      int           `bun:"mileage_km,notnull" json:"mileage_km"`
+	PreviousKM     *int          `bun:"previous_km" json:"previous_km,omitempty"`
+	Decreased      bool          `bun:"decreased,notnull,default:false" json:"decreased"`
+	RecordedBy     *uuid.UUID    `bun:"recorded_by" json:"recorded_by,omitempty"`
+	RecordedAt     time.Time     `bun:"recorded_at,notnull,default:now()" json:"recorded_at"`
+	VoidedAt       *time.Time    `bun:"voided_at" json:"voided_at,omitempty"`
+	VoidedBy       *uuid.UUID    `bun:"voided_by" json:"voided_by,omitempty"`
+}
+
+// ErrReadingNotFound is returned for a reading that is not in the vehicle's log.
+var ErrReadingNotFound = api.NotFound("odometer reading not found")
+
+// ErrReadingVoided is returned when voiding a reading twice.
+var ErrReadingVoided = api.Conflict("odometer reading is already voided")
+
+// RecordMileage logs an odometer reading of a vehicle of t's organization, on behalf of
+// t's user, and makes it the vehicle's mileage unless it is lower than the current one,
+// in which case the reading is flagged as Decreased and the mileage kept. The vehicle
+// row is locked so concurrent readings compare against each other. It returns
+// ErrNotFound when the vehicle does not exist.
+func RecordMileage(ctx context.Context, db bun.IDB, t tenant.Tenant, vehicleID uuid.UUID, workOrderID *uuid.UUID, source ReadingSource, km int) (*MileageReading, error) {
+	var previous *int
+	err := db.NewSelect().
+		Model((*Vehicle)(nil)).
+		Column("mileage_km").
+		Where("v.id = ?", vehicleID).
+		Where("v.organization_id = ?", t.OrganizationID).
+		For("UPDATE").
+		Scan(ctx, &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reading := MileageReading{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		VehicleID:      vehicleID,
+		WorkOrderID:    workOrderID,
+		Source:         source,
+		MileageKM:      km,
+		PreviousKM:     previous,
+		Decreased:      previous != nil && km < *previous,
+		RecordedBy:     &t.UserID,
+		RecordedAt:     time.Now(),
+	}
+	_, err = db.NewInsert().
+		Model(&reading).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if reading.Decreased {
+		return &reading, nil
+	}
+
+	_, err = db.NewUpdate().
+		Model((*Vehicle)(nil)).
+		Set("mileage_km = ?", km).
+		Set("updated_at = ?", reading.RecordedAt).
+		Where("id = ?", vehicleID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// Mileage lists the odometer readings of a vehicle, oldest first, voided ones included.
+func (s *Svc) Mileage(ctx context.Context, id uuid.UUID) ([]*MileageReading, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	err := checkVehicle(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := []*MileageReading{}
+	err = db.NewSelect().
+		Model(&readings).
+		Where("odo.vehicle_id = ?", id).
+		Where("odo.organization_id = ?", t.OrganizationID).
+		OrderExpr("odo.recorded_at ASC, odo.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// AddMileage logs a reading taken outside a work order, see RecordMileage.
+func (s *Svc) AddMileage(ctx context.Context, id uuid.UUID, data AddMileage) (*MileageReading, error) {
+	t := tenant.MustFromContext(ctx)
+	return RecordMileage(ctx, tenant.DB(ctx, s.db), t, id, nil, ReadingManual, data.MileageKM)
+}
+
+// VoidMileage withdraws a wrong odometer reading of a vehicle, typically a typo too high
+// to be overtaken. The reading stays in the log with VoidedAt; the vehicle's mileage and
+// the Decreased flag and PreviousKM of the remaining readings are recomputed from them
+// in order, as if the voided one had never been taken.
+func (s *Svc) VoidMileage(ctx context.Context, id, readingID uuid.UUID) (*MileageReading, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	// Lock the vehicle first, like RecordMileage, so no reading slips in meanwhile.
+	exists, err := db.NewSelect().
+		Model((*Vehicle)(nil)).
+		Where("v.id = ?", id).
+		Where("v.organization_id = ?", t.OrganizationID).
+		For("UPDATE").
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	var reading MileageReading
+	err = db.NewSelect().
+		Model(&reading).
+		Where("odo.id = ?", readingID).
+		Where("odo.vehicle_id = ?", id).
+		Where("odo.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReadingNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reading.VoidedAt != nil {
+		return nil, ErrReadingVoided
+	}
+
+	now := time.Now()
+	reading.VoidedAt = &now
+	reading.VoidedBy = &t.UserID
+	_, err = db.NewUpdate().
+		Model(&reading).
+		Column("voided_at", "voided_by").
+		WherePK().
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = replayMileage(ctx, db, t.OrganizationID, id, now)
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// replayMileage recomputes the Decreased flag and PreviousKM of the readings of a
+// locked vehicle that are not voided, oldest first, and sets the vehicle's mileage to
+// the last one that was not lower than its predecessors (NULL when none remain).
+func replayMileage(ctx context.Context, db bun.IDB, orgID, id uuid.UUID, now time.Time) error {
+	var readings []*MileageReading
+	err := db.NewSelect().
+		Model(&readings).
+		Where("odo.vehicle_id = ?", id).
+		Where("odo.organization_id = ?", orgID).
+		Where("odo.voided_at IS NULL").
+		OrderExpr("odo.recorded_at ASC, odo.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var mileage *int
+	for _, r := range readings {
+		decreased := mileage != nil && r.MileageKM < *mileage
+		if decreased != r.Decreased || !sameKM(mileage, r.PreviousKM) {
+			r.Decreased, r.PreviousKM = decreased, mileage
+			_, err = db.NewUpdate().
+				Model(r).
+				Column("decreased", "previous_km").
+				WherePK().
+				Where("organization_id = ?", orgID).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if !decreased {
+			km := r.MileageKM
+			mileage = &km
+		}
+	}
+
+	_, err = db.NewUpdate().
+		Model((*Vehicle)(nil)).
+		Set("mileage_km = ?", mileage).
+		Set("updated_at = ?", now).
+		Where("id = ?", id).
+		Where("organization_id = ?", orgID).
+		Exec(ctx)
+	return err
+}
+
+func sameKM(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkVehicle makes sure a vehicle exists in the organization.
+func checkVehicle(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) error {
+	exists, err := db.NewSelect().
+		Table("vehicles").
+		Where("id = ?", id).
+		Where("organization_id = ?", orgID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package vehicles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+// Ownership is a period a customer owned a vehicle, from StartedAt until EndedAt; the
+// current owner's has no EndedAt. Work orders and appointments keep the customer they
+// were made for, so they stay with the owner at the time.
+type Ownership struct {
+	bun.BaseModel `bun:"table:vehicle_ownerships,alias:vo"`
+
+	ID             uuid.UUID  `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID  `bun:"organization_id,notnull" json:"organization_id"`
+	VehicleID      uuid.UUID  `bun:"vehicle_id,notnull" json:"vehicle_id"`
+	CustomerID     uuid.UUID  `bun:"customer_id,notnull" json:"customer_id"`
+	StartedAt      time.Time  `bun:"started_at,notnull" json:"started_at"`
+	EndedAt        *time.Time `bun:"ended_at" json:"ended_at,omitempty"`
+	Notes          *string    `bun:"notes" json:"notes,omitempty"`
+	CreatedBy      *uuid.UUID `bun:"created_by" json:"created_by,omitempty"`
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:now()" json:"created_at"`
+}
+
+// Transferred is the result of a transfer: the vehicle and its new ownership.
+type Transferred struct {
+	Vehicle   *Vehicle   `json:"vehicle"`
+	Ownership *Ownership `json:"ownership"`
+}
+
+// Transfer moves a vehicle to another customer of the organization, ending the current
+// ownership at data.EffectiveAt (default now) and starting the new customer's.
+func (s *Svc) Transfer(ctx context.Context, id uuid.UUID, data TransferVehicle) (*Transferred, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	var v Vehicle
+	err := db.NewSelect().
+		Model(&v).
+		Where("v.id = ?", id).
+		Where("v.organization_id = ?", t.OrganizationID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if data.CustomerID == v.CustomerID {
+		return nil, api.Validation("request validation failed", api.FieldError{
+			Field:   "customer_id",
+			Message: "customer already owns this vehicle",
+		})
+	}
+	exists, err := db.NewSelect().
+		Table("customers").
+		Where("id = ?", data.CustomerID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, api.Validation("request validation failed", api.FieldError{
+			Field:   "customer_id",
+			Message: "customer not found",
+		})
+	}
+
+	now := time.Now()
+	effective := now
+	if data.EffectiveAt != nil {
+		if data.EffectiveAt.After(now) {
+			return nil, api.Validation("request validation failed", api.FieldError{
+				Field:   "effective_at",
+				Message: "must not be in the future",
+			})
+		}
+		effective = *data.EffectiveAt
+	}
+
+	current, err := currentOwnership(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		if !effective.After(current.StartedAt) {
+			return nil, api.Validation("request validation failed", api.FieldError{
+				Field:   "effective_at",
+				Message: "must be after the current ownership started",
+			})
+		}
+
+		_, err = db.NewUpdate().
+			Model((*Ownership)(nil)).
+			Set("ended_at = ?", effective).
+			Where("id = ?", current.ID).
+			Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o, err := startOwnership(ctx, db, t, id, data.CustomerID, effective, data.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NewUpdate().
+		Model((*Vehicle)(nil)).
+		Set("customer_id = ?", data.CustomerID).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicle, err := s.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Transferred{Vehicle: vehicle, Ownership: o}, nil
+}
+
+// Owners lists the ownerships of a vehicle, oldest first.
+func (s *Svc) Owners(ctx context.Context, id uuid.UUID) ([]*Ownership, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	err := checkVehicle(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := []*Ownership{}
+	err = db.NewSelect().
+		Model(&owners).
+		Where("vo.vehicle_id = ?", id).
+		Where("vo.organization_id = ?", t.OrganizationID).
+		OrderExpr("vo.started_at ASC, vo.created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
+
+// currentOwnership gets the open ownership of a vehicle, nil if it has none.
+func currentOwnership(ctx context.Context, db bun.IDB, orgID, vehicleID uuid.UUID) (*Ownership, error) {
+	var o Ownership
+	err := db.NewSelect().
+		Model(&o).
+		Where("vo.vehicle_id = ?", vehicleID).
+		Where("vo.organization_id = ?", orgID).
+		Where("vo.ended_at IS NULL").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// startOwnership opens the ownership of a vehicle by a customer.
+func startOwnership(ctx context.Context, db bun.IDB, t tenant.Tenant, vehicleID, customerID uuid.UUID, at time.Time, notes *string) (*Ownership, error) {
+	o := Ownership{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		VehicleID:      vehicleID,
+		CustomerID:     customerID,
+		StartedAt:      at,
+		Notes:          trimmed(notes),
+		CreatedBy:      &t.UserID,
+	}
+	_, err := db.NewInsert().
+		Model(&o).
+		ExcludeColumn("ended_at", "created_at").
+		Returning("created_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
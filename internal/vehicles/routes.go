@@ -0,0 +1,45 @@
+package vehicles
+
+import (
+	"context"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the vehicle endpoints, including POST /customers/{id}/vehicles.
+// They are organization scoped: requests need the X-Org-Id header and a role granting
+// the endpoint's permission; tenancy authenticates the caller and scopes the request
+// to the organization (see middleware.Tenancy).
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, db *bun.DB, tenancy mwchain.Chain) {
+	v := v1.PathPrefix("/vehicles").Subrouter()
+	vehLog := log.With().Str("route", "vehicles").Logger()
+	vehHandler := Handler(vehLog, db)
+
+	scoped := mwchain.NewChain(middleware.Logger(vehLog)).Extend(tenancy)
+	read := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesRead))
+	write := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesWrite))
+	del := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesDelete))
+	correct := scoped.Append(middleware.RequirePermission(organizations.PermVehiclesCorrect))
+
+	v1.Handle("/customers/{id}/vehicles", write.Then(vehHandler.Create())).Methods(api.POST)
+
+	v.Handle("", read.Then(vehHandler.List())).Methods(api.GET)
+	v.Handle("/lookup", read.Then(vehHandler.Lookup())).Methods(api.GET)
+	v.Handle("/vin/{vin}", read.Then(vehHandler.DecodeVIN())).Methods(api.GET)
+	v.Handle("/{id}", read.Then(vehHandler.ByID())).Methods(api.GET)
+	v.Handle("/{id}", write.Then(vehHandler.Update())).Methods(api.PATCH)
+	v.Handle("/{id}", del.Then(vehHandler.Delete())).Methods(api.DEL)
+	v.Handle("/{id}/history", read.Then(vehHandler.History())).Methods(api.GET)
+	v.Handle("/{id}/mileage", read.Then(vehHandler.Mileage())).Methods(api.GET)
+	v.Handle("/{id}/mileage", write.Then(vehHandler.AddMileage())).Methods(api.POST)
+	v.Handle("/{id}/mileage/{readingID}/void", correct.Then(vehHandler.VoidMileage())).Methods(api.POST)
+	v.Handle("/{id}/owners", read.Then(vehHandler.Owners())).Methods(api.GET)
+	v.Handle("/{id}/transfer", write.Then(vehHandler.Transfer())).Methods(api.POST)
+}
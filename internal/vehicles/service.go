@@ -0,0 +1,346 @@
+package vehicles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+	"github.com/brxyxn/engine-care-api/internal/vin"
+)
+
+var (
+	ErrNotFound         = api.NotFound("vehicle not found")
+	ErrCustomerNotFound = api.NotFound("customer not found")
+	ErrVINTaken         = api.Conflict("another vehicle of the organization has this VIN")
+)
+
+type s interface {
+	Create(ctx context.Context, customerID uuid.UUID, data CreateVehicle) (*Vehicle, error)
+	ByID(ctx context.Context, id uuid.UUID) (*Vehicle, error)
+	List(ctx context.Context, params api.ListParams) ([]*Vehicle, api.Page, error)
+	Lookup(ctx context.Context, plate, v string) ([]*Vehicle, error)
+	Update(ctx context.Context, id uuid.UUID, data UpdateVehicle) (*Vehicle, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Mileage(ctx context.Context, id uuid.UUID) ([]*MileageReading, error)
+	AddMileage(ctx context.Context, id uuid.UUID, data AddMileage) (*MileageReading, error)
+	VoidMileage(ctx context.Context, id, readingID uuid.UUID) (*MileageReading, error)
+	History(ctx context.Context, id uuid.UUID) ([]*TimelineEntry, error)
+	Transfer(ctx context.Context, id uuid.UUID, data TransferVehicle) (*Transferred, error)
+	Owners(ctx context.Context, id uuid.UUID) ([]*Ownership, error)
+}
+
+// Svc manages the vehicles of the request's organization. Every method must run
+// behind middleware.Tenancy: queries go through the request transaction (tenant.DB)
+// and are filtered by the tenant's organization.
+type Svc struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+var _ s = (*Svc)(nil)
+
+func Service(log zerolog.Logger, db *bun.DB) Svc {
+	return Svc{
+		db:  db,
+		log: log,
+	}
+}
+
+// ListSpec is the filters and sort orders accepted by GET /vehicles.
+var ListSpec = api.ListSpec{
+	Alias: "v",
+	Filters: []api.Filter{
+		{Param: "customer_id", Column: "customer_id", Parse: api.ParseUUID},
+		{Param: "created_after", Column: "created_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "created_before", Column: "created_at", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:   []string{"created_at", "updated_at"},
+	Default: "-created_at",
+	Search:  []string{"plate_number", "vin", "make", "model"},
+}
+
+// Create adds a vehicle to a customer. A VIN is validated and stored normalized, and
+// fills in the make and year when they are not given. The customer's ownership starts
+// now and the mileage is logged as the first odometer reading.
+func (s *Svc) Create(ctx context.Context, customerID uuid.UUID, data CreateVehicle) (*Vehicle, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	exists, err := db.NewSelect().
+		Table("customers").
+		Where("id = ?", customerID).
+		Where("organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrCustomerNotFound
+	}
+
+	v := Vehicle{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		CustomerID:     customerID,
+		PlateNumber:    trimmed(data.PlateNumber),
+		Make:           trimmed(data.Make),
+		Model:          trimmed(data.Model),
+		Year:           data.Year,
+		Color:          trimmed(data.Color),
+	}
+
+	if data.VIN != nil && *data.VIN != "" {
+		info, err := parseVIN(*data.VIN)
+		if err != nil {
+			return nil, err
+		}
+		err = checkVIN(ctx, db, t.OrganizationID, info.VIN, uuid.Nil)
+		if err != nil {
+			return nil, err
+		}
+
+		v.VIN = &info.VIN
+		if v.Make == nil && info.Manufacturer != "" {
+			v.Make = &info.Manufacturer
+		}
+		if v.Year == nil {
+			v.Year = info.ModelYear
+		}
+	}
+
+	_, err = db.NewInsert().
+		Model(&v).
+		ExcludeColumn("created_at", "updated_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = startOwnership(ctx, db, t, v.ID, customerID, time.Now(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.MileageKM != nil {
+		_, err = RecordMileage(ctx, db, t, v.ID, nil, ReadingManual, *data.MileageKM)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.ByID(ctx, v.ID)
+}
+
+// ByID gets a vehicle.
+func (s *Svc) ByID(ctx context.Context, id uuid.UUID) (*Vehicle, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var v Vehicle
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&v).
+		Where("v.id = ?", id).
+		Where("v.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List lists one page of vehicles.
+func (s *Svc) List(ctx context.Context, params api.ListParams) ([]*Vehicle, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	vs := []*Vehicle{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&vs).
+		Where("v.organization_id = ?", t.OrganizationID)
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	vs, page := api.PageOf(params, vs)
+	return vs, page, nil
+}
+
+// maxLookup is the most vehicles Lookup returns; plates are not unique.
+const maxLookup = 50
+
+// Lookup finds vehicles by plate number, ignoring case, spaces and punctuation, and/or
+// by VIN. Both must match when both are given.
+func (s *Svc) Lookup(ctx context.Context, plate, v string) ([]*Vehicle, error) {
+	t := tenant.MustFromContext(ctx)
+
+	vs := []*Vehicle{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&vs).
+		Where("v.organization_id = ?", t.OrganizationID).
+		OrderExpr("v.created_at DESC, v.id").
+		Limit(maxLookup)
+
+	if plate != "" {
+		q = q.Where("app.normalize_plate(v.plate_number) = app.normalize_plate(?)", plate)
+	}
+	if v != "" {
+		q = q.Where("v.vin = ?", vin.Normalize(v))
+	}
+
+	err := q.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// Update changes the details of a vehicle. A new VIN fills in the make and year when
+// the vehicle has none and they are not given. A new mileage is logged as a manual
+// odometer reading, see RecordMileage.
+func (s *Svc) Update(ctx context.Context, id uuid.UUID, data UpdateVehicle) (*Vehicle, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	q := db.NewUpdate().
+		Model((*Vehicle)(nil)).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	// Empty strings clear the text fields.
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{"plate_number", data.PlateNumber},
+		{"make", data.Make},
+		{"model", data.Model},
+		{"color", data.Color},
+	} {
+		if f.value != nil {
+			q = q.Set("? = NULLIF(?, '')", bun.Ident(f.column), strings.TrimSpace(*f.value))
+		}
+	}
+	if data.Year != nil {
+		q = q.Set("year = ?", *data.Year)
+	}
+
+	if data.VIN != nil {
+		if *data.VIN == "" {
+			q = q.Set("vin = NULL")
+		} else {
+			info, err := parseVIN(*data.VIN)
+			if err != nil {
+				return nil, err
+			}
+			err = checkVIN(ctx, db, t.OrganizationID, info.VIN, id)
+			if err != nil {
+				return nil, err
+			}
+
+			q = q.Set("vin = ?", info.VIN)
+			if data.Make == nil && info.Manufacturer != "" {
+				q = q.Set("make = coalesce(make, ?)", info.Manufacturer)
+			}
+			if data.Year == nil && info.ModelYear != nil {
+				q = q.Set("year = coalesce(year, ?)", *info.ModelYear)
+			}
+		}
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	if data.MileageKM != nil {
+		_, err = RecordMileage(ctx, db, t, id, nil, ReadingManual, *data.MileageKM)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// Delete deletes a vehicle. Vehicles with work orders can't be deleted (409).
+func (s *Svc) Delete(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+
+	res, err := tenant.DB(ctx, s.db).NewDelete().
+		Model((*Vehicle)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// parseVIN decodes a VIN, reporting an invalid one as a 422 on the vin field.
+func parseVIN(raw string) (vin.Info, error) {
+	info, err := vin.Parse(raw)
+	if err != nil {
+		return vin.Info{}, api.Validation("invalid VIN", api.FieldError{
+			Field:   "vin",
+			Message: err.Error(),
+		}).Wrap(err)
+	}
+	return info, nil
+}
+
+// checkVIN makes sure no other vehicle of the organization has the VIN. The unique
+// constraint backs it up against concurrent requests.
+func checkVIN(ctx context.Context, db bun.IDB, orgID uuid.UUID, v string, exceptID uuid.UUID) error {
+	taken, err := db.NewSelect().
+		Table("vehicles").
+		Where("organization_id = ?", orgID).
+		Where("vin = ?", v).
+		Where("id <> ?", exceptID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrVINTaken
+	}
+	return nil
+}
+
+// trimmed returns s without surrounding spaces, or nil when that leaves nothing.
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,160 @@
+package vin
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Region is the continent a VIN was assigned in.
+type Region string
+
+const (
+	RegionAfrica       Region = "africa"
+	RegionAsia         Region = "asia"
+	RegionEurope       Region = "europe"
+	RegionNorthAmerica Region = "north_america"
+	RegionOceania      Region = "oceania"
+	RegionSouthAmerica Region = "south_america"
+)
+
+// Length is the length of a VIN since 1981 (ISO 3779).
+const Length = 17
+
+var (
+	ErrEmpty             = errors.New("VIN is required")
+	ErrLength            = errors.New("VIN must have 17 characters")
+	ErrInvalidCharacters = errors.New("VIN may only contain digits and letters other than I, O and Q")
+	ErrCheckDigit        = errors.New("VIN check digit does not match")
+)
+
+// Info is what a VIN tells about the vehicle without looking it up anywhere.
+// Manufacturer and Country are empty when the WMI is not in the embedded table, and
+// ModelYear is nil when the 10th character is not a year code.
+type Info struct {
+	VIN             string `json:"vin"`
+	WMI             string `json:"wmi"`
+	Manufacturer    string `json:"manufacturer,omitempty"`
+	Country         string `json:"country,omitempty"`
+	Region          Region `json:"region,omitempty"`
+	ModelYear       *int   `json:"model_year,omitempty"`
+	CheckDigitValid bool   `json:"check_digit_valid"`
+}
+
+// Normalize uppercases raw and drops the spaces and dashes VINs are often written with.
+func Normalize(raw string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(raw)))
+}
+
+// Parse validates and decodes a VIN, normalizing it first.
+//
+// The 9th character is a check digit (ISO 3779 annex, weights 8 7 6 5 4 3 2 10 0 9 8 7
+// 6 5 4 3 2). It is mandatory for vehicles made for North America and China, so a
+// mismatch there is ErrCheckDigit; elsewhere makers may use the position freely and the
+// result is only reported in CheckDigitValid.
+func Parse(raw string) (Info, error) {
+	return parse(raw, time.Now())
+}
+
+func parse(raw string, now time.Time) (Info, error) {
+	v := Normalize(raw)
+	if v == "" {
+		return Info{}, ErrEmpty
+	}
+	if len(v) != Length {
+		return Info{}, ErrLength
+	}
+	for i := 0; i < Length; i++ {
+		if transliteration(v[i]) < 0 {
+			return Info{}, ErrInvalidCharacters
+		}
+	}
+
+	info := Info{
+		VIN:             v,
+		WMI:             v[:3],
+		Region:          region(v[0]),
+		CheckDigitValid: v[8] == CheckDigit(v),
+	}
+	if !info.CheckDigitValid && (info.Region == RegionNorthAmerica || v[0] == 'L') {
+		return Info{}, ErrCheckDigit
+	}
+
+	if m, ok := manufacturers[info.WMI]; ok {
+		info.Manufacturer = m.Manufacturer
+		info.Country = m.Country
+	}
+
+	if year, ok := modelYear(v, info.CheckDigitValid, now.Year()+1); ok {
+		info.ModelYear = &year
+	}
+
+	return info, nil
+}
+
+var weights = [Length]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// CheckDigit computes the check digit of a 17 character VIN of valid characters:
+// '0'-'9', or 'X' for 10.
+func CheckDigit(v string) byte {
+	sum := 0
+	for i := 0; i < Length; i++ {
+		sum += transliteration(v[i]) * weights[i]
+	}
+	if r := sum % 11; r < 10 {
+		return byte('0' + r)
+	}
+	return 'X'
+}
+
+// transliteration is the value of a VIN character, or -1 if it is not allowed.
+func transliteration(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1
+	case c >= 'J' && c <= 'N':
+		return int(c-'J') + 1
+	case c == 'P':
+		return 7
+	case c == 'R':
+		return 9
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2
+	}
+	return -1
+}
+
+// yearCodes are the model year codes of the 10th character, from 1980; they repeat
+// every 30 years.
+const yearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// modelYear decodes the 10th character. Makers that fill in the check digit follow the
+// North American rule telling the 30 year cycles apart with the 7th character, a letter
+// since 2010, unless that would put the year after maxYear (older trucks and imports
+// used letters too); otherwise the latest year not after maxYear is taken.
+func modelYear(v string, checkDigitValid bool, maxYear int) (int, bool) {
+	i := strings.IndexByte(yearCodes, v[9])
+	if i < 0 {
+		return 0, false
+	}
+	year := 1980 + i
+
+	if checkDigitValid {
+		if v[6] >= 'A' && v[6] <= 'Z' && year+30 <= maxYear {
+			year += 30
+		}
+		return year, true
+	}
+
+	for year+30 <= maxYear {
+		year += 30
+	}
+	return year, true
+}
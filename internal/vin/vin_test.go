@@ -0,0 +1,97 @@
+package vin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func TestParseModelYear(t *testing.T) {
+	tests := []struct {
+		name string
+		vin  string
+		want int // 0 when there is no year code
+	}{
+		{"North America, digit in 7th position", "1HGCM82633A004352", 2003},
+		{"check digit valid outside North America, 1993", "JH4KA7561PC008269", 1993},
+		{"check digit valid outside North America, 1995", "JH4DC4460SS000830", 1995},
+		{"check digit valid outside North America, letter in 7th position", "JH4CU2F61AC000001", 2010},
+		{"check digit valid, letter in 7th position before 2010", "1FTRW0LL15KA00001", 2005},
+		{"check digit valid in Europe, digit in 7th position", "SAJAA01A0YA000001", 2000},
+		{"check digit valid in Europe, letter in 7th position", "WBA3A5C52DF000001", 2013},
+		{"check digit unused, latest cycle", "WVWZZZ1JZ3W386752", 2003},
+		{"check digit unused, cycle capped a year ahead", "WBA3A5C50DF000001", 2013},
+		{"no year code", "VF1RFB00000000001", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parse(tt.vin, now)
+			if err != nil {
+				t.Fatalf("parse(%q): %v", tt.vin, err)
+			}
+			switch {
+			case tt.want == 0 && info.ModelYear != nil:
+				t.Fatalf("model year = %d, want none", *info.ModelYear)
+			case tt.want != 0 && (info.ModelYear == nil || *info.ModelYear != tt.want):
+				t.Fatalf("model year = %v, want %d", info.ModelYear, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDecodes(t *testing.T) {
+	info, err := parse(" 1hgcm-8263 3a004352", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.VIN != "1HGCM82633A004352" || info.WMI != "1HG" {
+		t.Fatalf("VIN, WMI = %s, %s", info.VIN, info.WMI)
+	}
+	if info.Manufacturer != "Honda" || info.Country != "US" || info.Region != RegionNorthAmerica {
+		t.Fatalf("decoded %s, %s, %s", info.Manufacturer, info.Country, info.Region)
+	}
+	if !info.CheckDigitValid {
+		t.Fatal("check digit reported invalid")
+	}
+
+	info, err = parse("WVWZZZ1JZ3W386752", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CheckDigitValid || info.Region != RegionEurope {
+		t.Fatalf("European VIN decoded as %+v", info)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		vin  string
+		err  error
+	}{
+		{"empty", " - ", ErrEmpty},
+		{"short", "1HGCM826", ErrLength},
+		{"long", "1HGCM82633A0043521", ErrLength},
+		{"letter I", "1HGCM82633A00435I", ErrInvalidCharacters},
+		{"symbol", "1HGCM82633A00435*", ErrInvalidCharacters},
+		{"North American check digit", "1HGCM82633A00435Z", ErrCheckDigit},
+		{"Chinese check digit", "LFV3A28K6B3000001", ErrCheckDigit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parse(tt.vin, now); !errors.Is(err, tt.err) {
+				t.Fatalf("parse(%q) error = %v, want %v", tt.vin, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	for _, v := range []string{"JH4KA7561PC008269", "1HGCM82633A004352", "SAJAA01A0YA000001"} {
+		if got := CheckDigit(v); got != v[8] {
+			t.Errorf("CheckDigit(%s) = %c, want %c", v, got, v[8])
+		}
+	}
+}
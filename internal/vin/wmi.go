@@ -0,0 +1,55 @@
+package vin
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// wmi.json maps world manufacturer identifiers (the first three characters of a VIN)
+// to the make they are sold as and the ISO 3166 country of the assembly plant. It
+// covers the common passenger vehicle and motorcycle makers, not every registered WMI.
+//
+//go:embed wmi.json
+var wmiJSON []byte
+
+type manufacturer struct {
+	WMI          string `json:"wmi"`
+	Manufacturer string `json:"manufacturer"`
+	Country      string `json:"country"`
+}
+
+// manufacturers is keyed by WMI.
+var manufacturers = loadManufacturers(wmiJSON)
+
+func loadManufacturers(data []byte) map[string]manufacturer {
+	var list []manufacturer
+	if err := json.Unmarshal(data, &list); err != nil {
+		panic(fmt.Sprintf("vin: invalid WMI table: %v", err))
+	}
+
+	byWMI := make(map[string]manufacturer, len(list))
+	for _, m := range list {
+		byWMI[m.WMI] = m
+	}
+	return byWMI
+}
+
+// region is the continent a VIN was assigned in, from its first character.
+func region(c byte) Region {
+	switch {
+	case c >= 'A' && c <= 'H':
+		return RegionAfrica
+	case c >= 'J' && c <= 'R':
+		return RegionAsia
+	case c >= 'S' && c <= 'Z':
+		return RegionEurope
+	case c >= '1' && c <= '5':
+		return RegionNorthAmerica
+	case c == '6' || c == '7':
+		return RegionOceania
+	case c == '8' || c == '9':
+		return RegionSouthAmerica
+	}
+	return ""
+}
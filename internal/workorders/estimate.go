@@ -0,0 +1,541 @@
+package workorders
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrEstimateNotFound = api.NotFound("estimate not found")
+	ErrEstimateExpired  = api.Forbidden("estimate link has expired")
+	ErrEstimateDecided  = api.Conflict("estimate was already answered or replaced by a newer version")
+	ErrNoItems          = api.Conflict("work order has no items to estimate")
+	ErrNotAwaiting      = api.Conflict("work order is no longer awaiting approval")
+)
+
+// EstimateStatus is the state of an estimate; only pending estimates can be answered.
+type EstimateStatus string
+
+const (
+	EstimatePending           EstimateStatus = "pending"
+	EstimateApproved          EstimateStatus = "approved"
+	EstimatePartiallyApproved EstimateStatus = "partially_approved"
+	EstimateDeclined          EstimateStatus = "declined"
+	EstimateSuperseded        EstimateStatus = "superseded"
+)
+
+// Event types recorded for estimates. Decisions are recorded as "estimate_" followed by
+// the estimate's new status.
+const (
+	EstimateSentEvent       = "estimate_sent"
+	EstimateSupersededEvent = "estimate_superseded"
+)
+
+// Estimate is a versioned snapshot of a work order's items sent to the customer for
+// approval. Sending a new version supersedes the pending one.
+type Estimate struct {
+	bun.BaseModel `bun:"table:estimates,alias:est"`
+
+	ID             uuid.UUID      `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID      `bun:"organization_id,notnull" json:"organization_id"`
+	WorkOrderID    uuid.UUID      `bun:"work_order_id,notnull" json:"work_order_id"`
+	Version        int            `bun:"version,notnull" json:"version"`
+	Status         EstimateStatus `bun:"status,notnull,default:'pending'" json:"status"`
+	Lines          []EstimateLine `bun:"lines,type:jsonb,notnull" json:"lines"`
+	SubtotalCents  int64          `bun:"subtotal_cents,notnull" json:"subtotal_cents"`
+	TaxCents       int64          `bun:"tax_cents,notnull" json:"tax_cents"`
+	TotalCents     int64          `bun:"total_cents,notnull" json:"total_cents"`
+	ExpiresAt      time.Time      `bun:"expires_at,notnull" json:"expires_at"`
+	CreatedBy      uuid.UUID      `bun:"created_by,notnull" json:"created_by"`
+	CreatedAt      time.Time      `bun:"created_at,notnull,default:now()" json:"created_at"`
+	DecidedAt      *time.Time     `bun:"decided_at" json:"decided_at,omitempty"`
+	ApproverName   *string        `bun:"approver_name" json:"approver_name,omitempty"`
+	ApproverIP     *string        `bun:"approver_ip" json:"approver_ip,omitempty"`
+
+	// URL is the public link of a pending estimate.
+	URL string `bun:"-" json:"url,omitempty"`
+}
+
+// EstimateLine is an item as estimated, and the customer's decision on it.
+type EstimateLine struct {
+	ItemID uuid.UUID `json:"item_id"`
+	InvoiceLine
+	Approved *bool `json:"approved,omitempty"`
+}
+
+// PublicEstimate is what the customer sees when opening an estimate link.
+type PublicEstimate struct {
+	*Estimate
+	Organization InvoiceOrganization `json:"organization"`
+	Customer     InvoiceCustomer     `json:"customer"`
+	Vehicle      InvoiceVehicle      `json:"vehicle"`
+	WorkOrder    InvoiceWorkOrder    `json:"work_order"`
+}
+
+// EstimateLinks signs and verifies the public links customers answer estimates with.
+// A link carries the estimate, its organization, its sender and its expiry, signed
+// with HMAC-SHA256; it needs no login and can't be altered or extended.
+type EstimateLinks struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+func NewEstimateLinks(secret, baseURL string, ttl time.Duration) EstimateLinks {
+	return EstimateLinks{
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+	}
+}
+
+type estimateClaims struct {
+	EstimateID     uuid.UUID `json:"e"`
+	OrganizationID uuid.UUID `json:"o"`
+	SenderID       uuid.UUID `json:"u"`
+	ExpiresAt      int64     `json:"x"`
+}
+
+// URL is the public link of est.
+func (l EstimateLinks) URL(est *Estimate) string {
+	payload, _ := json.Marshal(estimateClaims{
+		EstimateID:     est.ID,
+		OrganizationID: est.OrganizationID,
+		SenderID:       est.CreatedBy,
+		ExpiresAt:      est.ExpiresAt.Unix(),
+	})
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(l.sign(payload))
+	return l.baseURL + "/v1/public/estimates/" + token
+}
+
+// parse verifies a link token and returns its claims.
+func (l EstimateLinks) parse(token string, now time.Time) (estimateClaims, error) {
+	var c estimateClaims
+
+	payload64, sig64, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, ErrEstimateNotFound
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payload64)
+	if err != nil {
+		return c, ErrEstimateNotFound
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sig64)
+	if err != nil || !hmac.Equal(sig, l.sign(payload)) {
+		return c, ErrEstimateNotFound
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrEstimateNotFound
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return c, ErrEstimateExpired
+	}
+	return c, nil
+}
+
+func (l EstimateLinks) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// SendEstimate snapshots the items of a work order as its next estimate version and
+// moves the work order to awaiting_approval.
+func (s *Svc) SendEstimate(ctx context.Context, id uuid.UUID, data SendEstimate) (*Estimate, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Closed() {
+		return nil, ErrClosed
+	}
+	if wo.Status != StatusAwaitingApproval {
+		if !wo.Status.CanTransition(StatusAwaitingApproval) {
+			return nil, api.Conflict(fmt.Sprintf("work order cannot move from %s to %s", wo.Status, StatusAwaitingApproval)).
+				WithDetails(TransitionDetails{From: wo.Status, To: StatusAwaitingApproval, Allowed: AllowedTransitions(wo.Status, t.Role)})
+		}
+		perm := TransitionPermission(StatusAwaitingApproval)
+		if !t.Role.Can(perm) {
+			return nil, api.Forbidden("insufficient permissions").
+				WithDetails(map[string]any{"role": t.Role, "required_permissions": []organizations.Permission{perm}})
+		}
+	}
+
+	items := []*Item{}
+	err = db.NewSelect().
+		Model(&items).
+		Where("woi.work_order_id = ?", id).
+		OrderExpr("woi.position ASC, woi.created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	var version int
+	err = db.NewSelect().
+		Model((*Estimate)(nil)).
+		ColumnExpr("COALESCE(MAX(est.version), 0)").
+		Where("est.work_order_id = ?", id).
+		Scan(ctx, &version)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = supersedeEstimates(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.links.ttl
+	if data.ExpiresInHours != nil {
+		ttl = time.Duration(*data.ExpiresInHours) * time.Hour
+	}
+	totals := ComputeTotals(items)
+	est := Estimate{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		WorkOrderID:    id,
+		Version:        version + 1,
+		Status:         EstimatePending,
+		Lines:          make([]EstimateLine, len(items)),
+		SubtotalCents:  totals.SubtotalCents,
+		TaxCents:       totals.TaxCents,
+		TotalCents:     totals.TotalCents,
+		ExpiresAt:      time.Now().Add(ttl).Truncate(time.Second),
+		CreatedBy:      t.UserID,
+	}
+	for i, it := range items {
+		est.Lines[i] = EstimateLine{ItemID: it.ID, InvoiceLine: invoiceLine(it)}
+	}
+
+	_, err = db.NewInsert().
+		Model(&est).
+		ExcludeColumn("created_at", "decided_at", "approver_name", "approver_ip").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Estimate v%d sent for approval, %s total", est.Version, FormatCents(est.TotalCents))
+	if data.Message != nil && *data.Message != "" {
+		message = *data.Message
+	}
+	err = addEvent(ctx, db, t.OrganizationID, id, EstimateSentEvent, message, &t.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wo.Status != StatusAwaitingApproval {
+		err = changeStatus(ctx, db, t, wo, StatusAwaitingApproval, message, &t.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	est.URL = s.links.URL(&est)
+	return &est, nil
+}
+
+// Estimates lists the estimate versions of a work order, newest first.
+func (s *Svc) Estimates(ctx context.Context, id uuid.UUID) ([]*Estimate, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	exists, err := db.NewSelect().
+		Model((*WorkOrder)(nil)).
+		Where("wo.id = ?", id).
+		Where("wo.organization_id = ?", t.OrganizationID).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	ests := []*Estimate{}
+	err = db.NewSelect().
+		Model(&ests).
+		Where("est.work_order_id = ?", id).
+		Where("est.organization_id = ?", t.OrganizationID).
+		OrderExpr("est.version DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, est := range ests {
+		if est.Status == EstimatePending && now.Before(est.ExpiresAt) {
+			est.URL = s.links.URL(est)
+		}
+	}
+	return ests, nil
+}
+
+// PublicEstimate gets the estimate behind a link, for the customer.
+func (s *Svc) PublicEstimate(ctx context.Context, token string) (*PublicEstimate, error) {
+	var view *PublicEstimate
+	err := s.asSender(ctx, token, func(ctx context.Context, tx bun.Tx, t tenant.Tenant, c estimateClaims) error {
+		est, err := findEstimate(ctx, tx, c, false)
+		if err != nil {
+			return err
+		}
+
+		doc, _, err := buildInvoice(ctx, tx, t.OrganizationID, est.WorkOrderID)
+		if err != nil {
+			return err
+		}
+
+		view = &PublicEstimate{
+			Estimate:     est,
+			Organization: doc.Organization,
+			Customer:     doc.Customer,
+			Vehicle:      doc.Vehicle,
+			WorkOrder:    doc.WorkOrder,
+		}
+		return nil
+	})
+	return view, err
+}
+
+// DecideEstimate records the customer's answer to an estimate: declined items are
+// removed from the work order, the decision (approver name, IP and time) is recorded
+// as an event, and the work order goes back to in_progress, or is canceled when
+// everything was declined.
+func (s *Svc) DecideEstimate(ctx context.Context, token, ip string, data EstimateDecision) (*Estimate, error) {
+	var est *Estimate
+	err := s.asSender(ctx, token, func(ctx context.Context, tx bun.Tx, t tenant.Tenant, c estimateClaims) error {
+		// Lock the work order before the estimate, in the same order as SendEstimate.
+		found, err := findEstimate(ctx, tx, c, false)
+		if err != nil {
+			return err
+		}
+		wo, err := lockWorkOrder(ctx, tx, t.OrganizationID, found.WorkOrderID)
+		if err != nil {
+			return err
+		}
+
+		est, err = findEstimate(ctx, tx, c, true)
+		if err != nil {
+			return err
+		}
+		if est.Status != EstimatePending {
+			return ErrEstimateDecided
+		}
+		if wo.Status != StatusAwaitingApproval {
+			return ErrNotAwaiting
+		}
+
+		approved, declined, err := applyDecision(est, data)
+		if err != nil {
+			return err
+		}
+
+		if len(declined) > 0 {
+			_, err = tx.NewDelete().
+				Model((*Item)(nil)).
+				Where("id IN (?)", bun.In(declined)).
+				Where("work_order_id = ?", wo.ID).
+				Where("organization_id = ?", t.OrganizationID).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			err = reorderItems(ctx, tx, wo, uuid.Nil, nil)
+			if err != nil {
+				return err
+			}
+			err = recalcTotals(ctx, tx, wo)
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		est.Status = EstimateApproved
+		switch {
+		case approved == 0:
+			est.Status = EstimateDeclined
+		case len(declined) > 0:
+			est.Status = EstimatePartiallyApproved
+		}
+		est.DecidedAt = &now
+		est.ApproverName = &data.ApproverName
+		est.ApproverIP = &ip
+
+		_, err = tx.NewUpdate().
+			Model(est).
+			Column("status", "lines", "decided_at", "approver_name", "approver_ip").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Estimate v%d %s by %s from %s at %s: %d of %d items approved",
+			est.Version, strings.ReplaceAll(string(est.Status), "_", " "), data.ApproverName, ip,
+			now.UTC().Format(time.RFC3339), approved, len(est.Lines))
+		err = addEvent(ctx, tx, t.OrganizationID, wo.ID, "estimate_"+string(est.Status), message, nil)
+		if err != nil {
+			return err
+		}
+
+		to := StatusInProgress
+		if approved == 0 {
+			to = StatusCanceled
+		}
+		// The customer decided, not the sender whose identity the transaction runs as.
+		return changeStatus(ctx, tx, t, wo, to, message, nil)
+	})
+	return est, err
+}
+
+// applyDecision sets the approval of every line of est from data, and returns how many
+// lines were approved and the items of the declined ones.
+func applyDecision(est *Estimate, data EstimateDecision) (int, []uuid.UUID, error) {
+	var fe api.FieldErrors
+
+	decisions := map[uuid.UUID]bool{}
+	for i, d := range data.Lines {
+		decisions[d.ItemID] = d.Approved
+		found := false
+		for _, line := range est.Lines {
+			found = found || line.ItemID == d.ItemID
+		}
+		if !found {
+			fe.Add(fmt.Sprintf("lines[%d].item_id", i), "is not a line of this estimate")
+		}
+	}
+
+	approved, declined := 0, []uuid.UUID{}
+	for i := range est.Lines {
+		line := &est.Lines[i]
+		ok, decided := decisions[line.ItemID]
+		if !decided {
+			if data.Approved == nil {
+				fe.Add("lines", "no decision for item %s; list it or set approved", line.ItemID)
+				continue
+			}
+			ok = *data.Approved
+		}
+		line.Approved = &ok
+		if ok {
+			approved++
+		} else {
+			declined = append(declined, line.ItemID)
+		}
+	}
+
+	if len(fe) > 0 {
+		return 0, nil, api.Validation("request validation failed", fe...)
+	}
+	return approved, declined, nil
+}
+
+// asSender verifies an estimate link and runs fn in a transaction acting as the
+// member who sent the estimate, so row-level security applies as it did for them.
+// Links stop working when the sender leaves the organization.
+func (s *Svc) asSender(ctx context.Context, token string, fn func(context.Context, bun.Tx, tenant.Tenant, estimateClaims) error) error {
+	c, err := s.links.parse(token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return s.db.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := tenant.Configure(ctx, tx, c.SenderID, c.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		member := organizations.OrganizationMember{}
+		err = tx.NewSelect().
+			Model(&member).
+			Where("om.organization_id = ?", c.OrganizationID).
+			Where("om.user_id = ?", c.SenderID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEstimateNotFound.Wrap(err)
+		}
+		if err != nil {
+			return err
+		}
+
+		t := tenant.Tenant{OrganizationID: c.OrganizationID, UserID: c.SenderID, Role: member.Role}
+		return fn(tenant.WithTx(tenant.WithTenant(ctx, t), tx), tx, t, c)
+	})
+}
+
+func findEstimate(ctx context.Context, db bun.IDB, c estimateClaims, lock bool) (*Estimate, error) {
+	var est Estimate
+	q := db.NewSelect().
+		Model(&est).
+		Where("est.id = ?", c.EstimateID).
+		Where("est.organization_id = ?", c.OrganizationID)
+	if lock {
+		q = q.For("UPDATE")
+	}
+
+	err := q.Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEstimateNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &est, nil
+}
+
+// supersedeEstimates retires the pending estimate of a work order, so its link can no
+// longer approve lines that have since changed. It reports whether one was pending.
+func supersedeEstimates(ctx context.Context, db bun.IDB, orgID, woID uuid.UUID) (bool, error) {
+	res, err := db.NewUpdate().
+		Model((*Estimate)(nil)).
+		Set("status = ?", EstimateSuperseded).
+		Where("work_order_id = ?", woID).
+		Where("organization_id = ?", orgID).
+		Where("status = ?", EstimatePending).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// addEvent records an event on a work order; createdBy is nil for customer actions.
+func addEvent(ctx context.Context, db bun.IDB, orgID, id uuid.UUID, eventType, message string, createdBy *uuid.UUID) error {
+	event := Event{
+		OrganizationID: orgID,
+		WorkOrderID:    id,
+		EventType:      eventType,
+		Message:        &message,
+		CreatedBy:      createdBy,
+	}
+	_, err := db.NewInsert().
+		Model(&event).
+		ExcludeColumn("created_at").
+		Exec(ctx)
+	return err
+}
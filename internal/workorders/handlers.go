@@ -0,0 +1,653 @@
+package workorders
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+)
+
+type h interface {
+	Create() http.HandlerFunc
+	ByID() http.HandlerFunc
+	List() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	SetStatus() http.HandlerFunc
+	Transitions() http.HandlerFunc
+	AddItem() http.HandlerFunc
+	UpdateItem() http.HandlerFunc
+	RemoveItem() http.HandlerFunc
+	Invoice() http.HandlerFunc
+	SendEstimate() http.HandlerFunc
+	Estimates() http.HandlerFunc
+	PublicEstimate() http.HandlerFunc
+	DecideEstimate() http.HandlerFunc
+}
+
+type Hdlr struct {
+	db      *bun.DB
+	log     zerolog.Logger
+	svc     Svc
+	proxies trustedProxies
+}
+
+var _ h = (*Hdlr)(nil)
+
+func Handler(log zerolog.Logger, db *bun.DB, links EstimateLinks, proxies trustedProxies) Hdlr {
+	svc := Service(log, db, links)
+	return Hdlr{db, log, svc, proxies}
+}
+
+// CreateWorkOrder is the body of POST /work-orders. Items are optional; MileageKM is
+// the odometer at check-in.
+type CreateWorkOrder struct {
+	CustomerID  uuid.UUID    `json:"customer_id" validate:"required"`
+	VehicleID   uuid.UUID    `json:"vehicle_id" validate:"required"`
+	ProjectID   *uuid.UUID   `json:"project_id,omitempty"`
+	Priority    Priority     `json:"priority,omitempty"`
+	Title       string       `json:"title" validate:"required,max=200"`
+	Description *string      `json:"description,omitempty" validate:"max=5000"`
+	ScheduledAt *time.Time   `json:"scheduled_at,omitempty"`
+	Items       []CreateItem `json:"items,omitempty" validate:"max=200"`
+	MileageKM   *int         `json:"mileage_km,omitempty" validate:"min=0,max=5000000"`
+}
+
+// CreateItem is a line item of a new work order. Qty defaults to 1.
+type CreateItem struct {
+	ItemType       LineItemType     `json:"item_type" validate:"required"`
+	SKU            *string          `json:"sku,omitempty" validate:"max=64"`
+	Name           string           `json:"name" validate:"required,max=200"`
+	Qty            *decimal.Decimal `json:"qty,omitempty"`
+	UnitPriceCents int64            `json:"unit_price_cents" validate:"min=0"`
+	TaxRatePct     decimal.Decimal  `json:"tax_rate_pct"`
+}
+
+func (it CreateItem) Validate() error {
+	var fe api.FieldErrors
+	if it.Qty != nil {
+		validateQty(&fe, *it.Qty)
+	}
+	validateTaxRate(&fe, it.TaxRatePct)
+	return fe.Err()
+}
+
+// validateQty checks a quantity fits the NUMERIC(12, 2) qty column.
+func validateQty(fe *api.FieldErrors, qty decimal.Decimal) {
+	switch {
+	case !qty.IsPositive():
+		fe.Add("qty", "must be greater than 0")
+	case !qty.Equal(qty.Truncate(2)):
+		fe.Add("qty", "must have at most 2 decimal places")
+	case qty.GreaterThanOrEqual(decimal.New(1, 10)):
+		fe.Add("qty", "is too large")
+	}
+}
+
+// validateTaxRate checks a tax rate is a percentage fitting the NUMERIC(5, 2)
+// tax_rate_pct column, such as 8.25.
+func validateTaxRate(fe *api.FieldErrors, rate decimal.Decimal) {
+	switch {
+	case rate.IsNegative() || rate.GreaterThan(hundred):
+		fe.Add("tax_rate_pct", "must be between 0 and 100")
+	case !rate.Equal(rate.Truncate(2)):
+		fe.Add("tax_rate_pct", "must have at most 2 decimal places")
+	}
+}
+
+// maxItems is the most items a work order may have.
+const maxItems = 200
+
+// AddItem is the body of POST /work-orders/{id}/items. The item goes last unless
+// Position is set.
+type AddItem struct {
+	CreateItem
+	Position *int `json:"position,omitempty" validate:"min=0"`
+}
+
+// UpdateItem holds the fields PATCH /work-orders/{id}/items/{itemID} may change; nil
+// fields are left untouched and an empty SKU clears it. Setting Position moves the
+// item, shifting the others.
+type UpdateItem struct {
+	ItemType       *LineItemType    `json:"item_type,omitempty"`
+	SKU            *string          `json:"sku,omitempty" validate:"max=64"`
+	Name           *string          `json:"name,omitempty" validate:"min=1,max=200"`
+	Qty            *decimal.Decimal `json:"qty,omitempty"`
+	UnitPriceCents *int64           `json:"unit_price_cents,omitempty" validate:"min=0"`
+	TaxRatePct     *decimal.Decimal `json:"tax_rate_pct,omitempty"`
+	Position       *int             `json:"position,omitempty" validate:"min=0"`
+}
+
+func (it UpdateItem) Validate() error {
+	var fe api.FieldErrors
+	if it.Qty != nil {
+		validateQty(&fe, *it.Qty)
+	}
+	if it.TaxRatePct != nil {
+		validateTaxRate(&fe, *it.TaxRatePct)
+	}
+	return fe.Err()
+}
+
+// UpdateWorkOrder holds the fields PATCH /work-orders/{id} may change; nil fields are
+// left untouched and an empty description clears it.
+type UpdateWorkOrder struct {
+	Title       *string    `json:"title,omitempty" validate:"min=1,max=200"`
+	Description *string    `json:"description,omitempty" validate:"max=5000"`
+	Priority    *Priority  `json:"priority,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+}
+
+// ChangeStatus is the body of PATCH /work-orders/{id}/status. When FromStatus is set the
+// change only applies if the work order is still in that status (412 otherwise).
+// MileageKM is the odometer reading taken with the change: a check-out when moving to
+// ready_for_pickup, ready_for_deliver or completed, a check-in otherwise.
+type ChangeStatus struct {
+	Status     Status  `json:"status" validate:"required"`
+	FromStatus *Status `json:"from_status,omitempty"`
+	Message    *string `json:"message,omitempty" validate:"max=1000"`
+	MileageKM  *int    `json:"mileage_km,omitempty" validate:"min=0,max=5000000"`
+}
+
+// SendEstimate is the body of POST /work-orders/{id}/estimates. The link expires after
+// ExpiresInHours, or ESTIMATE_LINK_TTL by default.
+type SendEstimate struct {
+	ExpiresInHours *int    `json:"expires_in_hours,omitempty" validate:"min=1,max=720"`
+	Message        *string `json:"message,omitempty" validate:"max=1000"`
+}
+
+// EstimateDecision is the customer's answer to an estimate. Every line needs a decision,
+// either listed in Lines or given by Approved for all the lines not listed.
+type EstimateDecision struct {
+	ApproverName string         `json:"approver_name" validate:"required,max=200"`
+	Approved     *bool          `json:"approved,omitempty"`
+	Lines        []LineDecision `json:"lines,omitempty" validate:"max=200"`
+}
+
+type LineDecision struct {
+	ItemID   uuid.UUID `json:"item_id" validate:"required"`
+	Approved bool      `json:"approved"`
+}
+
+// Transitions is the status of a work order and the statuses the caller may move it to.
+type Transitions struct {
+	From Status   `json:"from"`
+	To   []Status `json:"to"`
+}
+
+// Create opens a work order, optionally with its items.
+func (h *Hdlr) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[CreateWorkOrder](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wo, err := h.svc.Create(r.Context(), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error creating work order")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusCreated, wo)
+	}
+}
+
+// ByID gets a work order with its items and events.
+func (h *Hdlr) ByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		wo, err := h.svc.ByID(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting work order")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusOK, wo)
+	}
+}
+
+// List lists the organization's work orders, see ListSpec.
+func (h *Hdlr) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := api.ParseList(r, ListSpec)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wos, page, err := h.svc.List(r.Context(), params)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing work orders")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.SuccessPage[*WorkOrder](w, http.StatusOK, wos, page)
+	}
+}
+
+// Update changes the title, description, priority or schedule of a work order.
+func (h *Hdlr) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateWorkOrder](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wo, err := h.svc.Update(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating work order")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusOK, wo)
+	}
+}
+
+// Delete deletes a draft work order.
+func (h *Hdlr) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		err := h.svc.Delete(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deleting work order")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetStatus moves a work order to another status.
+func (h *Hdlr) SetStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[ChangeStatus](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wo, err := h.svc.SetStatus(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error changing work order status")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusOK, wo)
+	}
+}
+
+// Transitions lists the statuses the caller may move a work order to.
+func (h *Hdlr) Transitions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		transitions, err := h.svc.Transitions(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing work order transitions")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Transitions](w, http.StatusOK, transitions)
+	}
+}
+
+// AddItem adds a line item to a work order and returns the work order with its
+// recomputed totals.
+func (h *Hdlr) AddItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[AddItem](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wo, err := h.svc.AddItem(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error adding work order item")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusCreated, wo)
+	}
+}
+
+// UpdateItem changes or moves a line item and returns the work order with its
+// recomputed totals.
+func (h *Hdlr) UpdateItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+		itemID, ok := workOrderItemID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[UpdateItem](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		wo, err := h.svc.UpdateItem(r.Context(), id, itemID, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error updating work order item")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusOK, wo)
+	}
+}
+
+// RemoveItem deletes a line item and returns the work order with its recomputed
+// totals.
+func (h *Hdlr) RemoveItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+		itemID, ok := workOrderItemID(w, r)
+		if !ok {
+			return
+		}
+
+		wo, err := h.svc.RemoveItem(r.Context(), id, itemID)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error removing work order item")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*WorkOrder](w, http.StatusOK, wo)
+	}
+}
+
+// Invoice renders the invoice of a work order as JSON, HTML or PDF, chosen by the
+// format query parameter (json, html, pdf) or else the Accept header.
+func (h *Hdlr) Invoice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		format, ok := invoiceFormat(r)
+		if !ok {
+			api.WriteError(w, api.BadRequest("format must be one of json, html, pdf"))
+			return
+		}
+
+		doc, err := h.svc.Invoice(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting work order invoice")
+			api.WriteError(w, err)
+			return
+		}
+
+		if format == "json" {
+			api.Success[*InvoiceDocument](w, http.StatusOK, doc)
+			return
+		}
+
+		// Render fully before writing so a failure still gets a JSON error.
+		var buf bytes.Buffer
+		contentType := "text/html; charset=utf-8"
+		if format == "pdf" {
+			contentType = "application/pdf"
+			err = doc.RenderPDF(&buf)
+		} else {
+			err = doc.RenderHTML(&buf)
+		}
+		if err != nil {
+			h.log.Error().Err(err).Msg("error rendering work order invoice")
+			api.WriteError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if format == "pdf" {
+			name := "invoice-draft-" + id.String()
+			if !doc.Draft {
+				name = "invoice-" + doc.Number
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name+".pdf"))
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// SendEstimate sends the work order's items to the customer for approval and returns
+// the estimate with its public link.
+func (h *Hdlr) SendEstimate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := api.Decode[SendEstimate](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		est, err := h.svc.SendEstimate(r.Context(), id, data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error sending estimate")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Estimate](w, http.StatusCreated, est)
+	}
+}
+
+// Estimates lists the estimate versions of a work order.
+func (h *Hdlr) Estimates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := workOrderID(w, r)
+		if !ok {
+			return
+		}
+
+		ests, err := h.svc.Estimates(r.Context(), id)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error listing estimates")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[[]*Estimate](w, http.StatusOK, ests)
+	}
+}
+
+// PublicEstimate shows an estimate to the customer holding its link.
+func (h *Hdlr) PublicEstimate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		est, err := h.svc.PublicEstimate(r.Context(), mux.Vars(r)["token"])
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error getting public estimate")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*PublicEstimate](w, http.StatusOK, est)
+	}
+}
+
+// DecideEstimate records the customer's approval or refusal of the estimate lines.
+func (h *Hdlr) DecideEstimate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := api.Decode[EstimateDecision](w, r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		est, err := h.svc.DecideEstimate(r.Context(), mux.Vars(r)["token"], h.proxies.clientIP(r), data)
+		if err != nil {
+			h.log.Debug().Err(err).Msg("error deciding estimate")
+			api.WriteError(w, err)
+			return
+		}
+
+		api.Success[*Estimate](w, http.StatusOK, est)
+	}
+}
+
+// trustedProxies are the networks of the reverse proxies in front of the API, whose
+// X-Forwarded-For header is believed.
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies reads TRUSTED_PROXIES entries, either addresses or CIDR ranges.
+func parseTrustedProxies(entries []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(e); err == nil {
+			proxies = append(proxies, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is neither an address nor a CIDR range", e)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return proxies, nil
+}
+
+func (p trustedProxies) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address of the client. X-Forwarded-For is only read when the peer is
+// a trusted proxy, and then from the right: the first hop no trusted proxy added is the
+// client, since everything left of it can be forged.
+func (p trustedProxies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.trusts(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		ip = hop
+		if !p.trusts(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func invoiceFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json", "html", "pdf":
+		return format, true
+	case "":
+	default:
+		return "", false
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/pdf"):
+		return "pdf", true
+	case strings.Contains(accept, "text/html"):
+		return "html", true
+	}
+	return "json", true
+}
+
+func workOrderID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid work order id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func workOrderItemID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["itemID"])
+	if err != nil {
+		api.WriteError(w, api.BadRequest("invalid item id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
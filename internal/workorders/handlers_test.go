@@ -0,0 +1,49 @@
+package workorders
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.7 ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		proxies  trustedProxies
+		peer     string
+		forwards []string
+		want     string
+	}{
+		{"direct", proxies, "203.0.113.5:4242", nil, "203.0.113.5"},
+		{"forged header from an untrusted peer", proxies, "203.0.113.5:4242", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"no proxies configured", nil, "10.1.2.3:4242", []string{"198.51.100.1"}, "10.1.2.3"},
+		{"one trusted proxy", proxies, "10.1.2.3:4242", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged hop left of the client", proxies, "10.1.2.3:4242", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", proxies, "10.1.2.3:4242", []string{"198.51.100.1, 192.0.2.7", "10.9.9.9"}, "198.51.100.1"},
+		{"trusted proxy without header", proxies, "192.0.2.7:4242", nil, "192.0.2.7"},
+		{"garbage hop", proxies, "10.1.2.3:4242", []string{"198.51.100.1, not-an-ip"}, "10.1.2.3"},
+		{"IPv6 peer", proxies, "[2001:db8::1]:4242", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.RemoteAddr = tt.peer
+			for _, f := range tt.forwards {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if got := tt.proxies.clientIP(r); got != tt.want {
+				t.Fatalf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/8", "proxy.internal"}); err == nil {
+		t.Fatal("parseTrustedProxies accepted a host name")
+	}
+}
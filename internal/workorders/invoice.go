@@ -0,0 +1,279 @@
+package workorders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/customers"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+	"github.com/brxyxn/engine-care-api/internal/vehicles"
+)
+
+var ErrNoInvoice = api.Conflict("canceled work orders have no invoice")
+
+// Invoice is the invoice issued when a work order was completed. Its number is
+// sequential per organization and the row is never updated (see the invoices
+// migration).
+type Invoice struct {
+	bun.BaseModel `bun:"table:invoices,alias:inv"`
+
+	ID             uuid.UUID       `bun:"id,pk,default:gen_random_uuid()" json:"id"`
+	OrganizationID uuid.UUID       `bun:"organization_id,notnull" json:"organization_id"`
+	WorkOrderID    uuid.UUID       `bun:"work_order_id,notnull" json:"work_order_id"`
+	Number         int64           `bun:"number,notnull" json:"number"`
+	IssuedAt       time.Time       `bun:"issued_at,notnull,default:now()" json:"issued_at"`
+	SubtotalCents  int64           `bun:"subtotal_cents,notnull" json:"subtotal_cents"`
+	TaxCents       int64           `bun:"tax_cents,notnull" json:"tax_cents"`
+	TotalCents     int64           `bun:"total_cents,notnull" json:"total_cents"`
+	Document       InvoiceDocument `bun:"document,type:jsonb,notnull" json:"document"`
+	CreatedBy      *uuid.UUID      `bun:"created_by" json:"created_by,omitempty"`
+}
+
+// invoiceCounter is the last invoice number used by an organization.
+type invoiceCounter struct {
+	bun.BaseModel `bun:"table:invoice_counters,alias:ic"`
+
+	OrganizationID uuid.UUID `bun:"organization_id,pk"`
+	LastNumber     int64     `bun:"last_number,notnull"`
+}
+
+// InvoiceDocument is what an invoice shows. Issued invoices keep the document as it was
+// when issued; open work orders get a draft built from their current state.
+type InvoiceDocument struct {
+	Number       string              `json:"number,omitempty"`
+	Draft        bool                `json:"draft"`
+	IssuedAt     *time.Time          `json:"issued_at,omitempty"`
+	Organization InvoiceOrganization `json:"organization"`
+	Customer     InvoiceCustomer     `json:"customer"`
+	Vehicle      InvoiceVehicle      `json:"vehicle"`
+	WorkOrder    InvoiceWorkOrder    `json:"work_order"`
+	Lines        []InvoiceLine       `json:"lines"`
+	Totals
+}
+
+type InvoiceOrganization struct {
+	ID       uuid.UUID              `json:"id"`
+	Name     string                 `json:"name"`
+	Branding organizations.Branding `json:"branding"`
+}
+
+type InvoiceCustomer struct {
+	ID       uuid.UUID `json:"id"`
+	FullName string    `json:"full_name"`
+	Email    *string   `json:"email,omitempty"`
+}
+
+type InvoiceVehicle struct {
+	ID          uuid.UUID `json:"id"`
+	VIN         *string   `json:"vin,omitempty"`
+	PlateNumber *string   `json:"plate_number,omitempty"`
+	Make        *string   `json:"make,omitempty"`
+	Model       *string   `json:"model,omitempty"`
+	Year        *int      `json:"year,omitempty"`
+	MileageKM   *int      `json:"mileage_km,omitempty"`
+}
+
+type InvoiceWorkOrder struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	OpenedAt    time.Time  `json:"opened_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+type InvoiceLine struct {
+	ItemType       LineItemType    `json:"item_type"`
+	SKU            *string         `json:"sku,omitempty"`
+	Name           string          `json:"name"`
+	Qty            decimal.Decimal `json:"qty"`
+	UnitPriceCents int64           `json:"unit_price_cents"`
+	TaxRatePct     decimal.Decimal `json:"tax_rate_pct"`
+	SubtotalCents  int64           `json:"subtotal_cents"`
+	TaxCents       int64           `json:"tax_cents"`
+	TotalCents     int64           `json:"total_cents"`
+}
+
+// Invoice gets the invoice of a work order: the issued one once completed, otherwise a
+// draft of what it would be now.
+func (s *Svc) Invoice(ctx context.Context, id uuid.UUID) (*InvoiceDocument, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	var inv Invoice
+	err := db.NewSelect().
+		Model(&inv).
+		Column("document").
+		Where("inv.work_order_id = ?", id).
+		Where("inv.organization_id = ?", t.OrganizationID).
+		Scan(ctx)
+	if err == nil {
+		return &inv.Document, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	doc, wo, err := buildInvoice(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Status == StatusCanceled {
+		return nil, ErrNoInvoice
+	}
+	return doc, nil
+}
+
+// issueInvoice takes the organization's next invoice number and stores the invoice of a
+// work order that was just completed, in the same transaction.
+func issueInvoice(ctx context.Context, db bun.IDB, t tenant.Tenant, id uuid.UUID) error {
+	doc, _, err := buildInvoice(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return err
+	}
+
+	counter := invoiceCounter{OrganizationID: t.OrganizationID, LastNumber: 1}
+	err = db.NewInsert().
+		Model(&counter).
+		On("CONFLICT (organization_id) DO UPDATE").
+		Set("last_number = ic.last_number + 1").
+		Returning("last_number").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	number := counter.LastNumber
+
+	now := time.Now()
+	doc.Number = FormatInvoiceNumber(number)
+	doc.Draft = false
+	doc.IssuedAt = &now
+
+	inv := Invoice{
+		OrganizationID: t.OrganizationID,
+		WorkOrderID:    id,
+		Number:         number,
+		IssuedAt:       now,
+		SubtotalCents:  doc.SubtotalCents,
+		TaxCents:       doc.TaxCents,
+		TotalCents:     doc.TotalCents,
+		Document:       *doc,
+		CreatedBy:      &t.UserID,
+	}
+	_, err = db.NewInsert().
+		Model(&inv).
+		ExcludeColumn("id").
+		Exec(ctx)
+	return err
+}
+
+// FormatInvoiceNumber is how invoice numbers are printed.
+func FormatInvoiceNumber(n int64) string {
+	return fmt.Sprintf("%06d", n)
+}
+
+// buildInvoice assembles the invoice document of a work order from the current rows.
+// Totals come from the totals engine, so they match the lines exactly.
+func buildInvoice(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) (*InvoiceDocument, *WorkOrder, error) {
+	var wo WorkOrder
+	err := db.NewSelect().
+		Model(&wo).
+		Where("wo.id = ?", id).
+		Where("wo.organization_id = ?", orgID).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.OrderExpr("woi.position ASC, woi.created_at ASC")
+		}).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var org organizations.Organization
+	err = db.NewSelect().
+		Model(&org).
+		Where("org.id = ?", orgID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var customer customers.Customer
+	err = db.NewSelect().
+		Model(&customer).
+		Where("c.id = ?", wo.CustomerID).
+		Where("c.organization_id = ?", orgID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vehicle vehicles.Vehicle
+	err = db.NewSelect().
+		Model(&vehicle).
+		Where("v.id = ?", wo.VehicleID).
+		Where("v.organization_id = ?", orgID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := InvoiceDocument{
+		Draft: true,
+		Organization: InvoiceOrganization{
+			ID:       org.ID,
+			Name:     org.Name,
+			Branding: org.Branding,
+		},
+		Customer: InvoiceCustomer{
+			ID:       customer.ID,
+			FullName: customer.FullName,
+			Email:    customer.Email,
+		},
+		Vehicle: InvoiceVehicle{
+			ID:          vehicle.ID,
+			VIN:         vehicle.VIN,
+			PlateNumber: vehicle.PlateNumber,
+			Make:        vehicle.Make,
+			Model:       vehicle.Model,
+			Year:        vehicle.Year,
+			MileageKM:   vehicle.MileageKM,
+		},
+		WorkOrder: InvoiceWorkOrder{
+			ID:          wo.ID,
+			Title:       wo.Title,
+			OpenedAt:    wo.OpenedAt,
+			CompletedAt: wo.CompletedAt,
+		},
+		Lines:  make([]InvoiceLine, len(wo.Items)),
+		Totals: ComputeTotals(wo.Items),
+	}
+	for i, it := range wo.Items {
+		doc.Lines[i] = invoiceLine(it)
+	}
+
+	return &doc, &wo, nil
+}
+
+func invoiceLine(it *Item) InvoiceLine {
+	return InvoiceLine{
+		ItemType:       it.ItemType,
+		SKU:            it.SKU,
+		Name:           it.Name,
+		Qty:            it.Qty,
+		UnitPriceCents: it.UnitPriceCents,
+		TaxRatePct:     it.TaxRatePct,
+		SubtotalCents:  it.SubtotalCents,
+		TaxCents:       it.TaxCents,
+		TotalCents:     it.TotalCents,
+	}
+}
@@ -0,0 +1,262 @@
+package workorders
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/pdf"
+)
+
+const defaultAccent = "#1f2937"
+
+//go:embed invoice.gohtml
+var invoiceHTML string
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":   FormatCents,
+	"date":    formatDate,
+	"orgName": orgName,
+	"vehicle": vehicleName,
+	"accent": func(b organizations.Branding) template.CSS {
+		return template.CSS(accent(b))
+	},
+}).Parse(invoiceHTML))
+
+// RenderHTML writes the invoice as a standalone HTML page, branded with the
+// organization's logo, accent color and footer.
+func (doc *InvoiceDocument) RenderHTML(w io.Writer) error {
+	return invoiceTemplate.Execute(w, doc)
+}
+
+// RenderPDF writes the invoice as an A4 PDF with the same content as RenderHTML.
+func (doc *InvoiceDocument) RenderPDF(w io.Writer) error {
+	const (
+		margin = 50.0
+		right  = pdf.A4Width - margin
+		bottom = pdf.A4Height - 70
+		// Right edges of the numeric columns; the description fills the rest.
+		colQty   = 330.0
+		colPrice = 410.0
+		colTax   = 460.0
+		colTotal = right
+	)
+	var (
+		gray  = pdf.Color{R: 0.4, G: 0.4, B: 0.4}
+		rule  = pdf.Color{R: 0.85, G: 0.85, B: 0.85}
+		brand = pdf.ParseHex(accent(doc.Organization.Branding), pdf.Black)
+		b     = doc.Organization.Branding
+	)
+
+	title := "Draft invoice"
+	if !doc.Draft {
+		title = "Invoice " + doc.Number
+	}
+
+	d := pdf.New(pdf.A4Width, pdf.A4Height)
+	d.SetTitle(title + " - " + orgName(doc.Organization))
+	p := d.AddPage()
+
+	// Header: organization on the left, invoice number and dates on the right.
+	y := margin + 18
+	p.Text(margin, y, pdf.HelveticaBold, 16, pdf.Black, orgName(doc.Organization))
+	p.TextRight(right, y, pdf.HelveticaBold, 22, brand, "INVOICE")
+
+	left := []string{}
+	for _, line := range strings.Split(b.Address, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			left = append(left, line)
+		}
+	}
+	if b.TaxID != "" {
+		left = append(left, "Tax ID: "+b.TaxID)
+	}
+	for _, s := range []string{b.Email, b.Phone, b.Website} {
+		if s != "" {
+			left = append(left, s)
+		}
+	}
+
+	meta := []string{}
+	if doc.Draft {
+		meta = append(meta, "DRAFT - not issued")
+	} else {
+		meta = append(meta, "No. "+doc.Number)
+	}
+	if doc.IssuedAt != nil {
+		meta = append(meta, "Issued "+formatDate(*doc.IssuedAt))
+	}
+	meta = append(meta, "Work order opened "+formatDate(doc.WorkOrder.OpenedAt))
+
+	for i := 0; i < max(len(left), len(meta)); i++ {
+		y += 14
+		if i < len(left) {
+			p.Text(margin, y, pdf.Helvetica, 9, gray, left[i])
+		}
+		if i < len(meta) {
+			p.TextRight(right, y, pdf.Helvetica, 10, pdf.Black, meta[i])
+		}
+	}
+	y += 12
+	p.Line(margin, y, right, y, 2, brand)
+
+	// Parties.
+	y += 24
+	columns := []struct {
+		heading string
+		lines   []string
+	}{
+		{"BILL TO", append([]string{doc.Customer.FullName}, deref(doc.Customer.Email)...)},
+		{"VEHICLE", vehicleLines(doc.Vehicle)},
+		{"WORK ORDER", []string{doc.WorkOrder.Title}},
+	}
+	width := (right - margin) / float64(len(columns))
+	height := 0.0
+	for i, c := range columns {
+		x := margin + float64(i)*width
+		p.Text(x, y, pdf.HelveticaBold, 9, brand, c.heading)
+		for j, line := range c.lines {
+			p.Text(x, y+16+float64(j)*13, pdf.Helvetica, 10, pdf.Black, pdf.Truncate(pdf.Helvetica, 10, width-12, line))
+		}
+		height = max(height, 16+float64(len(c.lines))*13)
+	}
+	y += height + 20
+
+	// Lines, repeating the table header on each page.
+	tableHeader := func() {
+		p.Text(margin, y, pdf.HelveticaBold, 9, pdf.Black, "DESCRIPTION")
+		p.TextRight(colQty, y, pdf.HelveticaBold, 9, pdf.Black, "QTY")
+		p.TextRight(colPrice, y, pdf.HelveticaBold, 9, pdf.Black, "UNIT PRICE")
+		p.TextRight(colTax, y, pdf.HelveticaBold, 9, pdf.Black, "TAX")
+		p.TextRight(colTotal, y, pdf.HelveticaBold, 9, pdf.Black, "AMOUNT")
+		y += 6
+		p.Line(margin, y, right, y, 1.5, brand)
+		y += 16
+	}
+	tableHeader()
+
+	if len(doc.Lines) == 0 {
+		p.Text(margin, y, pdf.Helvetica, 10, gray, "No items.")
+		y += 20
+	}
+	for _, line := range doc.Lines {
+		if y > bottom {
+			p = d.AddPage()
+			y = margin + 10
+			tableHeader()
+		}
+		name := line.Name
+		if line.SKU != nil && *line.SKU != "" {
+			name += " (" + *line.SKU + ")"
+		}
+		p.Text(margin, y, pdf.Helvetica, 10, pdf.Black, pdf.Truncate(pdf.Helvetica, 10, colQty-margin-50, name))
+		p.TextRight(colQty, y, pdf.Helvetica, 10, pdf.Black, line.Qty.String())
+		p.TextRight(colPrice, y, pdf.Helvetica, 10, pdf.Black, FormatCents(line.UnitPriceCents))
+		p.TextRight(colTax, y, pdf.Helvetica, 10, pdf.Black, line.TaxRatePct.String()+"%")
+		p.TextRight(colTotal, y, pdf.Helvetica, 10, pdf.Black, FormatCents(line.SubtotalCents))
+		y += 6
+		p.Line(margin, y, right, y, 0.5, rule)
+		y += 14
+	}
+
+	// Totals.
+	if y > bottom-60 {
+		p = d.AddPage()
+		y = margin + 10
+	}
+	y += 8
+	total := FormatCents(doc.TotalCents)
+	if b.Currency != "" {
+		total = b.Currency + " " + total
+	}
+	p.Text(colPrice-60, y, pdf.Helvetica, 10, pdf.Black, "Subtotal")
+	p.TextRight(right, y, pdf.Helvetica, 10, pdf.Black, FormatCents(doc.SubtotalCents))
+	y += 16
+	p.Text(colPrice-60, y, pdf.Helvetica, 10, pdf.Black, "Tax")
+	p.TextRight(right, y, pdf.Helvetica, 10, pdf.Black, FormatCents(doc.TaxCents))
+	y += 8
+	p.Line(colPrice-60, y, right, y, 1.5, brand)
+	y += 16
+	p.Text(colPrice-60, y, pdf.HelveticaBold, 12, pdf.Black, "Total")
+	p.TextRight(right, y, pdf.HelveticaBold, 12, pdf.Black, total)
+
+	if b.InvoiceFooter != "" {
+		fy := pdf.A4Height - margin
+		lines := strings.Split(b.InvoiceFooter, "\n")
+		for i := len(lines) - 1; i >= 0; i-- {
+			p.Text(margin, fy, pdf.Helvetica, 8, gray, strings.TrimSpace(lines[i]))
+			fy -= 11
+		}
+	}
+
+	return d.Write(w)
+}
+
+// FormatCents formats an amount in cents as 1,234.56.
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	units := strconv.FormatInt(cents/100, 10)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + "," + units[i:]
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, units, cents%100)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
+
+func orgName(org InvoiceOrganization) string {
+	if org.Branding.LegalName != "" {
+		return org.Branding.LegalName
+	}
+	return org.Name
+}
+
+func accent(b organizations.Branding) string {
+	return b.Accent(defaultAccent)
+}
+
+// vehicleName is "2019 Toyota Corolla", with whatever parts are known.
+func vehicleName(v InvoiceVehicle) string {
+	parts := []string{}
+	if v.Year != nil {
+		parts = append(parts, strconv.Itoa(*v.Year))
+	}
+	parts = append(parts, deref(v.Make)...)
+	parts = append(parts, deref(v.Model)...)
+	return strings.Join(parts, " ")
+}
+
+func vehicleLines(v InvoiceVehicle) []string {
+	lines := []string{}
+	if name := vehicleName(v); name != "" {
+		lines = append(lines, name)
+	}
+	if v.PlateNumber != nil {
+		lines = append(lines, "Plate: "+*v.PlateNumber)
+	}
+	if v.VIN != nil {
+		lines = append(lines, "VIN: "+*v.VIN)
+	}
+	if v.MileageKM != nil {
+		lines = append(lines, fmt.Sprintf("Mileage: %d km", *v.MileageKM))
+	}
+	return lines
+}
+
+// deref returns the value of s as a one-element slice, or nothing when unset or empty.
+func deref(s *string) []string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return []string{*s}
+}
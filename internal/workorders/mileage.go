@@ -0,0 +1,54 @@
+package workorders
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+	"github.com/brxyxn/engine-care-api/internal/vehicles"
+)
+
+// MileageRecordedEvent is the event type recorded for every odometer reading taken
+// with a work order.
+const MileageRecordedEvent = "mileage_recorded"
+
+// readingSource is the kind of odometer reading taken when a work order moves to
+// status: a check-out once the work is done, a check-in otherwise.
+func readingSource(status Status) vehicles.ReadingSource {
+	switch status {
+	case StatusReadyForPickup, StatusReadyForDeliver, StatusCompleted:
+		return vehicles.ReadingCheckOut
+	}
+	return vehicles.ReadingCheckIn
+}
+
+// recordMileage logs an odometer reading of the work order's vehicle taken as it moves
+// to status (see vehicles.RecordMileage) and a mileage_recorded event saying whether it
+// was flagged.
+func recordMileage(ctx context.Context, db bun.IDB, t tenant.Tenant, wo *WorkOrder, status Status, km int) error {
+	source := readingSource(status)
+	reading, err := vehicles.RecordMileage(ctx, db, t, wo.VehicleID, &wo.ID, source, km)
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Odometer at %s: %d km", source, km)
+	if reading.Decreased {
+		message += fmt.Sprintf(" (lower than the previous %d km)", *reading.PreviousKM)
+	}
+
+	event := Event{
+		OrganizationID: t.OrganizationID,
+		WorkOrderID:    wo.ID,
+		EventType:      MileageRecordedEvent,
+		Message:        &message,
+		CreatedBy:      &t.UserID,
+	}
+	_, err = db.NewInsert().
+		Model(&event).
+		ExcludeColumn("created_at").
+		Exec(ctx)
+	return err
+}
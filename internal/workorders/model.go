@@ -14,6 +14,7 @@ type Status string
 const (
 	StatusDraft            Status = "draft"
 	StatusNew              Status = "new"
+	StatusChecking         Status = "checking"
 	StatusScheduled        Status = "scheduled"
 	StatusAwaitingCustomer Status = "awaiting_customer"
 	StatusInProgress       Status = "in_progress"
@@ -26,6 +27,17 @@ const (
 	StatusCanceled         Status = "canceled"
 )
 
+// Valid reports whether s is a known status (the work_order_status enum).
+func (s Status) Valid() bool {
+	switch s {
+	case StatusDraft, StatusNew, StatusChecking, StatusScheduled, StatusAwaitingCustomer, StatusInProgress,
+		StatusWaitingParts, StatusAwaitingApproval, StatusReadyForPickup, StatusReadyForDeliver, StatusEnRoute,
+		StatusCompleted, StatusCanceled:
+		return true
+	}
+	return false
+}
+
 // Priority represents the work order status
 type Priority string
 
@@ -36,6 +48,15 @@ const (
 	PriorityUrgent Priority = "urgent"
 )
 
+// Valid reports whether p is a known priority.
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
 type LineItemType string
 
 const (
@@ -45,6 +66,15 @@ const (
 	LineItemTypeOther LineItemType = "other"
 )
 
+// Valid reports whether t is a known line item type.
+func (t LineItemType) Valid() bool {
+	switch t {
+	case LineItemTypeLabor, LineItemTypePart, LineItemTypeFee, LineItemTypeOther:
+		return true
+	}
+	return false
+}
+
 type WorkOrder struct {
 	bun.BaseModel `bun:"table:work_orders,alias:wo"`
 
@@ -74,6 +104,14 @@ type WorkOrder struct {
 	SubtotalCents int64 `bun:"subtotal_cents,notnull,default:0" json:"subtotal_cents"`
 	TaxCents      int64 `bun:"tax_cents,notnull,default:0" json:"tax_cents"`
 	TotalCents    int64 `bun:"total_cents,notnull,default:0" json:"total_cents"`
+
+	Items  []*Item  `bun:"rel:has-many,join:id=work_order_id" json:"items,omitempty"`
+	Events []*Event `bun:"rel:has-many,join:id=work_order_id" json:"events,omitempty"`
+}
+
+// Closed reports whether the work order reached a final status.
+func (wo *WorkOrder) Closed() bool {
+	return wo.Status == StatusCompleted || wo.Status == StatusCanceled
 }
 
 type Item struct {
@@ -87,10 +125,15 @@ type Item struct {
 	Name           string          `bun:"name,notnull" json:"name"`
 	Qty            decimal.Decimal `bun:"qty,type:decimal(12,2),notnull,default:1" json:"qty"`
 	UnitPriceCents int64           `bun:"unit_price_cents,notnull,default:0" json:"unit_price_cents"`
-	TaxRatePct     int             `bun:"tax_rate_pct,notnull,default:0" json:"tax_rate_pct"`
+	TaxRatePct     decimal.Decimal `bun:"tax_rate_pct,type:decimal(5,2),notnull,default:0" json:"tax_rate_pct"`
 	Position       int             `bun:"position,notnull,default:0" json:"position"`
 	CreatedAt      time.Time       `bun:"created_at,notnull,default:now()" json:"created_at"`
 	UpdatedAt      time.Time       `bun:"updated_at,notnull,default:now()" json:"updated_at"`
+
+	// Line amounts computed by the totals engine, see LineTotals.
+	SubtotalCents int64 `bun:"-" json:"subtotal_cents"`
+	TaxCents      int64 `bun:"-" json:"tax_cents"`
+	TotalCents    int64 `bun:"-" json:"total_cents"`
 }
 
 type Event struct {
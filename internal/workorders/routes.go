@@ -0,0 +1,61 @@
+package workorders
+
+import (
+	"context"
+
+	"github.com/brxyxn/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/config"
+	"github.com/brxyxn/engine-care-api/internal/middleware"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/pkg/mwchain"
+)
+
+// Routes registers the work order endpoints. They are
+// organization scoped: requests need the X-Org-Id header and a role granting the
+// endpoint's permission; tenancy authenticates the caller and scopes the request to the
+// organization (see middleware.Tenancy). The public estimate endpoints customers open
+// from their link are registered here too.
+func Routes(ctx context.Context, v1 *mux.Router, log *logger.Logger, cfg config.Config, db *bun.DB, tenancy mwchain.Chain) {
+	wo := v1.PathPrefix("/work-orders").Subrouter()
+	woLog := log.With().Str("route", "work-orders").Logger()
+	links := NewEstimateLinks(cfg.EstimateLinkSecret, cfg.PublicBaseURL, cfg.EstimateLinkTTL)
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		// Without a valid list no proxy is trusted and X-Forwarded-For is ignored.
+		log.Error().Err(err).Msg("invalid TRUSTED_PROXIES")
+	}
+	woHandler := Handler(woLog, db, links, proxies)
+
+	scoped := mwchain.NewChain(middleware.Logger(woLog)).Extend(tenancy)
+	read := scoped.Append(middleware.RequirePermission(organizations.PermWorkOrdersRead))
+	write := scoped.Append(middleware.RequirePermission(organizations.PermWorkOrdersWrite))
+	status := scoped.Append(middleware.RequirePermission(organizations.PermWorkOrdersStatus))
+	del := scoped.Append(middleware.RequirePermission(organizations.PermWorkOrdersDelete))
+
+	wo.Handle("", read.Then(woHandler.List())).Methods(api.GET)
+	wo.Handle("", write.Then(woHandler.Create())).Methods(api.POST)
+	wo.Handle("/{id}", read.Then(woHandler.ByID())).Methods(api.GET)
+	wo.Handle("/{id}", write.Then(woHandler.Update())).Methods(api.PATCH)
+	wo.Handle("/{id}", del.Then(woHandler.Delete())).Methods(api.DEL)
+	wo.Handle("/{id}/status", status.Then(woHandler.SetStatus())).Methods(api.PATCH)
+	wo.Handle("/{id}/transitions", read.Then(woHandler.Transitions())).Methods(api.GET)
+	wo.Handle("/{id}/invoice", read.Then(woHandler.Invoice())).Methods(api.GET)
+	wo.Handle("/{id}/estimates", read.Then(woHandler.Estimates())).Methods(api.GET)
+	wo.Handle("/{id}/estimates", write.Then(woHandler.SendEstimate())).Methods(api.POST)
+	wo.Handle("/{id}/items", write.Then(woHandler.AddItem())).Methods(api.POST)
+	wo.Handle("/{id}/items/{itemID}", write.Then(woHandler.UpdateItem())).Methods(api.PATCH)
+	wo.Handle("/{id}/items/{itemID}", write.Then(woHandler.RemoveItem())).Methods(api.DEL)
+
+	// Estimate links are public: the signed token in the path is the credential.
+	public := v1.PathPrefix("/public/estimates").Subrouter()
+	pubLog := log.With().Str("route", "public-estimates").Logger()
+	pubHandler := Handler(pubLog, db, links, proxies)
+	pub := mwchain.NewChain(middleware.Logger(pubLog))
+
+	public.Handle("/{token}", pub.Then(pubHandler.PublicEstimate())).Methods(api.GET)
+	public.Handle("/{token}/decision", pub.Then(pubHandler.DecideEstimate())).Methods(api.POST)
+}
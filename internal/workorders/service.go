@@ -0,0 +1,710 @@
+package workorders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
+	"github.com/uptrace/bun"
+
+	"github.com/brxyxn/engine-care-api/api"
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+	"github.com/brxyxn/engine-care-api/internal/tenant"
+)
+
+var (
+	ErrNotFound = api.NotFound("work order not found")
+	ErrClosed   = api.Conflict("work order is completed or canceled")
+	ErrNotDraft = api.Conflict("only draft work orders can be deleted")
+
+	ErrItemNotFound = api.NotFound("work order item not found")
+)
+
+type s interface {
+	Create(ctx context.Context, data CreateWorkOrder) (*WorkOrder, error)
+	ByID(ctx context.Context, id uuid.UUID) (*WorkOrder, error)
+	List(ctx context.Context, params api.ListParams) ([]*WorkOrder, api.Page, error)
+	Update(ctx context.Context, id uuid.UUID, data UpdateWorkOrder) (*WorkOrder, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	SetStatus(ctx context.Context, id uuid.UUID, data ChangeStatus) (*WorkOrder, error)
+	Transitions(ctx context.Context, id uuid.UUID) (*Transitions, error)
+	Invoice(ctx context.Context, id uuid.UUID) (*InvoiceDocument, error)
+	SendEstimate(ctx context.Context, id uuid.UUID, data SendEstimate) (*Estimate, error)
+	Estimates(ctx context.Context, id uuid.UUID) ([]*Estimate, error)
+	PublicEstimate(ctx context.Context, token string) (*PublicEstimate, error)
+	DecideEstimate(ctx context.Context, token, ip string, data EstimateDecision) (*Estimate, error)
+	AddItem(ctx context.Context, id uuid.UUID, data AddItem) (*WorkOrder, error)
+	UpdateItem(ctx context.Context, id, itemID uuid.UUID, data UpdateItem) (*WorkOrder, error)
+	RemoveItem(ctx context.Context, id, itemID uuid.UUID) (*WorkOrder, error)
+}
+
+// Svc manages the work orders of the request's organization. Every method must run
+// behind middleware.Tenancy: queries go through the request transaction (tenant.DB)
+// and are filtered by the tenant's organization. The public estimate methods are the
+// exception; they act as the estimate's sender once its link is verified.
+type Svc struct {
+	db    *bun.DB
+	log   zerolog.Logger
+	links EstimateLinks
+}
+
+var _ s = (*Svc)(nil)
+
+func Service(log zerolog.Logger, db *bun.DB, links EstimateLinks) Svc {
+	return Svc{
+		db:    db,
+		log:   log,
+		links: links,
+	}
+}
+
+// ListSpec is the filters and sort orders accepted by GET /work-orders.
+var ListSpec = api.ListSpec{
+	Alias: "wo",
+	Filters: []api.Filter{
+		{Param: "status", Column: "status", Parse: api.ParseEnum[Status]()},
+		{Param: "priority", Column: "priority", Parse: api.ParseEnum[Priority]()},
+		{Param: "customer_id", Column: "customer_id", Parse: api.ParseUUID},
+		{Param: "vehicle_id", Column: "vehicle_id", Parse: api.ParseUUID},
+		{Param: "project_id", Column: "project_id", Parse: api.ParseUUID},
+		{Param: "opened_after", Column: "opened_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "opened_before", Column: "opened_at", Op: api.OpLte, Parse: api.ParseTime},
+		{Param: "scheduled_after", Column: "scheduled_at", Op: api.OpGte, Parse: api.ParseTime},
+		{Param: "scheduled_before", Column: "scheduled_at", Op: api.OpLte, Parse: api.ParseTime},
+	},
+	Sorts:   []string{"created_at", "opened_at", "updated_at", "priority", "status"},
+	Default: "-created_at",
+	Search:  []string{"title"},
+}
+
+// Create opens a work order, with its initial items if any, as a draft, and logs the
+// check-in mileage when given.
+func (s *Svc) Create(ctx context.Context, data CreateWorkOrder) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+
+	wo := WorkOrder{
+		ID:             uuid.New(),
+		OrganizationID: t.OrganizationID,
+		ProjectID:      data.ProjectID,
+		CustomerID:     data.CustomerID,
+		VehicleID:      data.VehicleID,
+		Status:         StatusDraft,
+		Priority:       data.Priority,
+		Title:          data.Title,
+		Description:    data.Description,
+		ScheduledAt:    data.ScheduledAt,
+		CreatedBy:      t.UserID,
+	}
+	if wo.Priority == "" {
+		wo.Priority = PriorityNormal
+	}
+
+	err := tenant.DB(ctx, s.db).RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		err := checkReferences(ctx, tx, t.OrganizationID, data)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().
+			Model(&wo).
+			ExcludeColumn("opened_at", "created_at", "updated_at", "subtotal_cents", "tax_cents", "total_cents").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		if data.MileageKM != nil {
+			err = recordMileage(ctx, tx, t, &wo, wo.Status, *data.MileageKM)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(data.Items) == 0 {
+			return nil
+		}
+
+		items := make([]*Item, len(data.Items))
+		for i, it := range data.Items {
+			items[i] = it.item(t.OrganizationID, wo.ID, i)
+		}
+
+		_, err = tx.NewInsert().
+			Model(&items).
+			ExcludeColumn("created_at", "updated_at").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		return recalcTotals(ctx, tx, &wo)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, wo.ID)
+}
+
+// checkReferences makes sure the customer, vehicle and project of a new work order
+// belong to the organization, and the vehicle to the customer.
+func checkReferences(ctx context.Context, tx bun.Tx, orgID uuid.UUID, data CreateWorkOrder) error {
+	var fe api.FieldErrors
+
+	exists, err := tx.NewSelect().
+		Table("customers").
+		Where("id = ?", data.CustomerID).
+		Where("organization_id = ?", orgID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fe.Add("customer_id", "customer not found")
+	}
+
+	exists, err = tx.NewSelect().
+		Table("vehicles").
+		Where("id = ?", data.VehicleID).
+		Where("customer_id = ?", data.CustomerID).
+		Where("organization_id = ?", orgID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fe.Add("vehicle_id", "vehicle not found for this customer")
+	}
+
+	if data.ProjectID != nil {
+		exists, err = tx.NewSelect().
+			Table("projects").
+			Where("id = ?", *data.ProjectID).
+			Where("organization_id = ?", orgID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fe.Add("project_id", "project not found")
+		}
+	}
+
+	if len(fe) > 0 {
+		return api.Validation("request validation failed", fe...)
+	}
+	return nil
+}
+
+// ByID gets a work order with its items (by position) and events (oldest first).
+func (s *Svc) ByID(ctx context.Context, id uuid.UUID) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var wo WorkOrder
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model(&wo).
+		Where("wo.id = ?", id).
+		Where("wo.organization_id = ?", t.OrganizationID).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.OrderExpr("woi.position ASC, woi.created_at ASC")
+		}).
+		Relation("Events", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.OrderExpr("woe.created_at ASC, woe.id ASC")
+		}).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wo, nil
+}
+
+// List lists one page of work orders, without items and events.
+func (s *Svc) List(ctx context.Context, params api.ListParams) ([]*WorkOrder, api.Page, error) {
+	t := tenant.MustFromContext(ctx)
+
+	wos := []*WorkOrder{}
+	q := tenant.DB(ctx, s.db).NewSelect().
+		Model(&wos).
+		Where("wo.organization_id = ?", t.OrganizationID)
+
+	err := params.Apply(q).Scan(ctx)
+	if err != nil {
+		return nil, api.Page{}, err
+	}
+
+	wos, page := api.PageOf(params, wos)
+	return wos, page, nil
+}
+
+// Update changes the title, description, priority or schedule of an open work order.
+func (s *Svc) Update(ctx context.Context, id uuid.UUID, data UpdateWorkOrder) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Closed() {
+		return nil, ErrClosed
+	}
+
+	q := db.NewUpdate().
+		Model((*WorkOrder)(nil)).
+		Set("updated_by = ?", t.UserID).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	if data.Title != nil {
+		q = q.Set("title = ?", *data.Title)
+	}
+	if data.Description != nil {
+		// An empty description clears it.
+		q = q.Set("description = NULLIF(?, '')", *data.Description)
+	}
+	if data.Priority != nil {
+		q = q.Set("priority = ?", *data.Priority)
+	}
+	if data.ScheduledAt != nil {
+		q = q.Set("scheduled_at = ?", *data.ScheduledAt)
+	}
+
+	_, err = q.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// Delete deletes a draft work order with its items and events.
+func (s *Svc) Delete(ctx context.Context, id uuid.UUID) error {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return err
+	}
+	if wo.Status != StatusDraft {
+		return ErrNotDraft
+	}
+
+	_, err = db.NewDelete().
+		Model((*WorkOrder)(nil)).
+		Where("id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	return err
+}
+
+// StatusChangedEvent is the event type recorded for every status transition.
+const StatusChangedEvent = "status_changed"
+
+// TransitionDetails is the error detail of a rejected status change.
+type TransitionDetails struct {
+	From    Status   `json:"from"`
+	To      Status   `json:"to"`
+	Allowed []Status `json:"allowed"`
+}
+
+// SetStatus moves a work order through the state machine, stamps its lifecycle
+// timestamps, records a status_changed event, logs the odometer reading if any and, on
+// completion, issues the invoice, all in the request transaction.
+func (s *Svc) SetStatus(ctx context.Context, id uuid.UUID, data ChangeStatus) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.FromStatus != nil && *data.FromStatus != wo.Status {
+		return nil, api.PreconditionFailed("work order status has changed").
+			WithDetails(TransitionDetails{From: wo.Status, To: data.Status, Allowed: AllowedTransitions(wo.Status, t.Role)})
+	}
+
+	if !wo.Status.CanTransition(data.Status) {
+		return nil, api.Conflict(fmt.Sprintf("work order cannot move from %s to %s", wo.Status, data.Status)).
+			WithDetails(TransitionDetails{From: wo.Status, To: data.Status, Allowed: AllowedTransitions(wo.Status, t.Role)})
+	}
+
+	perm := TransitionPermission(data.Status)
+	if !t.Role.Can(perm) {
+		return nil, api.Forbidden("insufficient permissions").
+			WithDetails(map[string]any{"role": t.Role, "required_permissions": []organizations.Permission{perm}})
+	}
+
+	message := fmt.Sprintf("Status changed %s → %s", wo.Status, data.Status)
+	if data.Message != nil && *data.Message != "" {
+		message = *data.Message
+	}
+
+	// The reading goes first: completing the order issues the invoice, which copies
+	// the vehicle's mileage.
+	if data.MileageKM != nil {
+		err = recordMileage(ctx, db, t, wo, data.Status, *data.MileageKM)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = changeStatus(ctx, db, t, wo, data.Status, message, &t.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// changeStatus moves a locked work order to status to without checking the state
+// machine or permissions: it stamps the lifecycle timestamps, records a status_changed
+// event with message and, on completion, issues the invoice. actor is recorded as
+// updated_by and on the event; it is nil for customer actions, as with addEvent.
+func changeStatus(ctx context.Context, db bun.IDB, t tenant.Tenant, wo *WorkOrder, to Status, message string, actor *uuid.UUID) error {
+	now := time.Now()
+	q := db.NewUpdate().
+		Model((*WorkOrder)(nil)).
+		Set("status = ?", to).
+		Set("updated_by = ?", actor).
+		Set("updated_at = ?", now).
+		Where("id = ?", wo.ID).
+		Where("organization_id = ?", t.OrganizationID)
+
+	switch to {
+	case StatusInProgress:
+		q = q.Set("started_at = COALESCE(started_at, ?)", now).
+			Set("completed_at = NULL") // back from ready_* for rework
+	case StatusReadyForPickup, StatusReadyForDeliver:
+		q = q.Set("completed_at = COALESCE(completed_at, ?)", now)
+	case StatusCompleted:
+		q = q.Set("completed_at = COALESCE(completed_at, ?)", now).
+			Set("closed_at = ?", now)
+	case StatusCanceled:
+		q = q.Set("closed_at = ?", now)
+	}
+
+	_, err := q.Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	from := wo.Status
+	event := Event{
+		OrganizationID: t.OrganizationID,
+		WorkOrderID:    wo.ID,
+		EventType:      StatusChangedEvent,
+		FromStatus:     &from,
+		ToStatus:       &to,
+		Message:        &message,
+		CreatedBy:      actor,
+	}
+	_, err = db.NewInsert().
+		Model(&event).
+		ExcludeColumn("created_at").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if to == StatusCompleted {
+		err = issueInvoice(ctx, db, t, wo.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	wo.Status = to
+	return nil
+}
+
+// Transitions lists the statuses the caller's role may move a work order to.
+func (s *Svc) Transitions(ctx context.Context, id uuid.UUID) (*Transitions, error) {
+	t := tenant.MustFromContext(ctx)
+
+	var status Status
+	err := tenant.DB(ctx, s.db).NewSelect().
+		Model((*WorkOrder)(nil)).
+		Column("status").
+		Where("wo.id = ?", id).
+		Where("wo.organization_id = ?", t.OrganizationID).
+		Scan(ctx, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transitions{From: status, To: AllowedTransitions(status, t.Role)}, nil
+}
+
+// AddItem adds an item to an open work order, at data.Position or last, and
+// recomputes its totals.
+func (s *Svc) AddItem(ctx context.Context, id uuid.UUID, data AddItem) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Closed() {
+		return nil, ErrClosed
+	}
+
+	count, err := db.NewSelect().
+		Model((*Item)(nil)).
+		Where("woi.work_order_id = ?", id).
+		Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxItems {
+		return nil, api.Conflict(fmt.Sprintf("work order cannot have more than %d items", maxItems))
+	}
+
+	item := data.item(t.OrganizationID, id, count)
+	_, err = db.NewInsert().
+		Model(item).
+		ExcludeColumn("created_at", "updated_at").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reorderItems(ctx, db, wo, item.ID, data.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	err = itemsChanged(ctx, db, t, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recalcTotals(ctx, db, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// UpdateItem changes an item of an open work order, moving it when data.Position is
+// set, and recomputes the work order totals.
+func (s *Svc) UpdateItem(ctx context.Context, id, itemID uuid.UUID, data UpdateItem) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Closed() {
+		return nil, ErrClosed
+	}
+
+	q := db.NewUpdate().
+		Model((*Item)(nil)).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", itemID).
+		Where("work_order_id = ?", id).
+		Where("organization_id = ?", t.OrganizationID)
+
+	if data.ItemType != nil {
+		q = q.Set("item_type = ?", *data.ItemType)
+	}
+	if data.SKU != nil {
+		// An empty SKU clears it.
+		q = q.Set("sku = NULLIF(?, '')", *data.SKU)
+	}
+	if data.Name != nil {
+		q = q.Set("name = ?", *data.Name)
+	}
+	if data.Qty != nil {
+		q = q.Set("qty = ?", *data.Qty)
+	}
+	if data.UnitPriceCents != nil {
+		q = q.Set("unit_price_cents = ?", *data.UnitPriceCents)
+	}
+	if data.TaxRatePct != nil {
+		q = q.Set("tax_rate_pct = ?", *data.TaxRatePct)
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrItemNotFound
+	}
+
+	if data.Position != nil {
+		err = reorderItems(ctx, db, wo, itemID, data.Position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = itemsChanged(ctx, db, t, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recalcTotals(ctx, db, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// RemoveItem deletes an item of an open work order, closes the gap in the positions
+// and recomputes the work order totals.
+func (s *Svc) RemoveItem(ctx context.Context, id, itemID uuid.UUID) (*WorkOrder, error) {
+	t := tenant.MustFromContext(ctx)
+	db := tenant.DB(ctx, s.db)
+
+	wo, err := lockWorkOrder(ctx, db, t.OrganizationID, id)
+	if err != nil {
+		return nil, err
+	}
+	if wo.Closed() {
+		return nil, ErrClosed
+	}
+
+	res, err := db.NewDelete().
+		Model((*Item)(nil)).
+		Where("id = ?", itemID).
+		Where("work_order_id = ?", id).
+		Where("organization_id = ?", t.OrganizationID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrItemNotFound
+	}
+
+	err = reorderItems(ctx, db, wo, uuid.Nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = itemsChanged(ctx, db, t, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recalcTotals(ctx, db, wo)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, id)
+}
+
+// itemsChanged supersedes the pending estimate of wo after its items changed, recording
+// it on the work order; a new estimate has to be sent for the customer to approve.
+func itemsChanged(ctx context.Context, db bun.IDB, t tenant.Tenant, wo *WorkOrder) error {
+	superseded, err := supersedeEstimates(ctx, db, t.OrganizationID, wo.ID)
+	if err != nil || !superseded {
+		return err
+	}
+	return addEvent(ctx, db, t.OrganizationID, wo.ID, EstimateSupersededEvent,
+		"Pending estimate superseded: the items changed after it was sent", &t.UserID)
+}
+
+// reorderItems renumbers the items of a work order 0..n-1, keeping their order except
+// for item moved, which is placed at position (clamped to the last slot) when set.
+func reorderItems(ctx context.Context, db bun.IDB, wo *WorkOrder, moved uuid.UUID, position *int) error {
+	items := []*Item{}
+	err := db.NewSelect().
+		Model(&items).
+		Column("id", "position").
+		Where("woi.work_order_id = ?", wo.ID).
+		OrderExpr("woi.position ASC, woi.created_at ASC, woi.id ASC").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	if position != nil {
+		for i, it := range items {
+			if it.ID != moved {
+				continue
+			}
+			items = append(items[:i], items[i+1:]...)
+			p := min(*position, len(items))
+			items = append(items[:p], append([]*Item{it}, items[p:]...)...)
+			break
+		}
+	}
+
+	for i, it := range items {
+		if it.Position == i {
+			continue
+		}
+		_, err = db.NewUpdate().
+			Model((*Item)(nil)).
+			Set("position = ?", i).
+			Where("id = ?", it.ID).
+			Where("organization_id = ?", wo.OrganizationID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockWorkOrder loads a work order FOR UPDATE, so its status can't change until the
+// request transaction ends.
+func lockWorkOrder(ctx context.Context, db bun.IDB, orgID, id uuid.UUID) (*WorkOrder, error) {
+	var wo WorkOrder
+	err := db.NewSelect().
+		Model(&wo).
+		Where("wo.id = ?", id).
+		Where("wo.organization_id = ?", orgID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wo, nil
+}
+
+// item builds the row of the i-th item of a new work order.
+func (it CreateItem) item(orgID, workOrderID uuid.UUID, i int) *Item {
+	qty := decimal.NewFromInt(1)
+	if it.Qty != nil {
+		qty = *it.Qty
+	}
+
+	return &Item{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		WorkOrderID:    workOrderID,
+		ItemType:       it.ItemType,
+		SKU:            it.SKU,
+		Name:           it.Name,
+		Qty:            qty,
+		UnitPriceCents: it.UnitPriceCents,
+		TaxRatePct:     it.TaxRatePct,
+		Position:       i,
+	}
+}
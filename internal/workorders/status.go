@@ -0,0 +1,68 @@
+package workorders
+
+import (
+	"github.com/brxyxn/engine-care-api/internal/organizations"
+)
+
+// transitions is the work order state machine: the statuses each status may move to.
+// Any non-terminal status may also be canceled (see Transitions). The usual path is
+// draft → new → checking → awaiting_approval → in_progress → ready_for_pickup → completed.
+var transitions = map[Status][]Status{
+	StatusDraft:            {StatusNew},
+	StatusNew:              {StatusChecking, StatusScheduled, StatusAwaitingCustomer, StatusInProgress},
+	StatusChecking:         {StatusAwaitingApproval, StatusAwaitingCustomer, StatusScheduled, StatusInProgress},
+	StatusScheduled:        {StatusAwaitingCustomer, StatusChecking, StatusInProgress},
+	StatusAwaitingCustomer: {StatusScheduled, StatusChecking, StatusInProgress},
+	StatusAwaitingApproval: {StatusScheduled, StatusInProgress},
+	StatusInProgress:       {StatusWaitingParts, StatusAwaitingApproval, StatusReadyForPickup, StatusReadyForDeliver, StatusCompleted},
+	StatusWaitingParts:     {StatusInProgress},
+	StatusReadyForPickup:   {StatusInProgress, StatusCompleted},
+	StatusReadyForDeliver:  {StatusInProgress, StatusEnRoute, StatusReadyForPickup},
+	StatusEnRoute:          {StatusReadyForDeliver, StatusCompleted},
+	StatusCompleted:        {},
+	StatusCanceled:         {},
+}
+
+// Terminal reports whether no transition leaves s.
+func (s Status) Terminal() bool {
+	return s == StatusCompleted || s == StatusCanceled
+}
+
+// Transitions lists the statuses a work order in s may move to.
+func (s Status) Transitions() []Status {
+	if s.Terminal() {
+		return nil
+	}
+	next := append([]Status{}, transitions[s]...)
+	return append(next, StatusCanceled)
+}
+
+// CanTransition reports whether the state machine allows moving from s to to.
+func (s Status) CanTransition(to Status) bool {
+	for _, next := range s.Transitions() {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionPermission is the permission needed to move a work order to status to.
+// Canceling is reserved to managers; everything else is shop-floor work.
+func TransitionPermission(to Status) organizations.Permission {
+	if to == StatusCanceled {
+		return organizations.PermWorkOrdersCancel
+	}
+	return organizations.PermWorkOrdersStatus
+}
+
+// AllowedTransitions lists the statuses role may move a work order in s to.
+func AllowedTransitions(s Status, role organizations.OrgRole) []Status {
+	allowed := []Status{}
+	for _, next := range s.Transitions() {
+		if role.Can(TransitionPermission(next)) {
+			allowed = append(allowed, next)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,73 @@
+package workorders
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+	"github.com/uptrace/bun"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// Totals are the amounts of a work order, in cents.
+type Totals struct {
+	SubtotalCents int64 `json:"subtotal_cents"`
+	TaxCents      int64 `json:"tax_cents"`
+	TotalCents    int64 `json:"total_cents"`
+}
+
+// LineTotals returns the subtotal (unit price × qty) and tax of an item in cents. Each
+// is rounded half up to the cent per line, tax on the rounded subtotal, so work order
+// totals are always the sum of the lines shown on an invoice.
+func (it *Item) LineTotals() (subtotal, tax int64) {
+	sub := decimal.NewFromInt(it.UnitPriceCents).Mul(it.Qty).Round(0)
+	tx := sub.Mul(it.TaxRatePct).Div(hundred).Round(0)
+	return sub.IntPart(), tx.IntPart()
+}
+
+// AfterScanRow fills the computed line amounts.
+func (it *Item) AfterScanRow(context.Context) error {
+	it.SubtotalCents, it.TaxCents = it.LineTotals()
+	it.TotalCents = it.SubtotalCents + it.TaxCents
+	return nil
+}
+
+var _ bun.AfterScanRowHook = (*Item)(nil)
+
+// ComputeTotals is the totals engine: the sum of the line totals of items.
+func ComputeTotals(items []*Item) Totals {
+	t := Totals{}
+	for _, it := range items {
+		sub, tax := it.LineTotals()
+		t.SubtotalCents += sub
+		t.TaxCents += tax
+	}
+	t.TotalCents = t.SubtotalCents + t.TaxCents
+	return t
+}
+
+// recalcTotals recomputes and stores the totals of a work order from its items.
+// It must run in the transaction that changed the items, after lockWorkOrder.
+func recalcTotals(ctx context.Context, db bun.IDB, wo *WorkOrder) error {
+	items := []*Item{}
+	err := db.NewSelect().
+		Model(&items).
+		Column("qty", "unit_price_cents", "tax_rate_pct").
+		Where("woi.work_order_id = ?", wo.ID).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	t := ComputeTotals(items)
+	_, err = db.NewUpdate().
+		Model((*WorkOrder)(nil)).
+		Set("subtotal_cents = ?", t.SubtotalCents).
+		Set("tax_cents = ?", t.TaxCents).
+		Set("total_cents = ?", t.TotalCents).
+		Set("updated_at = now()").
+		Where("id = ?", wo.ID).
+		Where("organization_id = ?", wo.OrganizationID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,124 @@
+package workorders
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// roundHalfUp rounds a non-negative r to the nearest integer, halves up.
+func roundHalfUp(r *big.Rat) int64 {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if new(big.Int).Mul(m, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q.Int64()
+}
+
+// referenceLine computes the line amounts with exact rationals.
+func referenceLine(it *Item) (subtotal, tax int64) {
+	qty, _ := new(big.Rat).SetString(it.Qty.String())
+	rate, _ := new(big.Rat).SetString(it.TaxRatePct.String())
+
+	subtotal = roundHalfUp(new(big.Rat).Mul(new(big.Rat).SetInt64(it.UnitPriceCents), qty))
+	tax = roundHalfUp(new(big.Rat).Quo(new(big.Rat).Mul(new(big.Rat).SetInt64(subtotal), rate), big.NewRat(100, 1)))
+	return subtotal, tax
+}
+
+// randomItem draws an item with up to 2 decimal places of qty and tax rate, favoring
+// whole quantities and common rates now and then.
+func randomItem(r *rand.Rand) *Item {
+	it := &Item{
+		Qty:            decimal.New(r.Int63n(99_999)+1, -2),
+		UnitPriceCents: r.Int63n(10_000_000),
+		TaxRatePct:     decimal.New(r.Int63n(10_001), -2),
+	}
+	switch r.Intn(4) {
+	case 0:
+		it.Qty = decimal.NewFromInt(r.Int63n(20) + 1)
+	case 1:
+		it.TaxRatePct = decimal.NewFromInt([]int64{0, 7, 10, 16, 21}[r.Intn(5)])
+	}
+	return it
+}
+
+func TestComputeTotalsIsSumOfLines(t *testing.T) {
+	r := rand.New(rand.NewSource(20251006))
+
+	for i := 0; i < 2000; i++ {
+		items := make([]*Item, r.Intn(maxItems+1))
+		var wantSub, wantTax int64
+		for j := range items {
+			items[j] = randomItem(r)
+
+			sub, tax := items[j].LineTotals()
+			refSub, refTax := referenceLine(items[j])
+			if sub != refSub || tax != refTax {
+				t.Fatalf("LineTotals(qty %s × %d at %s%%) = %d, %d, want %d, %d",
+					items[j].Qty, items[j].UnitPriceCents, items[j].TaxRatePct, sub, tax, refSub, refTax)
+			}
+			wantSub += sub
+			wantTax += tax
+		}
+
+		got := ComputeTotals(items)
+		if got.SubtotalCents != wantSub || got.TaxCents != wantTax {
+			t.Fatalf("ComputeTotals of %d items = %+v, want subtotal %d and tax %d", len(items), got, wantSub, wantTax)
+		}
+		if got.TotalCents != got.SubtotalCents+got.TaxCents {
+			t.Fatalf("total %d != subtotal %d + tax %d", got.TotalCents, got.SubtotalCents, got.TaxCents)
+		}
+	}
+}
+
+func TestLineTotalsRoundHalfUp(t *testing.T) {
+	tests := []struct {
+		name          string
+		qty           string
+		priceCents    int64
+		rate          string
+		subtotal, tax int64
+	}{
+		{"half a cent subtotal", "0.5", 1, "0", 1, 0},
+		{"2.5 cents", "0.5", 5, "0", 3, 0},
+		{"4.5 cents", "1.5", 3, "0", 5, 0},
+		{"just under a half", "0.49", 1, "0", 0, 0},
+		{"tax of half a cent", "1", 50, "1", 50, 1},
+		{"tax 2.5 rounds up, not to even", "1", 250, "1", 250, 3},
+		{"fractional rate", "1", 200, "8.25", 200, 17},
+		{"fractional rate, 82.5", "1", 1000, "8.25", 1000, 83},
+		{"tax on the rounded subtotal", "0.5", 1, "50", 1, 1},
+		{"fractional qty and rate", "2.25", 1999, "7.5", 4498, 337},
+		{"no tax", "3", 1234, "0", 3702, 0},
+		{"full rate", "1", 999, "100", 999, 999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := &Item{
+				Qty:            decimal.RequireFromString(tt.qty),
+				UnitPriceCents: tt.priceCents,
+				TaxRatePct:     decimal.RequireFromString(tt.rate),
+			}
+			sub, tax := it.LineTotals()
+			if sub != tt.subtotal || tax != tt.tax {
+				t.Fatalf("LineTotals = %d, %d, want %d, %d", sub, tax, tt.subtotal, tt.tax)
+			}
+
+			if err := it.AfterScanRow(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if it.SubtotalCents != sub || it.TaxCents != tax || it.TotalCents != sub+tax {
+				t.Fatalf("scanned item amounts = %d, %d, %d", it.SubtotalCents, it.TaxCents, it.TotalCents)
+			}
+		})
+	}
+}
+
+func TestComputeTotalsEmpty(t *testing.T) {
+	if got := ComputeTotals(nil); got != (Totals{}) {
+		t.Fatalf("ComputeTotals(nil) = %+v, want zero", got)
+	}
+}